@@ -0,0 +1,81 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package v1beta1
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The types of the conditions of jobs and managers
+const (
+	// ConditionDeploymentReady is true when the pods of the job or manager are ready
+	ConditionDeploymentReady = "DeploymentReady"
+	// ConditionVolumeBound is true when the PVC of the job is bound
+	ConditionVolumeBound = "VolumeBound"
+	// ConditionIngressReady is true when the ingress or HTTPRoute is admitted
+	ConditionIngressReady = "IngressReady"
+	// ConditionWorkerRegistered is true once the worker of the job registered on the manager
+	ConditionWorkerRegistered = "WorkerRegistered"
+	// ConditionSyncing is true while the job syncs
+	ConditionSyncing = "Syncing"
+	// ConditionDegraded is true when the last sync failed or the volume of the job is full
+	ConditionDegraded = "Degraded"
+)
+
+// syncReason turns a sync status like pre-syncing into a condition reason like PreSyncing
+func syncReason(s SyncStatus) string {
+	if s == "" {
+		return "Unknown"
+	}
+	words := strings.Split(string(s), "-")
+	for i, w := range words {
+		words[i] = strings.ToUpper(w[:1]) + w[1:]
+	}
+	return strings.Join(words, "")
+}
+
+// SetSyncConditions sets the Syncing and Degraded conditions of a job from its sync status and volume warning
+func (in *JobStatus) SetSyncConditions(generation int64) {
+	syncing := metav1.Condition{
+		Type:               ConditionSyncing,
+		Status:             metav1.ConditionFalse,
+		Reason:             syncReason(in.Status),
+		ObservedGeneration: generation,
+	}
+	if in.Status == Syncing || in.Status == PreSyncing {
+		syncing.Status = metav1.ConditionTrue
+	}
+	meta.SetStatusCondition(&in.Conditions, syncing)
+
+	degraded := metav1.Condition{
+		Type:               ConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		Reason:             "AsExpected",
+		ObservedGeneration: generation,
+	}
+	switch {
+	case in.Status == Failed:
+		degraded.Status, degraded.Reason, degraded.Message = metav1.ConditionTrue, "SyncFailed", in.ErrorMsg
+	case in.VolumeWarning != "":
+		degraded.Status, degraded.Reason, degraded.Message = metav1.ConditionTrue, "VolumeFull", in.VolumeWarning
+	}
+	meta.SetStatusCondition(&in.Conditions, degraded)
+}
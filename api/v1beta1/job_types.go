@@ -37,7 +37,7 @@ type JobConfig struct {
 	Url           string          `json:"url,omitempty"`
 	HelpUrl       string          `json:"helpUrl,omitempty"`
 	Type          MirrorType      `json:"type,omitempty"`
-	Upstream      string          `json:"upstream"`
+	Upstream      string          `json:"upstream,omitempty"`
 	Provider      string          `json:"provider,omitempty"`
 	MirrorPath    string          `json:"mirrorPath,omitempty"`
 	Command       string          `json:"command,omitempty"`
@@ -55,10 +55,79 @@ type JobConfig struct {
 	ExecOnFailure string          `json:"execOnFailure,omitempty"`
 	SizePattern   string          `json:"sizePattern,omitempty"`
 	AdditionEnvs  []corev1.EnvVar `json:"additionEnvs,omitempty"`
+	// Auth refers to the Secrets holding the credentials of the upstream, never put them in AdditionEnvs
+	Auth UpstreamAuth `json:"auth,omitempty"`
 	// Why this is a string? It's a feature! Maybe you can write debug reason here as long as it's not empty. :)
 	Debug string `json:"debug,omitempty"`
 }
 
+// UpstreamAuth refers to the Secrets holding the credentials of the upstream. They are mounted into the worker
+// as files, so they are neither in the spec nor in the env of the worker
+type UpstreamAuth struct {
+	// RsyncPassword is the password of the rsync daemon, given to rsync with --password-file
+	RsyncPassword *corev1.SecretKeySelector `json:"rsyncPassword,omitempty"`
+	// BasicAuth is a kubernetes.io/basic-auth Secret with the username and password keys
+	BasicAuth *corev1.LocalObjectReference `json:"basicAuth,omitempty"`
+	// BearerToken is sent in the Authorization header of the http requests to the upstream
+	BearerToken *corev1.SecretKeySelector `json:"bearerToken,omitempty"`
+	// SSHKey is a kubernetes.io/ssh-auth Secret with the ssh-privatekey key, and known_hosts to check the host keys
+	SSHKey *corev1.LocalObjectReference `json:"sshKey,omitempty"`
+	// S3 is a Secret with the access-key-id and secret-access-key keys
+	S3 *corev1.LocalObjectReference `json:"s3,omitempty"`
+}
+
+// FrontRedirect redirects the requests whose path matches From, a caddy path matcher, to To
+type FrontRedirect struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Code is the status code of the redirect, default 302
+	Code int `json:"code,omitempty"`
+}
+
+// FrontCacheRule sets the cache headers of the responses whose path matches Path, a caddy path matcher
+type FrontCacheRule struct {
+	Path         string `json:"path"`
+	CacheControl string `json:"cacheControl,omitempty"`
+	// AccelExpires is the X-Accel-Expires header in seconds, used by caching proxies in front of the mirror
+	AccelExpires string `json:"accelExpires,omitempty"`
+}
+
+// FrontRateLimit limits the requests of each client address, it needs the rate_limit caddy module in the front image
+type FrontRateLimit struct {
+	Requests int `json:"requests"`
+	// Window is the duration the requests are counted in, default 1m
+	Window string `json:"window,omitempty"`
+}
+
+// FrontOptions are applied to the front config of a job
+type FrontOptions struct {
+	DisableBrowse string            `json:"disableBrowse,omitempty"`
+	IndexFiles    []string          `json:"indexFiles,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	// MimeTypes maps file extensions, like .whl, to the Content-Type served for them
+	MimeTypes map[string]string `json:"mimeTypes,omitempty"`
+	Redirects []FrontRedirect   `json:"redirects,omitempty"`
+	Cache     []FrontCacheRule  `json:"cache,omitempty"`
+	RateLimit *FrontRateLimit   `json:"rateLimit,omitempty"`
+}
+
+// RsyncdOptions are rendered to the rsyncd.conf of the rsync service of a job
+type RsyncdOptions struct {
+	// Module is the name of the rsync module, default the job name
+	Module string `json:"module,omitempty"`
+	// Comment of the module, default the description of the job
+	Comment        string   `json:"comment,omitempty"`
+	MaxConnections int      `json:"maxConnections,omitempty"`
+	HostsAllow     []string `json:"hostsAllow,omitempty"`
+	HostsDeny      []string `json:"hostsDeny,omitempty"`
+	// Motd is the message shown to clients on connecting
+	Motd string `json:"motd,omitempty"`
+	// Timeout is the io timeout in seconds, default 600
+	Timeout int `json:"timeout,omitempty"`
+	// ReadOnly default true
+	ReadOnly string `json:"readOnly,omitempty"`
+}
+
 type JobDeploy struct {
 	DeployConfig `json:",inline"`
 
@@ -66,23 +135,117 @@ type JobDeploy struct {
 	FrontMode    string `json:"frontMode,omitempty"`
 	FrontImage   string `json:"frontImage,omitempty"`
 	FrontCmd     string `json:"frontCmd,omitempty"`
-	DisableRsync string `json:"disableRsync,omitempty"`
-	RsyncImage   string `json:"rsyncImage,omitempty"`
-	RsyncCmd     string `json:"rsyncCmd,omitempty"`
+	// FrontConfig is the caddy json config of this job, replacing the one of the controller
+	FrontConfig string `json:"frontConfig,omitempty"`
+	// Front are the options applied over the front config
+	Front        FrontOptions `json:"front,omitempty"`
+	DisableRsync string       `json:"disableRsync,omitempty"`
+	RsyncImage   string       `json:"rsyncImage,omitempty"`
+	RsyncCmd     string       `json:"rsyncCmd,omitempty"`
+	// Rsyncd are the options of the rsyncd.conf mounted into the rsync service
+	Rsyncd RsyncdOptions `json:"rsyncd,omitempty"`
+	// GitDaemon adds a git daemon serving git:// to git jobs, whose front serves the repositories over http
+	GitDaemon string `json:"gitDaemon,omitempty"`
+	// SyncMode is worker, the default, syncing in a long-lived worker container of the deployment,
+	// or cronjob, syncing in the Jobs of a CronJob so the sync only takes resources while it runs
+	SyncMode SyncMode `json:"syncMode,omitempty"`
+	// Schedule is the cron schedule of the cronjob sync mode, default derived from the interval
+	Schedule string `json:"schedule,omitempty"`
+}
+
+type SyncMode string
+
+const (
+	WorkerSync  SyncMode = "worker"
+	CronJobSync SyncMode = "cronjob"
+)
+
+// ProxyCacheRule sets how long the responses whose path matches Path are cached. Path is a glob matched
+// against the whole request path, or against the file name if it has no slash
+type ProxyCacheRule struct {
+	Path string `json:"path"`
+	// TTL is a duration like 10m, 0 disables caching
+	TTL string `json:"ttl"`
+}
+
+// ProxyConfig configures the caching reverse proxy of a proxy job, which fetches from the upstream of the job
+type ProxyConfig struct {
+	// CacheSize is the most the cache may take of the volume, default 90% of the volume size
+	CacheSize string `json:"cacheSize,omitempty"`
+	// TTL of the responses matching no rule, default 1h
+	TTL   string           `json:"ttl,omitempty"`
+	Rules []ProxyCacheRule `json:"rules,omitempty"`
 }
 
 type PVConfig struct {
+	// Size of the PVC of the job, default 50Gi, or the quota of the job on a shared volume
 	Size         string                            `json:"size,omitempty"`
 	StorageClass *string                           `json:"storageClass,omitempty"`
 	AccessMode   corev1.PersistentVolumeAccessMode `json:"accessMode,omitempty"`
+	// SharedClaim is an existing PVC holding many jobs, the job mounts its subdirectory
+	// named after the job instead of getting a PVC of its own
+	SharedClaim string `json:"sharedClaim,omitempty"`
+	// HostPath is a node directory holding many jobs like SharedClaim, pin the jobs to the node with deploy.nodeName
+	HostPath string `json:"hostPath,omitempty"`
+	// ServeAll makes the front and rsync of the job serve the whole shared volume, so one pod
+	// serves every job on it and the others can disable their front and rsync
+	ServeAll string `json:"serveAll,omitempty"`
+	// AutoExpand grows the PVC of the job as the worker reports it filling up
+	AutoExpand *VolumeExpansion `json:"autoExpand,omitempty"`
+	// ReclaimPolicy tells what happens to the PVC when the job is deleted, default Delete
+	ReclaimPolicy ReclaimPolicy `json:"reclaimPolicy,omitempty"`
+	// SnapshotClass is the VolumeSnapshotClass of the Snapshot reclaim policy, default the cluster default
+	SnapshotClass *string `json:"snapshotClass,omitempty"`
+	// VolumeRef is the name of a PVC, like one retained from a deleted job, the job adopts instead of
+	// the one named after it
+	VolumeRef string `json:"volumeRef,omitempty"`
+}
+
+type ReclaimPolicy string
+
+const (
+	// ReclaimDelete deletes the PVC with the job
+	ReclaimDelete ReclaimPolicy = "Delete"
+	// ReclaimRetain keeps the PVC for a new job of the same name, or with volumeRef set to it, to adopt
+	ReclaimRetain ReclaimPolicy = "Retain"
+	// ReclaimSnapshot takes a VolumeSnapshot of the PVC before it is deleted
+	ReclaimSnapshot ReclaimPolicy = "Snapshot"
+)
+
+// ClaimName returns the name of the PVC of the job
+func (in *Job) ClaimName() string {
+	if in.Spec.Volume.VolumeRef != "" {
+		return in.Spec.Volume.VolumeRef
+	}
+	return in.Name
+}
+
+// VolumeExpansion is the policy growing the PVC of a job, its storage class must allow volume expansion
+type VolumeExpansion struct {
+	// Threshold is the usage in percent above which the PVC grows, default 85
+	Threshold int `json:"threshold,omitempty"`
+	// Increase is the percent the PVC grows by, default 20
+	Increase int `json:"increase,omitempty"`
+	// MaxSize is the size the PVC never grows beyond
+	MaxSize string `json:"maxSize"`
+}
+
+// Shared tells if the job lives in a subdirectory of a volume shared with other jobs
+func (in *PVConfig) Shared() bool {
+	return in.SharedClaim != "" || in.HostPath != ""
 }
 
 // JobSpec defines the desired state of Job
 type JobSpec struct {
-	Config  JobConfig     `json:"config"`
-	Deploy  JobDeploy     `json:"deploy,omitempty"`
-	Volume  PVConfig      `json:"volume,omitempty"`
-	Ingress IngressConfig `json:"ingress,omitempty"`
+	// Template is the name of a JobTemplate in the same namespace whose values are used
+	// for the fields not set in this job
+	Template string        `json:"template,omitempty"`
+	Config   JobConfig     `json:"config"`
+	Deploy   JobDeploy     `json:"deploy,omitempty"`
+	Volume   PVConfig      `json:"volume,omitempty"`
+	Ingress  IngressConfig `json:"ingress,omitempty"`
+	// Proxy is used by jobs of the proxy type
+	Proxy ProxyConfig `json:"proxy,omitempty"`
 }
 
 type SyncStatus string
@@ -111,10 +274,49 @@ type JobStatus struct {
 	ErrorMsg     string     `json:"errorMsg"`
 	LastOnline   int64      `json:"lastOnline"`
 	LastRegister int64      `json:"lastRegister"`
+	// CacheHits and CacheMisses are counted by the proxy of proxy jobs since it started
+	CacheHits   uint64 `json:"cacheHits,omitempty"`
+	CacheMisses uint64 `json:"cacheMisses,omitempty"`
+	// VolumeUsed and VolumeCapacity are the bytes used and total of the file system of the job, reported by the worker
+	VolumeUsed     uint64 `json:"volumeUsed,omitempty"`
+	VolumeCapacity uint64 `json:"volumeCapacity,omitempty"`
+	// VolumeWarning is set by the controller when the volume of the job is filling up and can not grow
+	VolumeWarning string `json:"volumeWarning,omitempty"`
+	// ObservedGeneration is the generation of the job the controller last deployed
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions are DeploymentReady, VolumeBound and IngressReady set by the controller,
+	// and WorkerRegistered, Syncing and Degraded set by the manager
+	//+listType=map
+	//+listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// VolumeUsage returns the usage in percent of the file system of the job, 0 if the worker has not reported it
+func (in *JobStatus) VolumeUsage() int {
+	if in.VolumeCapacity == 0 {
+		return 0
+	}
+	return int(in.VolumeUsed * 100 / in.VolumeCapacity)
+}
+
+// CacheHitRatio returns the ratio of the requests served from the cache of a proxy job
+func (in *JobStatus) CacheHitRatio() float64 {
+	if in.CacheHits+in.CacheMisses == 0 {
+		return 0
+	}
+	return float64(in.CacheHits) / float64(in.CacheHits+in.CacheMisses)
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.status`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="DeploymentReady")].status`
+//+kubebuilder:printcolumn:name="Volume",type=string,JSONPath=`.status.conditions[?(@.type=="VolumeBound")].status`
+//+kubebuilder:printcolumn:name="Worker",type=string,JSONPath=`.status.conditions[?(@.type=="WorkerRegistered")].status`
+//+kubebuilder:printcolumn:name="Degraded",type=string,JSONPath=`.status.conditions[?(@.type=="Degraded")].reason`
+//+kubebuilder:printcolumn:name="Ingress",type=string,JSONPath=`.status.conditions[?(@.type=="IngressReady")].status`,priority=1
+//+kubebuilder:printcolumn:name="Generation",type=integer,JSONPath=`.status.observedGeneration`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Job is the Schema for the jobs API
 type Job struct {
@@ -134,6 +336,22 @@ type JobList struct {
 	Items           []Job `json:"items"`
 }
 
+// PublicPaths returns the paths the directory service of the job is served at
+func (in *Job) PublicPaths() []string {
+	if len(in.Spec.Ingress.Paths) > 0 {
+		return in.Spec.Ingress.Paths
+	}
+	return []string{"/" + in.Name}
+}
+
+// PublicUrl returns the url advertised for the job, which is Config.Url or else its first public path
+func (in *Job) PublicUrl() string {
+	if in.Spec.Config.Url != "" {
+		return in.Spec.Config.Url
+	}
+	return in.PublicPaths()[0]
+}
+
 func init() {
 	SchemeBuilder.Register(&Job{}, &JobList{})
 }
@@ -0,0 +1,239 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// The documented defaults of jobs
+const (
+	DefaultProvider   = "rsync"
+	DefaultConcurrent = 3
+	DefaultInterval   = 1440
+	DefaultRetry      = 2
+	DefaultVolumeSize = "50Gi"
+)
+
+// Providers are the sync providers of the worker
+var Providers = []string{"command", "rsync", "two-stage-rsync"}
+
+// Stage1Profiles are the profiles of the first stage of the two-stage-rsync provider, the worker holds their excludes
+var Stage1Profiles = []string{"debian", "debian-oldstyle"}
+
+//+kubebuilder:object:generate=false
+
+// jobWebhook defaults and validates jobs, merged with the JobTemplate they refer to like the controller does
+type jobWebhook struct {
+	client client.Reader
+}
+
+// SetupWebhookWithManager registers the defaulting and validating webhooks of jobs
+func (in *Job) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	w := &jobWebhook{client: mgr.GetClient()}
+	return ctrl.NewWebhookManagedBy(mgr).For(in).WithDefaulter(w).WithValidator(w).Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-mirror-redrock-team-v1beta1-job,mutating=true,failurePolicy=fail,sideEffects=None,groups=mirror.redrock.team,resources=jobs,verbs=create;update,versions=v1beta1,name=mjob.kb.io,admissionReviewVersions=v1
+
+var _ webhook.CustomDefaulter = &jobWebhook{}
+
+// Default sets the documented defaults of a job. Jobs referring to a template are left alone,
+// as a default set in the job would take precedence over the value of the template
+func (w *jobWebhook) Default(_ context.Context, obj runtime.Object) error {
+	job, ok := obj.(*Job)
+	if !ok {
+		return fmt.Errorf("expected a Job but got %T", obj)
+	}
+	if job.Spec.Template == "" && job.DeletionTimestamp.IsZero() {
+		job.Spec.SetDefaults()
+	}
+	return nil
+}
+
+// SetDefaults sets the documented defaults of the fields not set in a job spec
+func (in *JobSpec) SetDefaults() {
+	c := &in.Config
+	if c.Type == "" {
+		c.Type = Mirror
+	}
+	if c.Type == External {
+		return
+	}
+	if c.Type != Proxy {
+		if c.Provider == "" {
+			c.Provider = DefaultProvider
+		}
+		if c.Concurrent == 0 {
+			c.Concurrent = DefaultConcurrent
+		}
+		if c.Interval == 0 {
+			c.Interval = DefaultInterval
+		}
+		if c.Retry == 0 {
+			c.Retry = DefaultRetry
+		}
+		if in.Deploy.SyncMode == "" {
+			in.Deploy.SyncMode = WorkerSync
+		}
+	}
+	// the size of a job on a shared volume is its quota, which is unlimited if not set
+	if in.Volume.Size == "" && !in.Volume.Shared() {
+		in.Volume.Size = DefaultVolumeSize
+	}
+	if in.Volume.ReclaimPolicy == "" {
+		in.Volume.ReclaimPolicy = ReclaimDelete
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-mirror-redrock-team-v1beta1-job,mutating=false,failurePolicy=fail,sideEffects=None,groups=mirror.redrock.team,resources=jobs,verbs=create;update,versions=v1beta1,name=vjob.kb.io,admissionReviewVersions=v1
+
+var _ webhook.CustomValidator = &jobWebhook{}
+
+// ValidateCreate rejects a job which would fail the worker or the controller
+func (w *jobWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	job, ok := obj.(*Job)
+	if !ok {
+		return nil, fmt.Errorf("expected a Job but got %T", obj)
+	}
+	return w.validate(ctx, job)
+}
+
+// ValidateUpdate rejects a job which would fail the worker or the controller, except while it is deleted
+// so its finalizers can always be removed
+func (w *jobWebhook) ValidateUpdate(ctx context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	job, ok := newObj.(*Job)
+	if !ok {
+		return nil, fmt.Errorf("expected a Job but got %T", newObj)
+	}
+	if !job.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+	return w.validate(ctx, job)
+}
+
+// ValidateDelete accepts every deletion
+func (w *jobWebhook) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validate checks a job merged with its template. A template not created yet only leaves the fields
+// it may set unchecked, so a job and its template can be applied in any order
+func (w *jobWebhook) validate(ctx context.Context, job *Job) (admission.Warnings, error) {
+	var warnings admission.Warnings
+	spec, complete := &job.Spec, true
+	if job.Spec.Template != "" {
+		tpl := new(JobTemplate)
+		err := w.client.Get(ctx, client.ObjectKey{Name: job.Spec.Template, Namespace: job.Namespace}, tpl)
+		switch {
+		case apierrors.IsNotFound(err):
+			complete = false
+			warnings = append(warnings, fmt.Sprintf("template %s not found, the fields it may set are not checked", job.Spec.Template))
+		case err != nil:
+			return nil, fmt.Errorf("failed to get template %s: %w", job.Spec.Template, err)
+		default:
+			if spec, err = tpl.Spec.Merge(&job.Spec); err != nil {
+				return nil, fmt.Errorf("failed to merge template %s: %w", job.Spec.Template, err)
+			}
+		}
+	}
+	if errs := validateJobSpec(spec, complete); len(errs) > 0 {
+		return warnings, apierrors.NewInvalid(GroupVersion.WithKind("Job").GroupKind(), job.Name, errs)
+	}
+	return warnings, nil
+}
+
+// Validate returns the errors of a job spec, merged with its template, which would fail the worker or the controller
+func (in *JobSpec) Validate() field.ErrorList {
+	return validateJobSpec(in, true)
+}
+
+// validateJobSpec checks a job spec, the fields a missing template may set only if it is complete
+func validateJobSpec(spec *JobSpec, complete bool) field.ErrorList {
+	var errs field.ErrorList
+	config := field.NewPath("spec", "config")
+	c := &spec.Config
+	switch c.Type {
+	case "", Mirror, Proxy, Git:
+	case External:
+		// nothing is deployed for external jobs
+		return nil
+	default:
+		errs = append(errs, field.NotSupported(config.Child("type"), c.Type, []MirrorType{Mirror, Proxy, Git, External}))
+	}
+
+	if c.Upstream == "" && complete {
+		errs = append(errs, field.Required(config.Child("upstream"), "set it in the job or its template"))
+	}
+	if c.Type != Proxy && (c.Provider != "" || complete) {
+		provider := c.Provider
+		if provider == "" {
+			provider = DefaultProvider
+		}
+		switch {
+		case !slices.Contains(Providers, provider):
+			errs = append(errs, field.NotSupported(config.Child("provider"), provider, Providers))
+		// the upstream of a git job is a repository, which never had to end with /
+		case provider != "command" && c.Type != Git && c.Upstream != "" && !strings.HasSuffix(c.Upstream, "/"):
+			errs = append(errs, field.Invalid(config.Child("upstream"), c.Upstream, "the upstream of an rsync job must end with /"))
+		}
+		if (provider == "two-stage-rsync" || c.Stage1Profile != "") && !slices.Contains(Stage1Profiles, c.Stage1Profile) {
+			errs = append(errs, field.NotSupported(config.Child("stage1Profile"), c.Stage1Profile, Stage1Profiles))
+		}
+	}
+	for _, p := range []struct{ name, pattern string }{
+		{"failOnMatch", c.FailOnMatch},
+		{"sizePattern", c.SizePattern},
+	} {
+		if _, err := regexp.Compile(p.pattern); err != nil {
+			errs = append(errs, field.Invalid(config.Child(p.name), p.pattern, err.Error()))
+		}
+	}
+	ipv4, _ := strconv.ParseBool(c.IPv4Only)
+	ipv6, _ := strconv.ParseBool(c.IPv6Only)
+	if ipv4 && ipv6 {
+		errs = append(errs, field.Invalid(config.Child("IPv6Only"), c.IPv6Only, "IPv4Only and IPv6Only can not both be set"))
+	}
+
+	volume := field.NewPath("spec", "volume")
+	if spec.Volume.Size != "" {
+		if _, err := resource.ParseQuantity(spec.Volume.Size); err != nil {
+			errs = append(errs, field.Invalid(volume.Child("size"), spec.Volume.Size, err.Error()))
+		}
+	}
+	if e := spec.Volume.AutoExpand; e != nil {
+		if _, err := resource.ParseQuantity(e.MaxSize); err != nil {
+			errs = append(errs, field.Invalid(volume.Child("autoExpand", "maxSize"), e.MaxSize, err.Error()))
+		}
+	}
+	return errs
+}
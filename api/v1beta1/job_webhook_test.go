@@ -0,0 +1,162 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestJobDefaults(t *testing.T) {
+	w := &jobWebhook{}
+	job := &Job{Spec: JobSpec{Config: JobConfig{Upstream: "rsync://a/debian/", Interval: 60}}}
+	if err := w.Default(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+	c := job.Spec.Config
+	if c.Type != Mirror || c.Provider != DefaultProvider || c.Concurrent != DefaultConcurrent || c.Interval != 60 || c.Retry != DefaultRetry {
+		t.Errorf("unexpected config %+v", c)
+	}
+	if job.Spec.Volume.Size != DefaultVolumeSize || job.Spec.Volume.ReclaimPolicy != ReclaimDelete || job.Spec.Deploy.SyncMode != WorkerSync {
+		t.Errorf("unexpected defaults %+v %+v", job.Spec.Volume, job.Spec.Deploy)
+	}
+
+	// the size of a job on a shared volume is its quota
+	job = &Job{Spec: JobSpec{Volume: PVConfig{SharedClaim: "pool"}}}
+	job.Spec.SetDefaults()
+	if job.Spec.Volume.Size != "" {
+		t.Errorf("unexpected quota %s", job.Spec.Volume.Size)
+	}
+
+	job = &Job{Spec: JobSpec{Template: "rsync"}}
+	if err := w.Default(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+	if job.Spec.Config.Provider != "" || job.Spec.Volume.Size != "" {
+		t.Errorf("the defaults would override the template %+v", job.Spec)
+	}
+}
+
+func TestJobValidation(t *testing.T) {
+	for name, c := range map[string]struct {
+		spec  JobSpec
+		field string
+	}{
+		"valid":             {spec: JobSpec{Config: JobConfig{Upstream: "rsync://a/debian/"}}},
+		"external":          {spec: JobSpec{Config: JobConfig{Type: External}}},
+		"command":           {spec: JobSpec{Config: JobConfig{Provider: "command", Upstream: "https://a/debian"}}},
+		"proxy":             {spec: JobSpec{Config: JobConfig{Type: Proxy, Upstream: "https://pypi.org"}}},
+		"no upstream":       {field: "spec.config.upstream"},
+		"no trailing slash": {spec: JobSpec{Config: JobConfig{Upstream: "rsync://a/debian"}}, field: "spec.config.upstream"},
+		"unknown type":      {spec: JobSpec{Config: JobConfig{Type: "mirrors", Upstream: "rsync://a/debian/"}}, field: "spec.config.type"},
+		"unknown provider":  {spec: JobSpec{Config: JobConfig{Provider: "ftp", Upstream: "ftp://a/debian/"}}, field: "spec.config.provider"},
+		"no profile": {
+			spec:  JobSpec{Config: JobConfig{Provider: "two-stage-rsync", Upstream: "rsync://a/debian/"}},
+			field: "spec.config.stage1Profile",
+		},
+		"unknown profile": {
+			spec:  JobSpec{Config: JobConfig{Upstream: "rsync://a/debian/", Stage1Profile: "ubuntu"}},
+			field: "spec.config.stage1Profile",
+		},
+		"bad failOnMatch": {
+			spec:  JobSpec{Config: JobConfig{Provider: "command", Upstream: "a", FailOnMatch: "(error"}},
+			field: "spec.config.failOnMatch",
+		},
+		"bad sizePattern": {
+			spec:  JobSpec{Config: JobConfig{Provider: "command", Upstream: "a", SizePattern: "[size"}},
+			field: "spec.config.sizePattern",
+		},
+		"both ip versions": {
+			spec:  JobSpec{Config: JobConfig{Upstream: "rsync://a/debian/", IPv4Only: "true", IPv6Only: "true"}},
+			field: "spec.config.IPv6Only",
+		},
+		"bad size": {
+			spec:  JobSpec{Config: JobConfig{Upstream: "rsync://a/debian/"}, Volume: PVConfig{Size: "1 TB"}},
+			field: "spec.volume.size",
+		},
+		"bad maxSize": {
+			spec:  JobSpec{Config: JobConfig{Upstream: "rsync://a/debian/"}, Volume: PVConfig{AutoExpand: &VolumeExpansion{MaxSize: "big"}}},
+			field: "spec.volume.autoExpand.maxSize",
+		},
+	} {
+		errs := c.spec.Validate()
+		switch {
+		case c.field == "" && len(errs) > 0:
+			t.Errorf("%s: unexpected errors %v", name, errs)
+		case c.field != "" && (len(errs) != 1 || errs[0].Field != c.field):
+			t.Errorf("%s: expected an error of %s, got %v", name, c.field, errs)
+		}
+	}
+}
+
+func TestGitJobValidation(t *testing.T) {
+	// a git job as accepted before the webhooks, with its defaults applied
+	w := &jobWebhook{}
+	job := &Job{Spec: JobSpec{Config: JobConfig{Type: Git, Upstream: "https://git.kernel.org/pub/scm/git/git.git"}}}
+	if err := w.Default(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+	if errs := job.Spec.Validate(); len(errs) > 0 {
+		t.Errorf("unexpected errors %v", errs)
+	}
+}
+
+func TestJobValidationTemplate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	tpl := &JobTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "debian", Namespace: "mirror"},
+		Spec:       JobTemplateSpec{Config: JobConfig{Provider: "two-stage-rsync", Stage1Profile: "debian"}},
+	}
+	w := &jobWebhook{client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(tpl).Build()}
+	ctx := context.Background()
+
+	job := &Job{ObjectMeta: metav1.ObjectMeta{Name: "debian", Namespace: "mirror"}}
+	job.Spec.Template = "debian"
+	job.Spec.Config.Upstream = "rsync://a/debian/"
+	if _, err := w.ValidateCreate(ctx, job); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	job.Spec.Config.Upstream = "rsync://a/debian"
+	if _, err := w.ValidateCreate(ctx, job); err == nil || !strings.Contains(err.Error(), "spec.config.upstream") {
+		t.Errorf("expected the upstream to be rejected, got %v", err)
+	}
+
+	// the template may be applied after the job
+	job.Spec.Template = "ubuntu"
+	job.Spec.Config.Upstream = ""
+	warnings, err := w.ValidateCreate(ctx, job)
+	if err != nil || len(warnings) != 1 {
+		t.Errorf("expected a warning, got %v %v", warnings, err)
+	}
+
+	// jobs being deleted can always drop their finalizers
+	now := metav1.Now()
+	job.DeletionTimestamp = &now
+	job.Spec.Template = ""
+	if _, err := w.ValidateUpdate(ctx, job, job); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
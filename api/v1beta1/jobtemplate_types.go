@@ -0,0 +1,80 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package v1beta1
+
+import (
+	"encoding/json"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// JobTemplateSpec defines the defaults shared by the jobs referencing the template,
+// values set in a job take precedence over the template ones
+type JobTemplateSpec struct {
+	Config  JobConfig     `json:"config,omitempty"`
+	Deploy  JobDeploy     `json:"deploy,omitempty"`
+	Volume  PVConfig      `json:"volume,omitempty"`
+	Ingress IngressConfig `json:"ingress,omitempty"`
+	Proxy   ProxyConfig   `json:"proxy,omitempty"`
+}
+
+// Merge merges spec over the template as a json merge patch, so objects are merged key by key
+// while strings, numbers and lists set in spec replace the template ones
+func (in *JobTemplateSpec) Merge(spec *JobSpec) (*JobSpec, error) {
+	base, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := jsonpatch.MergePatch(base, patch)
+	if err != nil {
+		return nil, err
+	}
+	out := new(JobSpec)
+	if err := json.Unmarshal(merged, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+//+kubebuilder:object:root=true
+
+// JobTemplate is the Schema for the jobtemplates API
+type JobTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec JobTemplateSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// JobTemplateList contains a list of JobTemplate
+type JobTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []JobTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&JobTemplate{}, &JobTemplateList{})
+}
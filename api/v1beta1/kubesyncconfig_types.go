@@ -0,0 +1,77 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// KubesyncConfigName is the name of the KubesyncConfig read by the controller
+const KubesyncConfigName = "kubesync"
+
+// KubesyncConfigSpec defines the controller config, fields left empty keep the value
+// from the environment of the controller
+type KubesyncConfigSpec struct {
+	ManagerImage string `json:"managerImage,omitempty"`
+	WorkerImage  string `json:"workerImage,omitempty"`
+	PullPolicy   string `json:"pullPolicy,omitempty"`
+	PullSecret   string `json:"pullSecret,omitempty"`
+	StorageClass string `json:"storageClass,omitempty"`
+	AccessMode   string `json:"accessMode,omitempty"`
+	FrontMode    string `json:"frontMode,omitempty"`
+	FrontImage   string `json:"frontImage,omitempty"`
+	RsyncImage   string `json:"rsyncImage,omitempty"`
+	FrontCmd     string `json:"frontCmd,omitempty"`
+	// FrontConfig is the caddy json config of the directory service
+	FrontConfig string `json:"frontConfig,omitempty"`
+	RsyncCmd    string `json:"rsyncCmd,omitempty"`
+	FrontHost   string `json:"frontHost,omitempty"`
+	FrontTLS    string `json:"frontTLS,omitempty"`
+	FrontClass  string `json:"frontClass,omitempty"`
+	// FrontGateway is the namespace/name of the Gateway that HTTPRoutes attach to by default,
+	// setting it generates HTTPRoutes instead of Ingresses
+	FrontGateway string `json:"frontGateway,omitempty"`
+	// FrontAnnotations are merged over the ingress annotations from the environment
+	FrontAnnotations map[string]string `json:"frontAnnotations,omitempty"`
+	EnableMetric     *bool             `json:"enableMetric,omitempty"`
+	Debug            *bool             `json:"debug,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// KubesyncConfig is the Schema for the kubesyncconfigs API, only the one named kubesync is used
+type KubesyncConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec KubesyncConfigSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// KubesyncConfigList contains a list of KubesyncConfig
+type KubesyncConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KubesyncConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KubesyncConfig{}, &KubesyncConfigList{})
+}
@@ -32,6 +32,19 @@ type DeployConfig struct {
 	Tolerations      []corev1.Toleration           `json:"tolerations,omitempty"`
 	CPULimit         string                        `json:"cpuLimit,omitempty"`
 	MemoryLimit      string                        `json:"memLimit,omitempty"`
+	CPURequest       string                        `json:"cpuRequest,omitempty"`
+	MemoryRequest    string                        `json:"memRequest,omitempty"`
+	StorageLimit     string                        `json:"ephemeralStorageLimit,omitempty"`
+	StorageRequest   string                        `json:"ephemeralStorageRequest,omitempty"`
+	// SecurityContext is set on every container of the pod
+	SecurityContext    *corev1.SecurityContext    `json:"securityContext,omitempty"`
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+	PriorityClassName  string                     `json:"priorityClassName,omitempty"`
+	RuntimeClassName   *string                    `json:"runtimeClassName,omitempty"`
+	// Volumes are added to the pod, to be mounted by VolumeMounts
+	Volumes []corev1.Volume `json:"volumes,omitempty"`
+	// VolumeMounts are added to the worker container of a job, or the manager container
+	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty"`
 }
 
 type DeployType string
@@ -49,11 +62,48 @@ const (
 	DeployFailed    DeployPhase = "Failed"
 )
 
+// GatewayRef refers to a Gateway an HTTPRoute attaches to
+type GatewayRef struct {
+	Name string `json:"name"`
+	// Namespace default the namespace of the route
+	Namespace   string `json:"namespace,omitempty"`
+	SectionName string `json:"sectionName,omitempty"`
+}
+
+// HeaderMatch matches a request header, Type is Exact (default) or RegularExpression
+type HeaderMatch struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Type  string `json:"type,omitempty"`
+}
+
+// HTTPRouteConfig configures the Gateway API HTTPRoute generated instead of the Ingress
+type HTTPRouteConfig struct {
+	// ParentRefs default the gateway of the controller config
+	ParentRefs []GatewayRef `json:"parentRefs,omitempty"`
+	// Hostnames default the ingress host
+	Hostnames []string `json:"hostnames,omitempty"`
+	// Paths replace the paths routed by default
+	Paths []string `json:"paths,omitempty"`
+	// Headers all have to match for a request to be routed
+	Headers []HeaderMatch `json:"headers,omitempty"`
+	// Timeout and BackendTimeout are durations like 30s
+	Timeout        string `json:"timeout,omitempty"`
+	BackendTimeout string `json:"backendTimeout,omitempty"`
+}
+
 type IngressConfig struct {
-	IngressClass string            `json:"ingressClass,omitempty"`
-	TLSSecret    string            `json:"TLSSecret,omitempty"`
-	Host         string            `json:"host,omitempty"`
-	Annotations  map[string]string `json:"annotations,omitempty"`
+	IngressClass string `json:"ingressClass,omitempty"`
+	TLSSecret    string `json:"TLSSecret,omitempty"`
+	Host         string `json:"host,omitempty"`
+	// Hosts are served besides Host
+	Hosts []string `json:"hosts,omitempty"`
+	// Paths are the public paths of a job, default /{name}, the first one is advertised in its url.
+	// Managers always serve their api paths.
+	Paths       []string          `json:"paths,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// HTTPRoute generates an HTTPRoute instead of the Ingress, as does a gateway in the controller config
+	HTTPRoute *HTTPRouteConfig `json:"httpRoute,omitempty"`
 }
 
 // ManagerSpec defines the desired state of Manager
@@ -66,10 +116,21 @@ type ManagerSpec struct {
 // ManagerStatus defines the observed state of Manager
 type ManagerStatus struct {
 	Phase DeployPhase `json:"phase"`
+	// ObservedGeneration is the generation of the manager the controller last deployed
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions are DeploymentReady and IngressReady
+	//+listType=map
+	//+listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="DeploymentReady")].status`
+//+kubebuilder:printcolumn:name="Ingress",type=string,JSONPath=`.status.conditions[?(@.type=="IngressReady")].status`
+//+kubebuilder:printcolumn:name="Generation",type=integer,JSONPath=`.status.observedGeneration`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Manager is the Schema for the managers API
 type Manager struct {
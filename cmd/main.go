@@ -29,15 +29,20 @@ import (
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	mirrorv1beta1 "github.com/CQUPTMirror/kubesync/api/v1beta1"
+	"github.com/CQUPTMirror/kubesync/internal"
 	"github.com/CQUPTMirror/kubesync/internal/controller"
 	//+kubebuilder:scaffold:imports
 )
@@ -71,8 +76,20 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	// only token Secrets are cached, the controller owns no other Secrets
+	tokenSelector, err := labels.Parse(internal.TokenLabel)
+	if err != nil {
+		setupLog.Error(err, "unable to parse token selector")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:                 scheme,
+		Scheme: scheme,
+		Cache: cache.Options{
+			ByObject: map[client.Object]cache.ByObject{
+				&corev1.Secret{}: {Label: tokenSelector},
+			},
+		},
 		Metrics:                metricsserver.Options{BindAddress: metricsAddr},
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
@@ -102,9 +119,10 @@ func main() {
 	}
 
 	if err = (&controller.JobReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-		Config: &config,
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Config:   &config,
+		Recorder: mgr.GetEventRecorderFor("kubesync-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Job")
 		os.Exit(1)
@@ -124,6 +142,13 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "Announcement")
 		os.Exit(1)
 	}
+	// the webhooks need a serving certificate, see config/webhook
+	if os.Getenv("ENABLE_WEBHOOKS") != "" {
+		if err = (&mirrorv1beta1.Job{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Job")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -143,7 +168,7 @@ func main() {
 }
 
 func getConfig() controller.Config {
-	// TODO: replace ugly env way to config file
+	// the KubesyncConfig named kubesync overrides these values without a restart
 	annString := os.Getenv("FRONT_ANN")
 	annItems := make(map[string]string)
 	if annString != "" {
@@ -181,6 +206,7 @@ func getConfig() controller.Config {
 		FrontHost:    os.Getenv("FRONT_HOST"),
 		FrontTLS:     os.Getenv("FRONT_TLS"),
 		FrontClass:   os.Getenv("FRONT_CLASS"),
+		FrontGateway: os.Getenv("FRONT_GATEWAY"),
 		FrontAnn:     annItems,
 		EnableMetric: enableMetric,
 		Debug:        debug,
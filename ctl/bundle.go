@@ -0,0 +1,120 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package ctl
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/urfave/cli"
+	"sigs.k8s.io/yaml"
+
+	"github.com/CQUPTMirror/kubesync/internal"
+)
+
+func exportBundle(c *cli.Context) error {
+	bundle, err := newClient(c).ExportBundle(context.Background())
+	if err != nil {
+		return err
+	}
+
+	format := c.String("format")
+	if format != OutputYAML && format != OutputJSON {
+		return cli.NewExitError(fmt.Sprintf("unknown bundle format %s, should be yaml or json", format), 1)
+	}
+	w := c.App.Writer
+	if name := c.String("file"); name != "" {
+		f, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	p, err := newPrinter(w, format)
+	if err != nil {
+		return err
+	}
+	return p.print(bundle, nil, nil)
+}
+
+func importBundle(c *cli.Context) error {
+	a, err := args(c, 1)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(a[0])
+	if err != nil {
+		return err
+	}
+	bundle := new(internal.Bundle)
+	if err := yaml.UnmarshalStrict(data, bundle); err != nil {
+		return fmt.Errorf("failed to parse %s: %s", a[0], err.Error())
+	}
+	p, err := newOutput(c)
+	if err != nil {
+		return err
+	}
+	dryRun := c.Bool("dry-run")
+	result, err := newClient(c).ImportBundle(context.Background(), bundle, dryRun, c.String("conflict"))
+	if err != nil {
+		return err
+	}
+
+	if p.format != OutputTable {
+		if err := p.print(result, nil, nil); err != nil {
+			return err
+		}
+	} else {
+		var rows [][]string
+		for _, ch := range result.Changes {
+			rows = append(rows, []string{ch.Kind, ch.Name, ch.Action, strconv.Itoa(len(ch.Diff)), orDash(ch.Error)})
+		}
+		if err := p.print(result, []string{"KIND", "NAME", "ACTION", "CHANGED FIELDS", "ERROR"}, rows); err != nil {
+			return err
+		}
+		// the fields of new objects are not listed, they are all in the bundle
+		for _, ch := range result.Changes {
+			if ch.Action == "create" || len(ch.Diff) == 0 {
+				continue
+			}
+			fmt.Fprintf(c.App.Writer, "\n%s %s (%s):\n", ch.Kind, ch.Name, ch.Action)
+			fields := make([]string, 0, len(ch.Diff))
+			for k := range ch.Diff {
+				fields = append(fields, k)
+			}
+			sort.Strings(fields)
+			for _, k := range fields {
+				fmt.Fprintf(c.App.Writer, "  %s: %v -> %v\n", k, ch.Diff[k].Old, ch.Diff[k].New)
+			}
+		}
+	}
+
+	if !dryRun && !result.Applied {
+		return cli.NewExitError("nothing imported because of conflicts, use --conflict skip or overwrite", 1)
+	}
+	for _, ch := range result.Changes {
+		if ch.Error != "" {
+			return cli.NewExitError("some objects failed to import", 1)
+		}
+	}
+	return nil
+}
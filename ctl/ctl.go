@@ -0,0 +1,588 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package ctl implements kubesyncctl, the command line client of the manager api
+package ctl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+	"github.com/CQUPTMirror/kubesync/internal"
+	"github.com/CQUPTMirror/kubesync/manager/client"
+)
+
+// NewApp returns the kubesyncctl application
+func NewApp() *cli.App {
+	app := cli.NewApp()
+	app.Name = "kubesyncctl"
+	app.Usage = "control kubesync mirror jobs through the manager api"
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "manager, m",
+			Value:  "http://localhost:3000",
+			Usage:  "The manager api address",
+			EnvVar: "KUBESYNC_MANAGER",
+		},
+		cli.StringFlag{
+			Name:   "token",
+			Usage:  "The bearer token sent to the manager",
+			EnvVar: "KUBESYNC_TOKEN",
+		},
+		cli.StringFlag{
+			Name:  "output, o",
+			Value: OutputTable,
+			Usage: "Output format, one of table, json, yaml",
+		},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name:   "list",
+			Usage:  "List all jobs",
+			Action: listJobs,
+		},
+		{
+			Name:      "status",
+			Usage:     "Show the status of a job",
+			ArgsUsage: "<job>",
+			Action:    jobStatus,
+		},
+		{
+			Name:      "start",
+			Usage:     "Start syncing a job now",
+			ArgsUsage: "<job>",
+			Description: "Starts a sync at once, a paused job is resumed and will be scheduled again.\n" +
+				"   With --force the sync starts even if the concurrent limit of the worker is reached.",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "force, f",
+					Usage: "Ignore the concurrent limit of the worker",
+				},
+			},
+			Action: sendCmd(internal.CmdStart),
+		},
+		{
+			Name:      "stop",
+			Usage:     "Stop the running sync and pause the job",
+			ArgsUsage: "<job>",
+			Description: "Kills the running sync and marks the job as paused. A paused job is not\n" +
+				"   scheduled again until it is started. Use disable to take a job offline instead.",
+			Action: sendCmd(internal.CmdStop),
+		},
+		{
+			Name:        "restart",
+			Usage:       "Kill the running sync and start it again",
+			ArgsUsage:   "<job>",
+			Description: "Kills the running sync and starts a new one at once, the schedule is kept.",
+			Action:      sendCmd(internal.CmdRestart),
+		},
+		{
+			Name:      "enable",
+			Usage:     "Enable a disabled job",
+			ArgsUsage: "<job>",
+			Action:    enableJob(true),
+		},
+		{
+			Name:        "disable",
+			Usage:       "Disable a job",
+			ArgsUsage:   "<job>",
+			Description: "Marks the job as disabled in the manager until it is enabled again.",
+			Action:      enableJob(false),
+		},
+		{
+			Name:      "logs",
+			Usage:     "Print the latest sync log of a job",
+			ArgsUsage: "<job>",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "follow, f",
+					Usage: "Keep polling the log and print new output",
+				},
+				cli.DurationFlag{
+					Name:  "interval",
+					Value: 2 * time.Second,
+					Usage: "Poll interval of --follow",
+				},
+			},
+			Action: jobLogs,
+		},
+		{
+			Name:      "history",
+			Usage:     "Show the recent status changes of a job",
+			ArgsUsage: "<job>",
+			Action:    jobHistory,
+		},
+		{
+			Name:      "set-size",
+			Usage:     "Set the mirror size of a job, e.g. 1.5T",
+			ArgsUsage: "<job> <size>",
+			Action:    setSize,
+		},
+		{
+			Name:      "import",
+			Usage:     "Import the mirrors of a tunasync worker.conf as jobs",
+			ArgsUsage: "<worker.conf>",
+			Description: "Sends the config, with the files of include_mirrors appended, to the manager which creates\n" +
+				"   a job for every mirror that does not exist yet. Fields which can not be mapped are reported.\n" +
+				"   With --local the jobs are printed as manifests instead, e.g. for kubectl apply -f -.",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "Only report what would be created",
+				},
+				cli.BoolFlag{
+					Name:  "local",
+					Usage: "Translate the config without the manager and print the jobs as yaml",
+				},
+			},
+			Action: importTunasync,
+		},
+		{
+			Name:  "bundle",
+			Usage: "Export or import the specs of all jobs, announcements and files",
+			Subcommands: []cli.Command{
+				{
+					Name:  "export",
+					Usage: "Export the site as a bundle",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "file, f",
+							Usage: "Write the bundle to the file instead of stdout",
+						},
+						cli.StringFlag{
+							Name:  "format",
+							Value: OutputYAML,
+							Usage: "Format of the bundle, yaml or json",
+						},
+					},
+					Action: exportBundle,
+				},
+				{
+					Name:      "import",
+					Usage:     "Import a bundle in yaml or json",
+					ArgsUsage: "<file>",
+					Description: "Creates the objects missing from the site. Objects whose spec differs from the bundle are\n" +
+						"   conflicts, by default nothing is imported if there is any, --conflict skip leaves them\n" +
+						"   as they are and --conflict overwrite replaces their spec. Use --dry-run to see the diff.",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "dry-run",
+							Usage: "Only show what would change",
+						},
+						cli.StringFlag{
+							Name:  "conflict",
+							Value: "fail",
+							Usage: "How to handle objects which differ, one of fail, skip, overwrite",
+						},
+					},
+					Action: importBundle,
+				},
+			},
+		},
+		{
+			Name:  "announce",
+			Usage: "Manage announcements",
+			Subcommands: []cli.Command{
+				{
+					Name:   "list",
+					Usage:  "List all announcements",
+					Action: listAnnouncements,
+				},
+				{
+					Name:      "create",
+					Usage:     "Create an announcement",
+					ArgsUsage: "<id>",
+					Flags:     announcementFlags,
+					Action:    applyAnnouncement(true),
+				},
+				{
+					Name:      "edit",
+					Usage:     "Edit the given fields of an announcement",
+					ArgsUsage: "<id>",
+					Flags:     announcementFlags,
+					Action:    applyAnnouncement(false),
+				},
+				{
+					Name:      "delete",
+					Usage:     "Delete an announcement",
+					ArgsUsage: "<id>",
+					Action:    deleteAnnouncement,
+				},
+			},
+		},
+		{
+			Name:  "file",
+			Usage: "Manage the file lists of jobs",
+			Subcommands: []cli.Command{
+				{
+					Name:      "push",
+					Usage:     "Scan directories and push the file list of a job",
+					ArgsUsage: "<job> <dir>...",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "type",
+							Value: string(v1beta1.OS),
+							Usage: "File type, os or app",
+						},
+						cli.StringFlag{
+							Name:  "alias",
+							Usage: "Display name of the file list",
+						},
+						cli.StringSliceFlag{
+							Name:  "ext",
+							Usage: "File extensions to include (default: .iso)",
+						},
+						cli.StringFlag{
+							Name:  "root",
+							Value: "/data",
+							Usage: "Prefix trimmed from the pushed paths",
+						},
+					},
+					Action: pushFiles,
+				},
+			},
+		},
+	}
+	return app
+}
+
+var announcementFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "title",
+		Usage: "Title of the announcement",
+	},
+	cli.StringFlag{
+		Name:  "author",
+		Usage: "Author of the announcement",
+	},
+	cli.StringFlag{
+		Name:  "content",
+		Usage: "Content of the announcement, - reads it from stdin",
+	},
+}
+
+func newClient(c *cli.Context) *client.Client {
+	return client.New(c.GlobalString("manager"), client.WithToken(c.GlobalString("token")))
+}
+
+func newOutput(c *cli.Context) (*printer, error) {
+	return newPrinter(c.App.Writer, c.GlobalString("output"))
+}
+
+// args checks the number of positional arguments
+func args(c *cli.Context, n int) ([]string, error) {
+	if c.NArg() < n {
+		return nil, cli.NewExitError(fmt.Sprintf("usage: %s %s %s", c.App.Name, c.Command.Name, c.Command.ArgsUsage), 1)
+	}
+	return c.Args(), nil
+}
+
+func listJobs(c *cli.Context) error {
+	p, err := newOutput(c)
+	if err != nil {
+		return err
+	}
+	jobs, err := newClient(c).ListJobs(context.Background())
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, j := range jobs {
+		rows = append(rows, []string{
+			j.ID, string(j.Status), formatTime(j.LastUpdate), formatTime(j.Scheduled), orDash(j.SizeStr), orDash(j.Upstream),
+		})
+	}
+	return p.print(jobs, []string{"ID", "STATUS", "LAST UPDATE", "NEXT SCHEDULE", "SIZE", "UPSTREAM"}, rows)
+}
+
+func jobStatus(c *cli.Context) error {
+	a, err := args(c, 1)
+	if err != nil {
+		return err
+	}
+	p, err := newOutput(c)
+	if err != nil {
+		return err
+	}
+	status, err := newClient(c).GetJob(context.Background(), a[0])
+	if err != nil {
+		return err
+	}
+	return p.print(status, []string{"FIELD", "VALUE"}, [][]string{
+		{"Status", string(status.Status)},
+		{"Upstream", orDash(status.Upstream)},
+		{"Size", orDash(internal.ParseSize(status.Size))},
+		{"Last update", formatTime(status.LastUpdate)},
+		{"Last started", formatTime(status.LastStarted)},
+		{"Last ended", formatTime(status.LastEnded)},
+		{"Next schedule", formatTime(status.Scheduled)},
+		{"Last online", formatTime(status.LastOnline)},
+		{"Error", orDash(status.ErrorMsg)},
+	})
+}
+
+func sendCmd(verb internal.CmdVerb) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		a, err := args(c, 1)
+		if err != nil {
+			return err
+		}
+		cmd := internal.ClientCmd{Cmd: verb, Force: c.Bool("force")}
+		if err := newClient(c).SendCmd(context.Background(), a[0], cmd); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.App.Writer, "sent %s to %s\n", verb, a[0])
+		return nil
+	}
+}
+
+func enableJob(enable bool) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		a, err := args(c, 1)
+		if err != nil {
+			return err
+		}
+		cl := newClient(c)
+		if enable {
+			if err := cl.EnableJob(context.Background(), a[0]); err != nil {
+				return err
+			}
+			fmt.Fprintf(c.App.Writer, "%s enabled\n", a[0])
+			return nil
+		}
+		if err := cl.DisableJob(context.Background(), a[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.App.Writer, "%s disabled\n", a[0])
+		return nil
+	}
+}
+
+func jobLogs(c *cli.Context) error {
+	a, err := args(c, 1)
+	if err != nil {
+		return err
+	}
+	cl := newClient(c)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	var last string
+	for {
+		log, err := cl.GetJobLog(ctx, a[0])
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		// the worker returns the whole log of the latest sync, only print what is new
+		if strings.HasPrefix(log, last) {
+			fmt.Fprint(c.App.Writer, log[len(last):])
+		} else {
+			fmt.Fprint(c.App.Writer, log)
+		}
+		last = log
+		if !c.Bool("follow") {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(c.Duration("interval")):
+		}
+	}
+}
+
+func jobHistory(c *cli.Context) error {
+	a, err := args(c, 1)
+	if err != nil {
+		return err
+	}
+	p, err := newOutput(c)
+	if err != nil {
+		return err
+	}
+	history, err := newClient(c).GetJobHistory(context.Background(), a[0])
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, h := range history {
+		rows = append(rows, []string{
+			formatTime(h.Time), string(h.From), string(h.To), orDash(internal.ParseSize(h.Size)), orDash(h.ErrorMsg),
+		})
+	}
+	return p.print(history, []string{"TIME", "FROM", "TO", "SIZE", "ERROR"}, rows)
+}
+
+func setSize(c *cli.Context) error {
+	a, err := args(c, 2)
+	if err != nil {
+		return err
+	}
+	size, err := strconv.ParseUint(a[1], 10, 64)
+	if err != nil {
+		size = internal.ParseSizeStr(a[1])
+	}
+	if size == 0 {
+		return cli.NewExitError(fmt.Sprintf("invalid size %s", a[1]), 1)
+	}
+	if err := newClient(c).UpdateJobSize(context.Background(), a[0], size); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "size of %s set to %s\n", a[0], internal.ParseSize(size))
+	return nil
+}
+
+func listAnnouncements(c *cli.Context) error {
+	p, err := newOutput(c)
+	if err != nil {
+		return err
+	}
+	news, err := newClient(c).ListAnnouncements(context.Background())
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, n := range news {
+		rows = append(rows, []string{n.ID, n.Title, orDash(n.Author), formatTime(n.PubTime), formatTime(n.EditTime)})
+	}
+	return p.print(news, []string{"ID", "TITLE", "AUTHOR", "PUBLISHED", "EDITED"}, rows)
+}
+
+func applyAnnouncement(create bool) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		a, err := args(c, 1)
+		if err != nil {
+			return err
+		}
+		// the manager only overwrites the fields present in the body of an edit
+		spec := make(map[string]string)
+		for _, name := range []string{"title", "author", "content"} {
+			if c.IsSet(name) {
+				spec[name] = c.String(name)
+			}
+		}
+		if spec["content"] == "-" {
+			b, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+			spec["content"] = string(b)
+		}
+		if create && (spec["title"] == "" || spec["content"] == "") {
+			return cli.NewExitError("--title and --content are required", 1)
+		}
+		if !create && len(spec) == 0 {
+			return cli.NewExitError("nothing to edit", 1)
+		}
+
+		cl := newClient(c)
+		if _, err := cl.GetAnnouncement(context.Background(), a[0]); err == nil && create {
+			return cli.NewExitError(fmt.Sprintf("announcement %s already exists", a[0]), 1)
+		} else if err != nil && !create {
+			return err
+		}
+		if err := cl.ApplyAnnouncement(context.Background(), a[0], spec); err != nil {
+			return err
+		}
+		if create {
+			fmt.Fprintf(c.App.Writer, "announcement %s created\n", a[0])
+		} else {
+			fmt.Fprintf(c.App.Writer, "announcement %s updated\n", a[0])
+		}
+		return nil
+	}
+}
+
+func deleteAnnouncement(c *cli.Context) error {
+	a, err := args(c, 1)
+	if err != nil {
+		return err
+	}
+	if err := newClient(c).DeleteAnnouncement(context.Background(), a[0]); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "announcement %s deleted\n", a[0])
+	return nil
+}
+
+func pushFiles(c *cli.Context) error {
+	a, err := args(c, 2)
+	if err != nil {
+		return err
+	}
+	// a default slice value would be appended to, not replaced by, the given extensions
+	exts := c.StringSlice("ext")
+	if len(exts) == 0 {
+		exts = []string{".iso"}
+	}
+	files := make(map[string]uint64)
+	for _, dir := range a[1:] {
+		if err := scanFiles(dir, c.String("root"), exts, files); err != nil {
+			return err
+		}
+	}
+	file := internal.FileBase{Type: v1beta1.FileType(c.String("type")), Alias: c.String("alias"), Files: files}
+	if err := newClient(c).UpdateFile(context.Background(), a[0], file); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "pushed %d files of %s\n", len(files), a[0])
+	return nil
+}
+
+// scanFiles collects the sizes of the files under dir with one of the extensions,
+// hidden files and directories are skipped and root is trimmed from the paths
+func scanFiles(dir, root string, exts []string, files map[string]uint64) error {
+	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && path != dir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		for _, ext := range exts {
+			if filepath.Ext(path) == ext {
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				files[strings.TrimPrefix(path, strings.TrimSuffix(root, "/"))] = uint64(info.Size())
+				break
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,107 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package ctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListAndCmd(t *testing.T) {
+	var cmd map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /jobs":
+			_, _ = io.WriteString(w, `[{"id":"centos","status":"success","sizeStr":"1.00T"}]`)
+		case "POST /job/centos/cmd":
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = io.WriteString(w, `{"error":"authorization required"}`)
+				return
+			}
+			_ = json.NewDecoder(r.Body).Decode(&cmd)
+			_, _ = io.WriteString(w, `{"message":"ok"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		app := NewApp()
+		app.Writer = &out
+		err := app.Run(append([]string{"kubesyncctl", "-m", server.URL}, args...))
+		return out.String(), err
+	}
+
+	out, err := run("list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "centos") || !strings.Contains(out, "1.00T") {
+		t.Fatalf("unexpected table %q", out)
+	}
+
+	out, err = run("-o", "json", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jobs []map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &jobs); err != nil || jobs[0]["id"] != "centos" {
+		t.Fatalf("unexpected json %q: %v", out, err)
+	}
+
+	if _, err := run("start", "centos"); err == nil {
+		t.Fatal("command sent without token")
+	}
+	if _, err := run("--token", "secret", "start", "--force", "centos"); err != nil {
+		t.Fatal(err)
+	}
+	if cmd["cmd"] != "start" || cmd["force"] != true {
+		t.Fatalf("unexpected command %v", cmd)
+	}
+}
+
+func TestScanFiles(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"centos/7/a.iso", "centos/7/a.txt", "centos/.hidden/b.iso"} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("iso"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := make(map[string]uint64)
+	if err := scanFiles(filepath.Join(root, "centos"), root, []string{".iso"}, files); err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files["/centos/7/a.iso"] != 3 {
+		t.Fatalf("unexpected files %v", files)
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package ctl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/urfave/cli"
+	"sigs.k8s.io/yaml"
+
+	"github.com/CQUPTMirror/kubesync/internal"
+	"github.com/CQUPTMirror/kubesync/internal/tunasync"
+)
+
+func importTunasync(c *cli.Context) error {
+	a, err := args(c, 1)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(a[0])
+	if err != nil {
+		return err
+	}
+	// include_mirrors is relative to the working directory of tunasync, which is usually where the config is
+	include := func(pattern string) ([][]byte, error) {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(a[0]), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		var files [][]byte
+		for _, f := range matches {
+			b, err := os.ReadFile(f)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, b)
+		}
+		return files, nil
+	}
+
+	if c.Bool("local") {
+		jobs, warnings, err := tunasync.Import(data, include)
+		if err != nil {
+			return err
+		}
+		printWarnings(c.App.ErrWriter, warnings)
+		for _, job := range jobs {
+			b, err := yaml.Marshal(job)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(c.App.Writer, "---\n%s", b)
+		}
+		return nil
+	}
+
+	p, err := newOutput(c)
+	if err != nil {
+		return err
+	}
+	// the manager can not read the included files, so they are sent along with the config
+	cfg, _, err := tunasync.Parse(data)
+	if err != nil {
+		return err
+	}
+	var included [][]byte
+	if pattern := cfg.Include.IncludeMirrors; pattern != "" {
+		if included, err = include(pattern); err != nil {
+			return err
+		}
+	}
+	body := bytes.Join(append([][]byte{data}, included...), []byte("\n"))
+	result, err := newClient(c).ImportTunasync(context.Background(), body, c.Bool("dry-run"))
+	if err != nil {
+		return err
+	}
+	if len(included) > 0 {
+		var warnings []internal.ImportWarning
+		for _, w := range result.Warnings {
+			if w.Field != "include.include_mirrors" {
+				warnings = append(warnings, w)
+			}
+		}
+		result.Warnings = warnings
+	}
+
+	if p.format != OutputTable {
+		return p.print(result, nil, nil)
+	}
+	var rows [][]string
+	for _, j := range result.Jobs {
+		rows = append(rows, []string{j.ID, j.Result, orDash(j.Error)})
+	}
+	if err := p.print(result, []string{"JOB", "RESULT", "ERROR"}, rows); err != nil {
+		return err
+	}
+	printWarnings(c.App.ErrWriter, result.Warnings)
+	return nil
+}
+
+func printWarnings(w io.Writer, warnings []internal.ImportWarning) {
+	if len(warnings) == 0 {
+		return
+	}
+	p := &printer{w: w, format: OutputTable}
+	var rows [][]string
+	for _, v := range warnings {
+		rows = append(rows, []string{orDash(v.Mirror), v.Field, v.Message})
+	}
+	fmt.Fprintln(w)
+	_ = p.print(warnings, []string{"MIRROR", "FIELD", "WARNING"}, rows)
+}
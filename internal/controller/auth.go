@@ -0,0 +1,83 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"path"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+	"github.com/CQUPTMirror/kubesync/internal"
+)
+
+// authMode keeps the credentials readable only by the worker, ssh and rsync refuse more open files
+var authMode int32 = 0400
+
+// upstreamAuthVolumes returns a Secret volume for each credential of the upstream of a job,
+// mounted below AuthDir in the worker
+func upstreamAuthVolumes(job *v1beta1.Job) ([]corev1.Volume, []corev1.VolumeMount) {
+	var (
+		volumes []corev1.Volume
+		mounts  []corev1.VolumeMount
+	)
+	add := func(kind, secret, dir string, items []corev1.KeyToPath, optional *bool) {
+		name := job.Name + "-auth-" + kind
+		volumes = append(volumes, corev1.Volume{
+			Name: name,
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+				SecretName:  secret,
+				Items:       items,
+				DefaultMode: &authMode,
+				Optional:    optional,
+			}},
+		})
+		mounts = append(mounts, corev1.VolumeMount{Name: name, MountPath: path.Join(internal.AuthDir, dir), ReadOnly: true})
+	}
+	keyFile := func(kind string, ref *corev1.SecretKeySelector, file string) {
+		if ref != nil {
+			dir, name := path.Split(file)
+			add(kind, ref.Name, dir, []corev1.KeyToPath{{Key: ref.Key, Path: name}}, ref.Optional)
+		}
+	}
+	// the whole Secret, so optional keys like known_hosts only show up when set
+	secretDir := func(kind string, ref *corev1.LocalObjectReference, dir string) {
+		if ref != nil {
+			add(kind, ref.Name, dir, nil, nil)
+		}
+	}
+
+	auth := &job.Spec.Config.Auth
+	keyFile("rsync", auth.RsyncPassword, internal.AuthRsyncPasswordFile)
+	keyFile("bearer", auth.BearerToken, internal.AuthBearerTokenFile)
+	secretDir("basic", auth.BasicAuth, internal.AuthBasicDir)
+	secretDir("ssh", auth.SSHKey, internal.AuthSSHDir)
+	secretDir("s3", auth.S3, internal.AuthS3Dir)
+	return volumes, mounts
+}
+
+// addUpstreamAuth mounts the credentials of the upstream into the worker container of the pod
+func addUpstreamAuth(job *v1beta1.Job, spec *corev1.PodSpec, container *corev1.Container) {
+	volumes, mounts := upstreamAuthVolumes(job)
+	if len(volumes) == 0 {
+		return
+	}
+	spec.Volumes = append(spec.Volumes, volumes...)
+	container.VolumeMounts = append(container.VolumeMounts, mounts...)
+	container.Env = append(container.Env, corev1.EnvVar{Name: "AUTH_DIR", Value: internal.AuthDir})
+}
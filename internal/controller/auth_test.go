@@ -0,0 +1,64 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+	"github.com/CQUPTMirror/kubesync/internal"
+)
+
+func TestUpstreamAuthVolumes(t *testing.T) {
+	job := &v1beta1.Job{ObjectMeta: metav1.ObjectMeta{Name: "debian", Namespace: "mirror"}}
+	if volumes, mounts := upstreamAuthVolumes(job); volumes != nil || mounts != nil {
+		t.Errorf("expected no volumes, got %v %v", volumes, mounts)
+	}
+
+	job.Spec.Config.Auth = v1beta1.UpstreamAuth{
+		RsyncPassword: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "rsync"}, Key: "pass"},
+		SSHKey:        &corev1.LocalObjectReference{Name: "deploy-key"},
+	}
+	volumes, mounts := upstreamAuthVolumes(job)
+	if len(volumes) != 2 || len(mounts) != 2 {
+		t.Fatalf("unexpected volumes %v %v", volumes, mounts)
+	}
+	rsync := volumes[0].Secret
+	if volumes[0].Name != "debian-auth-rsync" || rsync.SecretName != "rsync" ||
+		len(rsync.Items) != 1 || rsync.Items[0].Key != "pass" || rsync.Items[0].Path != "password" {
+		t.Errorf("unexpected rsync volume %+v", volumes[0])
+	}
+	if mounts[0].MountPath != internal.AuthDir+"/rsync" || !mounts[0].ReadOnly {
+		t.Errorf("unexpected rsync mount %+v", mounts[0])
+	}
+	if volumes[1].Secret.SecretName != "deploy-key" || volumes[1].Secret.Items != nil ||
+		mounts[1].MountPath != internal.AuthDir+"/ssh" || *volumes[1].Secret.DefaultMode != 0400 {
+		t.Errorf("unexpected ssh volume %+v %+v", volumes[1], mounts[1])
+	}
+
+	spec := &corev1.PodSpec{Containers: []corev1.Container{{Name: "worker"}}}
+	addUpstreamAuth(job, spec, &spec.Containers[0])
+	c := spec.Containers[0]
+	if len(spec.Volumes) != 2 || len(c.VolumeMounts) != 2 || len(c.Env) != 1 ||
+		c.Env[0].Name != "AUTH_DIR" || c.Env[0].Value != internal.AuthDir {
+		t.Errorf("unexpected pod spec %+v", spec)
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+// condition returns a condition of the given type, true if ok
+func condition(conditionType string, ok bool, reason, message string, generation int64) metav1.Condition {
+	status := metav1.ConditionFalse
+	if ok {
+		status = metav1.ConditionTrue
+	}
+	return metav1.Condition{Type: conditionType, Status: status, Reason: reason, Message: message, ObservedGeneration: generation}
+}
+
+// deploymentCondition tells if the rolled out pods of a Deployment, as returned by the apply, are all ready
+func deploymentCondition(app *appsv1.Deployment, generation int64) metav1.Condition {
+	replicas := int32(1)
+	if app.Spec.Replicas != nil {
+		replicas = *app.Spec.Replicas
+	}
+	message := fmt.Sprintf("%d/%d replicas ready", app.Status.ReadyReplicas, replicas)
+	switch {
+	case app.Status.ObservedGeneration < app.Generation || app.Status.UpdatedReplicas < replicas:
+		return condition(v1beta1.ConditionDeploymentReady, false, "RollingOut", message, generation)
+	case app.Status.ReadyReplicas < replicas:
+		return condition(v1beta1.ConditionDeploymentReady, false, "PodsNotReady", message, generation)
+	}
+	return condition(v1beta1.ConditionDeploymentReady, true, "PodsReady", message, generation)
+}
+
+// daemonSetCondition tells if the rolled out pods of a DaemonSet are all ready
+func daemonSetCondition(ds *appsv1.DaemonSet, generation int64) metav1.Condition {
+	desired := ds.Status.DesiredNumberScheduled
+	message := fmt.Sprintf("%d/%d pods ready", ds.Status.NumberReady, desired)
+	switch {
+	case ds.Status.ObservedGeneration < ds.Generation || ds.Status.UpdatedNumberScheduled < desired:
+		return condition(v1beta1.ConditionDeploymentReady, false, "RollingOut", message, generation)
+	case ds.Status.NumberReady < desired:
+		return condition(v1beta1.ConditionDeploymentReady, false, "PodsNotReady", message, generation)
+	}
+	return condition(v1beta1.ConditionDeploymentReady, true, "PodsReady", message, generation)
+}
+
+// volumeCondition tells if the PVC of a job is bound, jobs on a shared volume have nothing to bind
+func volumeCondition(pvc *corev1.PersistentVolumeClaim, generation int64) metav1.Condition {
+	if pvc == nil {
+		return condition(v1beta1.ConditionVolumeBound, true, "SharedVolume", "", generation)
+	}
+	if pvc.Status.Phase == corev1.ClaimBound {
+		return condition(v1beta1.ConditionVolumeBound, true, "Bound", "", generation)
+	}
+	return condition(v1beta1.ConditionVolumeBound, false, "Claim"+string(pvc.Status.Phase), fmt.Sprintf("PVC %s is not bound", pvc.Name), generation)
+}
+
+// the reasons of the IngressReady condition of an HTTPRoute, they tell the route apart from an Ingress
+const (
+	reasonRouteAccepted    = "Accepted"
+	reasonRouteNotAccepted = "NotAccepted"
+)
+
+// ingressCondition tells if an Ingress got an address from its controller, or an HTTPRoute was accepted by a parent
+func ingressCondition(ig client.Object, generation int64) metav1.Condition {
+	switch ig := ig.(type) {
+	case *networkingv1.Ingress:
+		if len(ig.Status.LoadBalancer.Ingress) > 0 {
+			return condition(v1beta1.ConditionIngressReady, true, "AddressAssigned", "", generation)
+		}
+		return condition(v1beta1.ConditionIngressReady, false, "NoAddress", "the ingress controller has not assigned an address", generation)
+	case *unstructured.Unstructured:
+		parents, _, _ := unstructured.NestedSlice(ig.Object, "status", "parents")
+		for _, parent := range parents {
+			p, ok := parent.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			conditions, _, _ := unstructured.NestedSlice(p, "conditions")
+			for _, c := range conditions {
+				c, ok := c.(map[string]interface{})
+				if ok && c["type"] == "Accepted" && c["status"] == string(metav1.ConditionTrue) {
+					return condition(v1beta1.ConditionIngressReady, true, reasonRouteAccepted, "", generation)
+				}
+			}
+		}
+		return condition(v1beta1.ConditionIngressReady, false, reasonRouteNotAccepted, "no parent gateway accepted the HTTPRoute", generation)
+	}
+	return condition(v1beta1.ConditionIngressReady, false, "Unknown", "", generation)
+}
@@ -0,0 +1,109 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+func TestDeploymentCondition(t *testing.T) {
+	app := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Generation: 2}}
+	app.Status = appsv1.DeploymentStatus{ObservedGeneration: 1, UpdatedReplicas: 1, ReadyReplicas: 1}
+	if c := deploymentCondition(app, 5); c.Status != metav1.ConditionFalse || c.Reason != "RollingOut" || c.ObservedGeneration != 5 {
+		t.Errorf("unexpected condition %+v", c)
+	}
+	app.Status = appsv1.DeploymentStatus{ObservedGeneration: 2, UpdatedReplicas: 1}
+	if c := deploymentCondition(app, 5); c.Status != metav1.ConditionFalse || c.Reason != "PodsNotReady" {
+		t.Errorf("unexpected condition %+v", c)
+	}
+	app.Status.ReadyReplicas = 1
+	if c := deploymentCondition(app, 5); c.Status != metav1.ConditionTrue || c.Message != "1/1 replicas ready" {
+		t.Errorf("unexpected condition %+v", c)
+	}
+}
+
+func TestVolumeCondition(t *testing.T) {
+	if c := volumeCondition(nil, 1); c.Status != metav1.ConditionTrue || c.Reason != "SharedVolume" {
+		t.Errorf("unexpected condition %+v", c)
+	}
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "debian"}}
+	pvc.Status.Phase = corev1.ClaimPending
+	if c := volumeCondition(pvc, 1); c.Status != metav1.ConditionFalse || c.Reason != "ClaimPending" {
+		t.Errorf("unexpected condition %+v", c)
+	}
+	pvc.Status.Phase = corev1.ClaimBound
+	if c := volumeCondition(pvc, 1); c.Status != metav1.ConditionTrue {
+		t.Errorf("unexpected condition %+v", c)
+	}
+}
+
+func TestIngressCondition(t *testing.T) {
+	ig := &networkingv1.Ingress{}
+	if c := ingressCondition(ig, 1); c.Status != metav1.ConditionFalse {
+		t.Errorf("unexpected condition %+v", c)
+	}
+	ig.Status.LoadBalancer.Ingress = []networkingv1.IngressLoadBalancerIngress{{IP: "10.0.0.1"}}
+	if c := ingressCondition(ig, 1); c.Status != metav1.ConditionTrue {
+		t.Errorf("unexpected condition %+v", c)
+	}
+
+	route := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	if c := ingressCondition(route, 1); c.Status != metav1.ConditionFalse || c.Reason != "NotAccepted" {
+		t.Errorf("unexpected condition %+v", c)
+	}
+	route.Object["status"] = map[string]interface{}{"parents": []interface{}{
+		map[string]interface{}{"conditions": []interface{}{
+			map[string]interface{}{"type": "Accepted", "status": "True"},
+		}},
+	}}
+	if c := ingressCondition(route, 1); c.Status != metav1.ConditionTrue {
+		t.Errorf("unexpected condition %+v", c)
+	}
+}
+
+func TestSyncConditions(t *testing.T) {
+	status := &v1beta1.JobStatus{Status: v1beta1.PreSyncing}
+	status.SetSyncConditions(3)
+	syncing := meta.FindStatusCondition(status.Conditions, v1beta1.ConditionSyncing)
+	if syncing == nil || syncing.Status != metav1.ConditionTrue || syncing.Reason != "PreSyncing" || syncing.ObservedGeneration != 3 {
+		t.Errorf("unexpected syncing condition %+v", syncing)
+	}
+	if meta.IsStatusConditionTrue(status.Conditions, v1beta1.ConditionDegraded) {
+		t.Error("a syncing job is not degraded")
+	}
+
+	status.Status = v1beta1.Success
+	status.VolumeWarning = "volume is 95% full"
+	status.SetSyncConditions(3)
+	degraded := meta.FindStatusCondition(status.Conditions, v1beta1.ConditionDegraded)
+	if degraded == nil || degraded.Status != metav1.ConditionTrue || degraded.Reason != "VolumeFull" {
+		t.Errorf("unexpected degraded condition %+v", degraded)
+	}
+	if meta.IsStatusConditionTrue(status.Conditions, v1beta1.ConditionSyncing) {
+		t.Error("a successful job is not syncing")
+	}
+}
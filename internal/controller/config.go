@@ -0,0 +1,111 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+//+kubebuilder:rbac:groups=mirror.redrock.team,resources=kubesyncconfigs,verbs=get;list;watch
+
+// resolveConfig returns base overridden by the KubesyncConfig of the cluster, if there is one.
+// It is read on every reconcile, so a changed KubesyncConfig applies without restarting the controller.
+func resolveConfig(ctx context.Context, c client.Reader, base *Config) (*Config, error) {
+	kc := new(v1beta1.KubesyncConfig)
+	if err := c.Get(ctx, client.ObjectKey{Name: v1beta1.KubesyncConfigName}, kc); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			return base, nil
+		}
+		return nil, err
+	}
+	return base.override(&kc.Spec), nil
+}
+
+// override returns a copy of c with the fields set in spec replaced
+func (c *Config) override(spec *v1beta1.KubesyncConfigSpec) *Config {
+	cfg := *c
+	for _, f := range []struct {
+		field *string
+		value string
+	}{
+		{&cfg.ManagerImage, spec.ManagerImage},
+		{&cfg.WorkerImage, spec.WorkerImage},
+		{&cfg.PullPolicy, spec.PullPolicy},
+		{&cfg.PullSecret, spec.PullSecret},
+		{&cfg.StorageClass, spec.StorageClass},
+		{&cfg.AccessMode, spec.AccessMode},
+		{&cfg.FrontMode, spec.FrontMode},
+		{&cfg.FrontImage, spec.FrontImage},
+		{&cfg.RsyncImage, spec.RsyncImage},
+		{&cfg.FrontCmd, spec.FrontCmd},
+		{&cfg.FrontConfig, spec.FrontConfig},
+		{&cfg.RsyncCmd, spec.RsyncCmd},
+		{&cfg.FrontHost, spec.FrontHost},
+		{&cfg.FrontTLS, spec.FrontTLS},
+		{&cfg.FrontClass, spec.FrontClass},
+		{&cfg.FrontGateway, spec.FrontGateway},
+	} {
+		if f.value != "" {
+			*f.field = f.value
+		}
+	}
+	if len(spec.FrontAnnotations) > 0 {
+		cfg.FrontAnn = make(map[string]string, len(c.FrontAnn)+len(spec.FrontAnnotations))
+		for k, v := range c.FrontAnn {
+			cfg.FrontAnn[k] = v
+		}
+		for k, v := range spec.FrontAnnotations {
+			cfg.FrontAnn[k] = v
+		}
+	}
+	if spec.EnableMetric != nil {
+		cfg.EnableMetric = *spec.EnableMetric
+	}
+	if spec.Debug != nil {
+		cfg.Debug = *spec.Debug
+	}
+	return &cfg
+}
+
+// requestsForConfig returns a func requesting a reconcile of every object in list when the KubesyncConfig changes
+func requestsForConfig(c client.Reader, list client.ObjectList) func(context.Context, client.Object) []reconcile.Request {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		if obj.GetName() != v1beta1.KubesyncConfigName {
+			return nil
+		}
+		list := list.DeepCopyObject().(client.ObjectList)
+		if err := c.List(ctx, list); err != nil {
+			log.FromContext(ctx).Error(err, "failed to list objects of config", "config", obj.GetName())
+			return nil
+		}
+		var requests []reconcile.Request
+		_ = meta.EachListItem(list, func(o runtime.Object) error {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(o.(client.Object))})
+			return nil
+		})
+		return requests
+	}
+}
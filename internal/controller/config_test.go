@@ -0,0 +1,71 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+func TestResolveConfig(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	base := &Config{
+		WorkerImage: "worker:env",
+		FrontHost:   "mirrors.example.com",
+		FrontAnn:    map[string]string{"a": "1", "b": "1"},
+		Debug:       true,
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	cfg, err := resolveConfig(context.Background(), c, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg != base {
+		t.Fatal("config without KubesyncConfig should be the base one")
+	}
+
+	off := false
+	c = fake.NewClientBuilder().WithScheme(scheme).WithObjects(&v1beta1.KubesyncConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: v1beta1.KubesyncConfigName},
+		Spec: v1beta1.KubesyncConfigSpec{
+			FrontHost:        "mirror.example.org",
+			FrontAnnotations: map[string]string{"b": "2"},
+			Debug:            &off,
+		},
+	}).Build()
+	cfg, err = resolveConfig(context.Background(), c, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.WorkerImage != "worker:env" || cfg.FrontHost != "mirror.example.org" || cfg.Debug {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+	if cfg.FrontAnn["a"] != "1" || cfg.FrontAnn["b"] != "2" || base.FrontAnn["b"] != "1" {
+		t.Errorf("unexpected annotations %v, base %v", cfg.FrontAnn, base.FrontAnn)
+	}
+}
@@ -2,4 +2,18 @@ package controller
 
 const (
 	ConfigMapKind string = "ConfigMap"
+
+	// FrontConfigHashAnnotation and RsyncConfigHashAnnotation are set on the job pods to the hash
+	// of the configs, so they restart when one changes, since files mounted with subPath are never updated
+	FrontConfigHashAnnotation = "mirror.redrock.team/front-config-hash"
+	RsyncConfigHashAnnotation = "mirror.redrock.team/rsync-config-hash"
+
+	// VolumeExpandedAnnotation is set on the PVC of a job to the time it was last expanded,
+	// the usage reported before that time is stale
+	VolumeExpandedAnnotation = "mirror.redrock.team/expanded-at"
+
+	// VolumeFinalizer holds a deleted job until its PVC is retained or snapshotted
+	VolumeFinalizer = "mirror.redrock.team/volume"
+	// RetainedLabel is set on the PVCs and VolumeSnapshots kept from a deleted job to its name
+	RetainedLabel = "mirror.redrock.team/retained-from"
 )
@@ -0,0 +1,129 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+	"github.com/CQUPTMirror/kubesync/internal"
+)
+
+// cronJobMode tells if the job syncs in the Jobs of a CronJob, proxy jobs have nothing to sync
+func cronJobMode(job *v1beta1.Job) bool {
+	return job.Spec.Deploy.SyncMode == v1beta1.CronJobSync && job.Spec.Config.Type != v1beta1.Proxy
+}
+
+// cronSchedule returns the schedule of the CronJob of a job, deploy.schedule or else one derived
+// from the interval, at a minute picked by the job name so the syncs do not all start together
+func cronSchedule(job *v1beta1.Job) (string, error) {
+	if job.Spec.Deploy.Schedule != "" {
+		return job.Spec.Deploy.Schedule, nil
+	}
+	interval := job.Spec.Config.Interval
+	if interval <= 0 {
+		interval = 1440
+	}
+	h := fnv.New32a()
+	h.Write([]byte(job.Name))
+	minute, hour := h.Sum32()%60, h.Sum32()/60%24
+	switch {
+	case interval < 60 && 60%interval == 0:
+		return fmt.Sprintf("%d-59/%d * * * *", minute%uint32(interval), interval), nil
+	case interval == 60:
+		return fmt.Sprintf("%d * * * *", minute), nil
+	case interval == 1440:
+		return fmt.Sprintf("%d %d * * *", minute, hour), nil
+	case interval%60 == 0 && 1440%interval == 0:
+		hours := uint32(interval / 60)
+		return fmt.Sprintf("%d %d-23/%d * * *", minute, hour%hours, hours), nil
+	}
+	return "", fmt.Errorf("interval %d can not be a cron schedule, set deploy.schedule", interval)
+}
+
+// desiredCronJob returns the CronJob syncing a job in the cronjob sync mode, suspended while the job is disabled
+func (r *JobReconciler) desiredCronJob(cfg *Config, job *v1beta1.Job, manager string) (*batchv1.CronJob, error) {
+	schedule, err := cronSchedule(job)
+	if err != nil {
+		return nil, err
+	}
+	pullPolicy := imagePullPolicy(cfg, job)
+	container, err := workerContainer(cfg, job, manager, pullPolicy)
+	if err != nil {
+		return nil, err
+	}
+	// nothing serves the api of a worker syncing once
+	container.Env = append(container.Env, corev1.EnvVar{Name: "ONESHOT", Value: "true"})
+	container.LivenessProbe = nil
+	container.ReadinessProbe = nil
+	container.Ports = nil
+
+	// the pods must not match the selector of the service of the job
+	labels := getCommonLabels(job)
+	labels["app.kubernetes.io/component"] = "sync"
+	labels[internal.SyncJobLabel] = job.Name
+
+	suspend := job.Status.Status == v1beta1.Disabled
+	enableServiceLinks := false
+	var backoffLimit, historyLimit int32 = 0, 1
+	cj := batchv1.CronJob{
+		TypeMeta: metav1.TypeMeta{APIVersion: batchv1.SchemeGroupVersion.String(), Kind: "CronJob"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      job.Name,
+			Namespace: job.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule:                   schedule,
+			ConcurrencyPolicy:          batchv1.ForbidConcurrent,
+			Suspend:                    &suspend,
+			SuccessfulJobsHistoryLimit: &historyLimit,
+			FailedJobsHistoryLimit:     &historyLimit,
+			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: batchv1.JobSpec{
+					// the worker retries the sync itself
+					BackoffLimit: &backoffLimit,
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{Labels: labels},
+						Spec: corev1.PodSpec{
+							EnableServiceLinks: &enableServiceLinks,
+							RestartPolicy:      corev1.RestartPolicyNever,
+							Containers:         []corev1.Container{*container},
+							Volumes:            []corev1.Volume{dataVolume(job)},
+						},
+					},
+				},
+			},
+		},
+	}
+	pod := &cj.Spec.JobTemplate.Spec.Template.Spec
+	addUpstreamAuth(job, pod, &pod.Containers[0])
+	applyDeployConfig(cfg, &job.Spec.Deploy.DeployConfig, pod)
+
+	if err := ctrl.SetControllerReference(job, &cj, r.Scheme); err != nil {
+		return &cj, err
+	}
+	return &cj, nil
+}
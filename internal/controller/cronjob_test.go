@@ -0,0 +1,96 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+func TestCronSchedule(t *testing.T) {
+	job := &v1beta1.Job{ObjectMeta: metav1.ObjectMeta{Name: "debian"}}
+	for interval, want := range map[int]string{
+		15:   "12-59/15 * * * *",
+		60:   "12 * * * *",
+		360:  "12 5-23/6 * * *",
+		0:    "12 23 * * *",
+		1440: "12 23 * * *",
+	} {
+		job.Spec.Config.Interval = interval
+		if got, err := cronSchedule(job); err != nil || got != want {
+			t.Errorf("interval %d: got %q %v, expected %q", interval, got, err, want)
+		}
+	}
+	job.Spec.Config.Interval = 100
+	if _, err := cronSchedule(job); err == nil {
+		t.Error("interval 100 should need a schedule")
+	}
+	job.Spec.Deploy.Schedule = "0 */2 * * *"
+	if got, _ := cronSchedule(job); got != "0 */2 * * *" {
+		t.Errorf("the schedule should be used, got %q", got)
+	}
+}
+
+func TestCronJobDeployment(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	r := &JobReconciler{Scheme: scheme}
+	job := &v1beta1.Job{ObjectMeta: metav1.ObjectMeta{Name: "debian", Namespace: "mirror"}}
+	job.Spec.Config.Upstream = "rsync://mirrors.tuna.tsinghua.edu.cn/debian/"
+	job.Spec.Config.Interval = 120
+	job.Spec.Deploy.SyncMode = v1beta1.CronJobSync
+	job.Spec.Deploy.MemoryLimit = "4Gi"
+	cfg := &Config{WorkerImage: "worker", FrontImage: "caddy", RsyncImage: "rsync"}
+
+	app, err := r.desiredDeployment(cfg, job, "manager", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range app.Spec.Template.Spec.Containers {
+		if c.Name == "debian" {
+			t.Fatal("the worker should not run in the deployment")
+		}
+	}
+
+	cj, err := r.desiredCronJob(cfg, job, "manager")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cj.Spec.Schedule != "12 1-23/2 * * *" || *cj.Spec.Suspend {
+		t.Errorf("unexpected schedule %q suspend %v", cj.Spec.Schedule, *cj.Spec.Suspend)
+	}
+	pod := cj.Spec.JobTemplate.Spec.Template
+	if pod.Labels["app.kubernetes.io/component"] == getCommonLabels(job)["app.kubernetes.io/component"] {
+		t.Error("the sync pods should not match the service selector")
+	}
+	c := pod.Spec.Containers[0]
+	if c.Env[len(c.Env)-1].Name != "ONESHOT" || c.LivenessProbe != nil || len(c.Resources.Limits) == 0 {
+		t.Errorf("unexpected sync container %+v", c)
+	}
+
+	job.Status.Status = v1beta1.Disabled
+	if cj, err = r.desiredCronJob(cfg, job, "manager"); err != nil || !*cj.Spec.Suspend {
+		t.Errorf("disabled jobs should suspend the CronJob, got %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+// healthzProbe is the readiness probe of the worker, against its /healthz on the api port
+func healthzProbe() *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{Path: "/healthz", Port: intstr.FromInt32(ApiPort)},
+		},
+		InitialDelaySeconds: 5,
+		TimeoutSeconds:      5,
+		PeriodSeconds:       10,
+		SuccessThreshold:    1,
+		FailureThreshold:    3,
+	}
+}
+
+// deployResources returns the resource requirements of the main container of a DeployConfig
+func deployResources(deploy *v1beta1.DeployConfig) (corev1.ResourceRequirements, error) {
+	var res corev1.ResourceRequirements
+	for _, q := range []struct {
+		list  *corev1.ResourceList
+		name  corev1.ResourceName
+		value string
+	}{
+		{&res.Limits, corev1.ResourceCPU, deploy.CPULimit},
+		{&res.Limits, corev1.ResourceMemory, deploy.MemoryLimit},
+		{&res.Limits, corev1.ResourceEphemeralStorage, deploy.StorageLimit},
+		{&res.Requests, corev1.ResourceCPU, deploy.CPURequest},
+		{&res.Requests, corev1.ResourceMemory, deploy.MemoryRequest},
+		{&res.Requests, corev1.ResourceEphemeralStorage, deploy.StorageRequest},
+	} {
+		if q.value == "" {
+			continue
+		}
+		v, err := resource.ParseQuantity(q.value)
+		if err != nil {
+			return res, fmt.Errorf("invalid %s quantity %q: %w", q.name, q.value, err)
+		}
+		if *q.list == nil {
+			*q.list = corev1.ResourceList{}
+		}
+		(*q.list)[q.name] = v
+	}
+	return res, nil
+}
+
+// applyDeployConfig sets the pull secrets, scheduling, security and extra volumes of a DeployConfig
+// on the pod spec, it is applied after the containers are added
+func applyDeployConfig(cfg *Config, deploy *v1beta1.DeployConfig, spec *corev1.PodSpec) {
+	if deploy.ImagePullSecrets != nil {
+		spec.ImagePullSecrets = deploy.ImagePullSecrets
+	} else {
+		if cfg.PullSecret != "" {
+			spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: cfg.PullSecret}}
+		}
+	}
+	if deploy.NodeName != "" {
+		spec.NodeName = deploy.NodeName
+	}
+	if deploy.Affinity != nil {
+		spec.Affinity = deploy.Affinity
+	}
+	if deploy.Tolerations != nil {
+		spec.Tolerations = deploy.Tolerations
+	}
+	if deploy.PodSecurityContext != nil {
+		spec.SecurityContext = deploy.PodSecurityContext
+	}
+	if deploy.PriorityClassName != "" {
+		spec.PriorityClassName = deploy.PriorityClassName
+	}
+	if deploy.RuntimeClassName != nil {
+		spec.RuntimeClassName = deploy.RuntimeClassName
+	}
+	spec.Volumes = append(spec.Volumes, deploy.Volumes...)
+	if deploy.SecurityContext != nil {
+		for i := range spec.Containers {
+			spec.Containers[i].SecurityContext = deploy.SecurityContext
+		}
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+func TestDeployResources(t *testing.T) {
+	res, err := deployResources(&v1beta1.DeployConfig{CPULimit: "2", MemoryLimit: "1Gi", CPURequest: "100m", StorageRequest: "1Gi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Limits.Cpu().String() != "2" || res.Limits.Memory().String() != "1Gi" ||
+		res.Requests.Cpu().String() != "100m" || res.Requests.StorageEphemeral().String() != "1Gi" || len(res.Requests) != 2 {
+		t.Errorf("unexpected resources %v", res)
+	}
+	if res, err = deployResources(&v1beta1.DeployConfig{}); err != nil || res.Limits != nil || res.Requests != nil {
+		t.Errorf("expected no resources, got %v %v", res, err)
+	}
+	if _, err := deployResources(&v1beta1.DeployConfig{MemoryRequest: "a lot"}); err == nil {
+		t.Error("invalid quantity should fail")
+	}
+}
+
+func TestDeploymentDeployConfig(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	r := &JobReconciler{Scheme: scheme}
+	job := &v1beta1.Job{ObjectMeta: metav1.ObjectMeta{Name: "debian", Namespace: "mirror"}}
+	job.Spec.Config.Upstream = "rsync://mirrors.tuna.tsinghua.edu.cn/debian/"
+	nonRoot := true
+	runtimeClass := "gvisor"
+	job.Spec.Deploy.MemoryRequest = "512Mi"
+	job.Spec.Deploy.SecurityContext = &corev1.SecurityContext{RunAsNonRoot: &nonRoot}
+	job.Spec.Deploy.PodSecurityContext = &corev1.PodSecurityContext{FSGroup: new(int64)}
+	job.Spec.Deploy.PriorityClassName = "mirror"
+	job.Spec.Deploy.RuntimeClassName = &runtimeClass
+	job.Spec.Deploy.Volumes = []corev1.Volume{{Name: "gpg", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "gpg"}}}}
+	job.Spec.Deploy.VolumeMounts = []corev1.VolumeMount{{Name: "gpg", MountPath: "/etc/gpg"}}
+	cfg := &Config{WorkerImage: "worker", FrontImage: "caddy", RsyncImage: "rsync"}
+
+	app, err := r.desiredDeployment(cfg, job, "manager", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := app.Spec.Template.Spec
+	if spec.PriorityClassName != "mirror" || *spec.RuntimeClassName != "gvisor" || spec.SecurityContext == nil || len(spec.Volumes) != 2 {
+		t.Errorf("unexpected pod spec %+v", spec)
+	}
+	for _, c := range spec.Containers {
+		if c.SecurityContext == nil || !*c.SecurityContext.RunAsNonRoot {
+			t.Errorf("container %s has no security context", c.Name)
+		}
+	}
+	worker := spec.Containers[0]
+	if worker.Resources.Requests.Memory().String() != "512Mi" || len(worker.VolumeMounts) != 2 ||
+		worker.ReadinessProbe.HTTPGet == nil || worker.ReadinessProbe.HTTPGet.Path != "/healthz" {
+		t.Errorf("unexpected worker container %+v", worker)
+	}
+}
@@ -0,0 +1,169 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+const (
+	defaultExpandThreshold = 85
+	defaultExpandIncrease  = 20
+)
+
+// expandThreshold returns the volume usage in percent above which a job warns or grows its PVC
+func expandThreshold(job *v1beta1.Job) int {
+	if e := job.Spec.Volume.AutoExpand; e != nil && e.Threshold > 0 {
+		return e.Threshold
+	}
+	return defaultExpandThreshold
+}
+
+// grownSize returns the size a PVC of size grows to by the policy, never beyond its max size
+func grownSize(size resource.Quantity, policy *v1beta1.VolumeExpansion) (resource.Quantity, error) {
+	max, err := resource.ParseQuantity(policy.MaxSize)
+	if err != nil {
+		return size, fmt.Errorf("invalid volume maxSize %q: %w", policy.MaxSize, err)
+	}
+	increase := policy.Increase
+	if increase <= 0 {
+		increase = defaultExpandIncrease
+	}
+	grown := resource.NewQuantity(size.Value()+size.Value()*int64(increase)/100, resource.BinarySI)
+	if grown.Cmp(max) > 0 {
+		return max, nil
+	}
+	return *grown, nil
+}
+
+// expandVolume sets the size of the desired PVC of a job, never below the current one, growing it by the
+// autoExpand policy when the worker reports the volume above the threshold. It sets the volume warning of
+// the job when the volume fills up and can not grow, pvc is nil for jobs on a shared volume
+func (r *JobReconciler) expandVolume(ctx context.Context, job *v1beta1.Job, pvc *corev1.PersistentVolumeClaim) error {
+	current := new(corev1.PersistentVolumeClaim)
+	if pvc != nil {
+		if err := r.Get(ctx, client.ObjectKeyFromObject(pvc), current); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			current = nil
+		}
+	}
+	size := resource.Quantity{}
+	if pvc != nil {
+		size = pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+		if current != nil {
+			if req, ok := current.Spec.Resources.Requests[corev1.ResourceStorage]; ok && req.Cmp(size) > 0 {
+				size = req
+			}
+			if at, ok := current.Annotations[VolumeExpandedAnnotation]; ok {
+				pvc.Annotations = map[string]string{VolumeExpandedAnnotation: at}
+			}
+		}
+		pvc.Spec.Resources.Requests[corev1.ResourceStorage] = size
+	}
+
+	usage := job.Status.VolumeUsage()
+	if usage < expandThreshold(job) {
+		r.setVolumeWarning(job, "")
+		return nil
+	}
+	policy := job.Spec.Volume.AutoExpand
+	switch {
+	case pvc == nil:
+		r.setVolumeWarning(job, fmt.Sprintf("shared volume %d%% full", usage))
+	case policy == nil:
+		r.setVolumeWarning(job, fmt.Sprintf("volume %d%% full, set volume.autoExpand to grow it", usage))
+	case current == nil || resizing(current, job):
+		// wait for the worker to report the usage of the grown volume
+	default:
+		expandable, err := r.expandable(ctx, current)
+		if err != nil {
+			return err
+		}
+		if !expandable {
+			r.setVolumeWarning(job, fmt.Sprintf("volume %d%% full, its storage class does not allow expansion", usage))
+			return nil
+		}
+		grown, err := grownSize(size, policy)
+		if err != nil {
+			return err
+		}
+		if grown.Cmp(size) <= 0 {
+			r.setVolumeWarning(job, fmt.Sprintf("volume %d%% full at its max size %s", usage, policy.MaxSize))
+			return nil
+		}
+		pvc.Spec.Resources.Requests[corev1.ResourceStorage] = grown
+		pvc.Annotations = map[string]string{VolumeExpandedAnnotation: strconv.FormatInt(time.Now().Unix(), 10)}
+		r.setVolumeWarning(job, "")
+		if r.Recorder != nil {
+			r.Recorder.Eventf(job, corev1.EventTypeNormal, "VolumeExpanded", "expanding volume from %s to %s at %d%% usage", size.String(), grown.String(), usage)
+		}
+	}
+	return nil
+}
+
+// resizing tells if the PVC is still growing, or the worker has not reported its usage since it grew
+func resizing(pvc *corev1.PersistentVolumeClaim, job *v1beta1.Job) bool {
+	capacity := pvc.Status.Capacity[corev1.ResourceStorage]
+	if capacity.Cmp(pvc.Spec.Resources.Requests[corev1.ResourceStorage]) < 0 {
+		return true
+	}
+	at, err := strconv.ParseInt(pvc.Annotations[VolumeExpandedAnnotation], 10, 64)
+	return err == nil && job.Status.LastOnline <= at
+}
+
+// expandable tells if the storage class of the PVC allows volume expansion
+func (r *JobReconciler) expandable(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (bool, error) {
+	if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" {
+		return false, nil
+	}
+	sc := new(storagev1.StorageClass)
+	if err := r.Get(ctx, client.ObjectKey{Name: *pvc.Spec.StorageClassName}, sc); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return sc.AllowVolumeExpansion != nil && *sc.AllowVolumeExpansion, nil
+}
+
+// setVolumeWarning sets the volume warning of a job, emitting an event when it changes
+func (r *JobReconciler) setVolumeWarning(job *v1beta1.Job, warning string) {
+	if warning != "" && warning != job.Status.VolumeWarning && r.Recorder != nil {
+		r.Recorder.Event(job, corev1.EventTypeWarning, "VolumeFull", warning)
+	}
+	job.Status.VolumeWarning = warning
+}
+
+// volumeUsageChanged tells if the worker reported a new volume usage of a job, which may call for growing its PVC
+func volumeUsageChanged(oldObj, newObj client.Object) bool {
+	oldJob, ok := oldObj.(*v1beta1.Job)
+	if !ok {
+		return false
+	}
+	newJob, ok := newObj.(*v1beta1.Job)
+	return ok && (oldJob.Status.VolumeUsed != newJob.Status.VolumeUsed || oldJob.Status.VolumeCapacity != newJob.Status.VolumeCapacity)
+}
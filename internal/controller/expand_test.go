@@ -0,0 +1,142 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+func TestExpandVolume(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	expandable, fixed := true, false
+	class := "zfs"
+	current := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "debian", Namespace: "mirror"},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			StorageClassName: &class,
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("100Gi")},
+			},
+		},
+		Status: corev1.PersistentVolumeClaimStatus{
+			Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("100Gi")},
+		},
+	}
+	sc := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: class}, AllowVolumeExpansion: &expandable}
+	recorder := record.NewFakeRecorder(10)
+	r := &JobReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme).WithObjects(current, sc).Build(),
+		Scheme:   scheme,
+		Recorder: recorder,
+	}
+	ctx := context.Background()
+
+	job := &v1beta1.Job{ObjectMeta: metav1.ObjectMeta{Name: "debian", Namespace: "mirror"}}
+	job.Spec.Volume.Size = "50Gi"
+	job.Status.VolumeUsed, job.Status.VolumeCapacity = 90, 100
+	pvc, err := r.desiredPersistentVolumeClaim(&Config{}, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.expandVolume(ctx, job, pvc); err != nil {
+		t.Fatal(err)
+	}
+	if size := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; size.String() != "100Gi" {
+		t.Errorf("the PVC should never shrink, got %s", size.String())
+	}
+	if !strings.Contains(job.Status.VolumeWarning, "set volume.autoExpand") || len(recorder.Events) != 1 {
+		t.Errorf("unexpected warning %q", job.Status.VolumeWarning)
+	}
+
+	job.Spec.Volume.AutoExpand = &v1beta1.VolumeExpansion{MaxSize: "110Gi"}
+	if err := r.expandVolume(ctx, job, pvc); err != nil {
+		t.Fatal(err)
+	}
+	if size := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; size.String() != "110Gi" || pvc.Annotations[VolumeExpandedAnnotation] == "" {
+		t.Errorf("expected the PVC grown to its max size, got %s", size.String())
+	}
+	if job.Status.VolumeWarning != "" {
+		t.Errorf("unexpected warning %q", job.Status.VolumeWarning)
+	}
+
+	// the reported usage is stale until the PVC has grown
+	current.Spec.Resources.Requests[corev1.ResourceStorage] = resource.MustParse("110Gi")
+	current.Annotations = pvc.Annotations
+	if err := r.Update(ctx, current); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.expandVolume(ctx, job, pvc); err != nil {
+		t.Fatal(err)
+	}
+	if job.Status.VolumeWarning != "" {
+		t.Errorf("unexpected warning %q while resizing", job.Status.VolumeWarning)
+	}
+
+	sc.AllowVolumeExpansion = &fixed
+	if err := r.Update(ctx, sc); err != nil {
+		t.Fatal(err)
+	}
+	current.Annotations = nil
+	if err := r.Update(ctx, current); err != nil {
+		t.Fatal(err)
+	}
+	current.Status.Capacity[corev1.ResourceStorage] = resource.MustParse("110Gi")
+	if err := r.Status().Update(ctx, current); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.expandVolume(ctx, job, pvc); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(job.Status.VolumeWarning, "does not allow expansion") {
+		t.Errorf("unexpected warning %q", job.Status.VolumeWarning)
+	}
+
+	job.Status.VolumeUsed = 10
+	if err := r.expandVolume(ctx, job, pvc); err != nil || job.Status.VolumeWarning != "" {
+		t.Errorf("expected the warning cleared, got %q %v", job.Status.VolumeWarning, err)
+	}
+}
+
+func TestGrownSize(t *testing.T) {
+	size, err := grownSize(resource.MustParse("100Gi"), &v1beta1.VolumeExpansion{Increase: 50, MaxSize: "1Ti"})
+	if err != nil || size.String() != "150Gi" {
+		t.Errorf("unexpected size %s %v", size.String(), err)
+	}
+	if _, err := grownSize(resource.MustParse("100Gi"), &v1beta1.VolumeExpansion{MaxSize: "big"}); err == nil {
+		t.Error("invalid max size should fail")
+	}
+}
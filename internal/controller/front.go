@@ -0,0 +1,237 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+// defaultFrontConfig is used for the front options of a job when neither the job nor the controller has a front config
+const defaultFrontConfig = `{"apps":{"http":{"servers":{"file_server":{"listen":[":80"],"routes":[{"handle":[{"browse":{},"handler":"file_server","root":"/data"}]}]}}}}}`
+
+const defaultRateWindow = "1m"
+
+type caddyObject = map[string]interface{}
+
+// applyFrontOptions applies the options to the servers listening on the front port of a caddy json config.
+// The routes for the options are inserted before the existing ones, and the file_server handlers are
+// changed in place for browsing and index files.
+func applyFrontOptions(config string, opts *v1beta1.FrontOptions) (string, error) {
+	return editFrontServers(config, func(server caddyObject) error {
+		routes, _ := server["routes"].([]interface{})
+		for _, route := range routes {
+			handles, _ := lookup(route, "handle").([]interface{})
+			for _, h := range handles {
+				if handle, ok := h.(caddyObject); ok && handle["handler"] == "file_server" {
+					if err := applyFileServer(handle, opts); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		if extra := frontRoutes(opts); len(extra) > 0 {
+			server["routes"] = append(extra, routes...)
+		}
+		return nil
+	})
+}
+
+// applyFrontAliases rewrites the requests to the alias paths of a job onto its own path /{name},
+// the routes are inserted before the existing ones so every other route sees the rewritten path
+func applyFrontAliases(config, name string, aliases []string) (string, error) {
+	var extra []interface{}
+	for _, p := range aliases {
+		extra = append(extra, caddyObject{
+			"match": []interface{}{caddyObject{"path": []string{p, p + "/*"}}},
+			"handle": []interface{}{
+				caddyObject{"handler": "rewrite", "strip_path_prefix": p},
+				caddyObject{"handler": "rewrite", "uri": "/" + name + "{http.request.uri.path}"},
+			},
+		})
+	}
+	return editFrontServers(config, func(server caddyObject) error {
+		routes, _ := server["routes"].([]interface{})
+		server["routes"] = append(append([]interface{}{}, extra...), routes...)
+		return nil
+	})
+}
+
+// frontAliases returns the public paths of the job other than /{name}
+func frontAliases(job *v1beta1.Job) ([]string, error) {
+	var aliases []string
+	for _, p := range job.PublicPaths() {
+		p = strings.TrimSuffix(p, "/")
+		if p == "" || !strings.HasPrefix(p, "/") {
+			return nil, fmt.Errorf("invalid public path %q, should be an absolute path other than /", p)
+		}
+		if p != "/"+job.Name {
+			aliases = append(aliases, p)
+		}
+	}
+	return aliases, nil
+}
+
+// editFrontServers calls edit with each server listening on the front port of a caddy json config
+func editFrontServers(config string, edit func(server caddyObject) error) (string, error) {
+	var root caddyObject
+	if err := json.Unmarshal([]byte(config), &root); err != nil {
+		return "", err
+	}
+	servers, _ := lookup(root, "apps", "http", "servers").(caddyObject)
+	found := false
+	for _, v := range servers {
+		server, ok := v.(caddyObject)
+		if !ok || !listensOn(server, ":"+strconv.Itoa(FrontPort)) {
+			continue
+		}
+		found = true
+		if err := edit(server); err != nil {
+			return "", err
+		}
+	}
+	if !found {
+		return "", errors.New("no server listening on the front port in front config")
+	}
+	b, err := json.Marshal(root)
+	return string(b), err
+}
+
+func applyFileServer(handle caddyObject, opts *v1beta1.FrontOptions) error {
+	if opts.DisableBrowse != "" {
+		disable, err := strconv.ParseBool(opts.DisableBrowse)
+		if err != nil {
+			return err
+		}
+		if disable {
+			delete(handle, "browse")
+		} else if _, ok := handle["browse"]; !ok {
+			handle["browse"] = caddyObject{}
+		}
+	}
+	if len(opts.IndexFiles) > 0 {
+		handle["index_names"] = opts.IndexFiles
+	}
+	return nil
+}
+
+// frontRoutes returns the routes for the options, rate limit and redirects first so they apply to every request
+func frontRoutes(opts *v1beta1.FrontOptions) []interface{} {
+	var routes []interface{}
+	if opts.RateLimit != nil && opts.RateLimit.Requests > 0 {
+		window := opts.RateLimit.Window
+		if window == "" {
+			window = defaultRateWindow
+		}
+		routes = append(routes, caddyObject{"handle": []interface{}{caddyObject{
+			"handler": "rate_limit",
+			"rate_limits": caddyObject{"client": caddyObject{
+				"key":        "{http.request.remote.host}",
+				"window":     window,
+				"max_events": opts.RateLimit.Requests,
+			}},
+		}}})
+	}
+	for _, r := range opts.Redirects {
+		code := r.Code
+		if code == 0 {
+			code = http.StatusFound
+		}
+		routes = append(routes, caddyObject{
+			"match": []interface{}{caddyObject{"path": []string{r.From}}},
+			"handle": []interface{}{caddyObject{
+				"handler":     "static_response",
+				"status_code": code,
+				"headers":     caddyObject{"Location": []string{r.To}},
+			}},
+			"terminal": true,
+		})
+	}
+	if len(opts.Headers) > 0 {
+		routes = append(routes, headersRoute(nil, opts.Headers))
+	}
+	for _, ext := range sortedKeys(opts.MimeTypes) {
+		routes = append(routes, headersRoute([]string{"*" + ext}, map[string]string{"Content-Type": opts.MimeTypes[ext]}))
+	}
+	for _, c := range opts.Cache {
+		headers := make(map[string]string)
+		if c.CacheControl != "" {
+			headers["Cache-Control"] = c.CacheControl
+		}
+		if c.AccelExpires != "" {
+			headers["X-Accel-Expires"] = c.AccelExpires
+		}
+		if len(headers) > 0 {
+			routes = append(routes, headersRoute([]string{c.Path}, headers))
+		}
+	}
+	return routes
+}
+
+// headersRoute sets the response headers of the requests matching paths, or of every request if paths is empty
+func headersRoute(paths []string, headers map[string]string) caddyObject {
+	set := make(caddyObject, len(headers))
+	for k, v := range headers {
+		set[k] = []string{v}
+	}
+	route := caddyObject{"handle": []interface{}{caddyObject{
+		"handler":  "headers",
+		"response": caddyObject{"set": set},
+	}}}
+	if len(paths) > 0 {
+		route["match"] = []interface{}{caddyObject{"path": paths}}
+	}
+	return route
+}
+
+func lookup(v interface{}, keys ...string) interface{} {
+	for _, k := range keys {
+		obj, ok := v.(caddyObject)
+		if !ok {
+			return nil
+		}
+		v = obj[k]
+	}
+	return v
+}
+
+func listensOn(server caddyObject, addr string) bool {
+	listen, _ := server["listen"].([]interface{})
+	for _, l := range listen {
+		if l == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
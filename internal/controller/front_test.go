@@ -0,0 +1,101 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+func TestApplyFrontOptions(t *testing.T) {
+	opts := &v1beta1.FrontOptions{
+		DisableBrowse: "true",
+		IndexFiles:    []string{"index.html"},
+		Headers:       map[string]string{"X-Mirror": "cqupt"},
+		MimeTypes:     map[string]string{".whl": "application/zip"},
+		Redirects:     []v1beta1.FrontRedirect{{From: "/simple", To: "/simple/", Code: 301}},
+		Cache:         []v1beta1.FrontCacheRule{{Path: "*.iso", CacheControl: "max-age=86400", AccelExpires: "86400"}},
+		RateLimit:     &v1beta1.FrontRateLimit{Requests: 100},
+	}
+	config, err := applyFrontOptions(defaultFrontConfig, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var root caddyObject
+	if err := json.Unmarshal([]byte(config), &root); err != nil {
+		t.Fatal(err)
+	}
+	routes := lookup(root, "apps", "http", "servers", "file_server", "routes").([]interface{})
+	var handlers []string
+	for _, route := range routes {
+		handlers = append(handlers, lookup(route, "handle").([]interface{})[0].(caddyObject)["handler"].(string))
+	}
+	if got := strings.Join(handlers, ","); got != "rate_limit,static_response,headers,headers,headers,file_server" {
+		t.Fatalf("unexpected handlers %s", got)
+	}
+	fileServer := lookup(routes[5], "handle").([]interface{})[0].(caddyObject)
+	if _, ok := fileServer["browse"]; ok {
+		t.Error("browse should be disabled")
+	}
+	if !strings.Contains(config, `"index_names":["index.html"]`) || !strings.Contains(config, `"X-Accel-Expires":["86400"]`) ||
+		!strings.Contains(config, `"Location":["/simple/"]`) || !strings.Contains(config, `"max_events":100`) {
+		t.Errorf("unexpected config %s", config)
+	}
+
+	if _, err := applyFrontOptions(`{"apps":{}}`, opts); err == nil {
+		t.Error("config without front server should fail")
+	}
+}
+
+func TestGetFrontConfig(t *testing.T) {
+	r := &JobReconciler{}
+	job := &v1beta1.Job{ObjectMeta: metav1.ObjectMeta{Name: "pypi"}}
+	if config, err := r.getFrontConfig(&Config{}, job); err != nil || config != "" {
+		t.Fatalf("expected no config, got %q %v", config, err)
+	}
+
+	job.Spec.Deploy.FrontConfig = `{"apps": {"http": {"servers": {"s": {"listen": [":80"], "routes": []}}}}}`
+	config, err := r.getFrontConfig(&Config{FrontConfig: defaultFrontConfig}, job)
+	if err != nil || config != `{"apps":{"http":{"servers":{"s":{"listen":[":80"],"routes":[]}}}}}` {
+		t.Fatalf("job config should replace the controller one, got %q %v", config, err)
+	}
+
+	job.Spec.Deploy.FrontConfig = ""
+	job.Spec.Deploy.Front.IndexFiles = []string{"index.html"}
+	if config, err = r.getFrontConfig(&Config{}, job); err != nil || !strings.Contains(config, "index_names") {
+		t.Fatalf("options should apply to the default config, got %q %v", config, err)
+	}
+
+	job.Spec.Deploy.Front = v1beta1.FrontOptions{}
+	job.Spec.Ingress.Paths = []string{"/pypi", "/python/"}
+	if config, err = r.getFrontConfig(&Config{}, job); err != nil ||
+		!strings.Contains(config, `"match":[{"path":["/python","/python/*"]}]`) ||
+		!strings.Contains(config, `"uri":"/pypi{http.request.uri.path}"`) || strings.Contains(config, `"strip_path_prefix":"/pypi"`) {
+		t.Fatalf("aliases should be rewritten to the job path, got %q %v", config, err)
+	}
+
+	job.Spec.Ingress.Paths = []string{"/"}
+	if _, err = r.getFrontConfig(&Config{}, job); err == nil {
+		t.Error("root path should be refused")
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+// gitHTTPCmd runs the git http server of the worker image, which is the front of git jobs
+var gitHTTPCmd = []string{"/usr/bin/main", "git-http"}
+
+// gitSafeEnv trusts the repositories whatever their owner, the worker may clone them as another user
+var gitSafeEnv = []corev1.EnvVar{
+	{Name: "GIT_CONFIG_COUNT", Value: "1"},
+	{Name: "GIT_CONFIG_KEY_0", Value: "safe.directory"},
+	{Name: "GIT_CONFIG_VALUE_0", Value: "*"},
+}
+
+// gitRoot returns the dir holding the repositories of a git job
+func gitRoot(job *v1beta1.Job) string {
+	if job.Spec.Config.MirrorPath != "" {
+		return job.Spec.Config.MirrorPath
+	}
+	return "/data/" + job.Name
+}
+
+func gitDaemonEnabled(job *v1beta1.Job) bool {
+	enabled, _ := strconv.ParseBool(job.Spec.Deploy.GitDaemon)
+	return job.Spec.Config.Type == v1beta1.Git && enabled
+}
+
+// gitFrontEnv returns the env of the git http server of a git job
+func gitFrontEnv(job *v1beta1.Job) []corev1.EnvVar {
+	return append([]corev1.EnvVar{
+		{Name: "GIT_ROOT", Value: gitRoot(job)},
+		{Name: "GIT_PATHS", Value: strings.Join(job.PublicPaths(), ";")},
+		{Name: "GIT_DAEMON", Value: strconv.FormatBool(gitDaemonEnabled(job))},
+	}, gitSafeEnv...)
+}
+
+// gitDaemonContainer returns the sidecar serving the repositories of a git job over git://
+func gitDaemonContainer(job *v1beta1.Job, image string, pullPolicy corev1.PullPolicy) corev1.Container {
+	probe := &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt32(GitDaemonPort)},
+		},
+		InitialDelaySeconds: 10,
+		TimeoutSeconds:      5,
+		PeriodSeconds:       30,
+		SuccessThreshold:    1,
+		FailureThreshold:    5,
+	}
+	root := gitRoot(job)
+	mount := dataMount(job)
+	mount.ReadOnly = true
+	return corev1.Container{
+		Name:            job.Name + "-git",
+		Image:           image,
+		ImagePullPolicy: pullPolicy,
+		Command:         []string{"git", "daemon", "--reuseaddr", "--export-all", "--base-path=" + root, root},
+		Env:             gitSafeEnv,
+		LivenessProbe:   probe,
+		ReadinessProbe:  probe,
+		VolumeMounts:    []corev1.VolumeMount{mount},
+		Ports: []corev1.ContainerPort{
+			{ContainerPort: GitDaemonPort, Name: "git", Protocol: "TCP"},
+		},
+	}
+}
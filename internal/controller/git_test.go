@@ -0,0 +1,77 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+func TestGitDeployment(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	r := &JobReconciler{Scheme: scheme}
+	job := &v1beta1.Job{ObjectMeta: metav1.ObjectMeta{Name: "linux", Namespace: "mirror"}}
+	job.Spec.Config.Type = v1beta1.Git
+	job.Spec.Config.Upstream = "https://git.kernel.org/pub/scm/linux/kernel/git/torvalds/linux.git"
+	job.Spec.Deploy.Image = "worker-git"
+	cfg := &Config{WorkerImage: "worker", EnableMetric: true}
+
+	disableFront, _, frontCmd, _, _, frontImage, _ := r.checkRsyncFront(cfg, job)
+	if disableFront || frontImage != "worker-git" || strings.Join(frontCmd, " ") != "/usr/bin/main git-http" {
+		t.Fatalf("git jobs should serve http with the worker image, got %v %s %v", disableFront, frontImage, frontCmd)
+	}
+
+	app, err := r.desiredDeployment(cfg, job, "manager", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(app.Spec.Template.Spec.Containers); n != 2 {
+		t.Fatalf("expected the worker and the git http server, got %d containers", n)
+	}
+
+	job.Spec.Deploy.GitDaemon = "true"
+	if app, err = r.desiredDeployment(cfg, job, "manager", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	containers := app.Spec.Template.Spec.Containers
+	if len(containers) != 3 || containers[2].Name != "linux-git" || containers[2].Ports[0].ContainerPort != GitDaemonPort {
+		t.Fatalf("unexpected containers %v", containers)
+	}
+	env := make(map[string]string)
+	for _, e := range containers[1].Env {
+		env[e.Name] = e.Value
+	}
+	if env["GIT_ROOT"] != "/data/linux" || env["GIT_PATHS"] != "/linux" || env["GIT_DAEMON"] != "true" {
+		t.Errorf("unexpected front env %v", env)
+	}
+	svc, err := r.desiredService(cfg, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := svc.Spec.Ports[len(svc.Spec.Ports)-2]; last.Name != "git" {
+		t.Errorf("unexpected service ports %v", svc.Spec.Ports)
+	}
+}
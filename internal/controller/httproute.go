@@ -0,0 +1,203 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+// HTTPRouteGVK is the Gateway API HTTPRoute, which is built unstructured so the controller
+// does not depend on the Gateway API module and runs on clusters without its CRDs
+var HTTPRouteGVK = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "HTTPRoute"}
+
+const (
+	PathMatchPrefix = "PathPrefix"
+	PathMatchExact  = "Exact"
+)
+
+// useHTTPRoute tells whether an HTTPRoute is deployed instead of an Ingress
+func useHTTPRoute(cfg *Config, ig *v1beta1.IngressConfig) bool {
+	return ig.HTTPRoute != nil || cfg.FrontGateway != ""
+}
+
+// routeBackend is the service an HTTPRoute forwards to
+type routeBackend struct {
+	service string
+	port    int64
+	// paths are routed when the route config has none
+	paths     []string
+	pathMatch string
+}
+
+// ingressHosts returns the hosts the front is served at, Host or else the front host of the controller, then Hosts
+func ingressHosts(cfg *Config, ig *v1beta1.IngressConfig) []string {
+	var hosts []string
+	host := cfg.FrontHost
+	if ig.Host != "" {
+		host = ig.Host
+	}
+	if host != "" {
+		hosts = append(hosts, host)
+	}
+	for _, h := range ig.Hosts {
+		if h != "" && !slices.Contains(hosts, h) {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// desiredHTTPRoute returns the HTTPRoute for the ingress config, named and labeled as meta
+func desiredHTTPRoute(cfg *Config, ig *v1beta1.IngressConfig, meta metav1.ObjectMeta, backend routeBackend) (*unstructured.Unstructured, error) {
+	rc := ig.HTTPRoute
+	if rc == nil {
+		rc = new(v1beta1.HTTPRouteConfig)
+	}
+
+	parents := rc.ParentRefs
+	if len(parents) == 0 && cfg.FrontGateway != "" {
+		ref := v1beta1.GatewayRef{Name: cfg.FrontGateway}
+		if ns, name, ok := strings.Cut(cfg.FrontGateway, "/"); ok {
+			ref = v1beta1.GatewayRef{Namespace: ns, Name: name}
+		}
+		parents = []v1beta1.GatewayRef{ref}
+	}
+	if len(parents) == 0 {
+		return nil, errors.New("no gateway for the HTTPRoute, set parentRefs or the front gateway of the controller")
+	}
+	var parentRefs []interface{}
+	for _, p := range parents {
+		ref := map[string]interface{}{"name": p.Name}
+		if p.Namespace != "" {
+			ref["namespace"] = p.Namespace
+		}
+		if p.SectionName != "" {
+			ref["sectionName"] = p.SectionName
+		}
+		parentRefs = append(parentRefs, ref)
+	}
+
+	hostnames := rc.Hostnames
+	if len(hostnames) == 0 {
+		hostnames = ingressHosts(cfg, ig)
+	}
+
+	paths, pathMatch := backend.paths, backend.pathMatch
+	if len(rc.Paths) > 0 {
+		paths, pathMatch = rc.Paths, PathMatchPrefix
+	}
+	var headers []interface{}
+	for _, h := range rc.Headers {
+		header := map[string]interface{}{"name": h.Name, "value": h.Value}
+		if h.Type != "" {
+			header["type"] = h.Type
+		}
+		headers = append(headers, header)
+	}
+	var matches []interface{}
+	for _, p := range paths {
+		match := map[string]interface{}{"path": map[string]interface{}{"type": pathMatch, "value": p}}
+		if len(headers) > 0 {
+			match["headers"] = headers
+		}
+		matches = append(matches, match)
+	}
+
+	rule := map[string]interface{}{
+		"matches":     matches,
+		"backendRefs": []interface{}{map[string]interface{}{"name": backend.service, "port": backend.port}},
+	}
+	if rc.Timeout != "" || rc.BackendTimeout != "" {
+		timeouts := make(map[string]interface{})
+		if rc.Timeout != "" {
+			timeouts["request"] = rc.Timeout
+		}
+		if rc.BackendTimeout != "" {
+			timeouts["backendRequest"] = rc.BackendTimeout
+		}
+		rule["timeouts"] = timeouts
+	}
+
+	spec := map[string]interface{}{
+		"parentRefs": parentRefs,
+		"rules":      []interface{}{rule},
+	}
+	if len(hostnames) > 0 {
+		var hs []interface{}
+		for _, h := range hostnames {
+			hs = append(hs, h)
+		}
+		spec["hostnames"] = hs
+	}
+
+	route := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	route.SetGroupVersionKind(HTTPRouteGVK)
+	route.SetName(meta.Name)
+	route.SetNamespace(meta.Namespace)
+	route.SetLabels(meta.Labels)
+	return route, nil
+}
+
+// emptyHTTPRoute returns an HTTPRoute with only the name set, for deleting
+func emptyHTTPRoute(name, namespace string) *unstructured.Unstructured {
+	route := new(unstructured.Unstructured)
+	route.SetGroupVersionKind(HTTPRouteGVK)
+	route.SetName(name)
+	route.SetNamespace(namespace)
+	return route
+}
+
+// routedByHTTPRoute tells from the IngressReady condition of the last reconcile if the front was routed by
+// an HTTPRoute, HTTPRoutes are not cached so this saves a delete on every reconcile of the other fronts
+func routedByHTTPRoute(conditions []metav1.Condition) bool {
+	c := apimeta.FindStatusCondition(conditions, v1beta1.ConditionIngressReady)
+	return c != nil && (c.Reason == reasonRouteAccepted || c.Reason == reasonRouteNotAccepted)
+}
+
+// deleteHTTPRoute deletes the HTTPRoute of a front no longer routed by a gateway, clusters without
+// the Gateway API CRDs have none to delete
+func deleteHTTPRoute(ctx context.Context, c client.Client, name, namespace string) error {
+	err := c.Delete(ctx, emptyHTTPRoute(name, namespace))
+	if apierrors.IsNotFound(err) || apimeta.IsNoMatchError(err) {
+		return nil
+	}
+	return err
+}
+
+// deleteIngress deletes the Ingress of a front now routed by a gateway, it is looked up in the cache first
+// so reconciles do not send a delete each
+func deleteIngress(ctx context.Context, c client.Client, name, namespace string) error {
+	ig := new(networkingv1.Ingress)
+	if err := c.Get(ctx, client.ObjectKey{Name: name, Namespace: namespace}, ig); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	return client.IgnoreNotFound(c.Delete(ctx, ig))
+}
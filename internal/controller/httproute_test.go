@@ -0,0 +1,197 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+func TestDesiredHTTPRoute(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	r := &JobReconciler{Scheme: scheme}
+	job := &v1beta1.Job{ObjectMeta: metav1.ObjectMeta{Name: "debian", Namespace: "mirror"}}
+	cfg := &Config{FrontHost: "mirrors.example.com"}
+
+	obj, err := r.desiredIngress(cfg, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := obj.(*unstructured.Unstructured); ok {
+		t.Fatal("routes should only be used with a gateway")
+	}
+
+	cfg.FrontGateway = "gateway-system/mirrors"
+	route := mustRoute(t, r, cfg, job)
+	parent := route["parentRefs"].([]interface{})[0].(map[string]interface{})
+	if parent["namespace"] != "gateway-system" || parent["name"] != "mirrors" {
+		t.Errorf("unexpected parent %v", parent)
+	}
+	if route["hostnames"].([]interface{})[0] != "mirrors.example.com" {
+		t.Errorf("unexpected hostnames %v", route["hostnames"])
+	}
+	rule := route["rules"].([]interface{})[0].(map[string]interface{})
+	match := rule["matches"].([]interface{})[0].(map[string]interface{})["path"].(map[string]interface{})
+	if match["type"] != PathMatchPrefix || match["value"] != "/debian" {
+		t.Errorf("unexpected match %v", match)
+	}
+	if backend := rule["backendRefs"].([]interface{})[0].(map[string]interface{}); backend["name"] != "mirror-debian" || backend["port"] != int64(FrontPort) {
+		t.Errorf("unexpected backend %v", backend)
+	}
+
+	job.Spec.Ingress.HTTPRoute = &v1beta1.HTTPRouteConfig{
+		ParentRefs: []v1beta1.GatewayRef{{Name: "internal", SectionName: "https"}},
+		Hostnames:  []string{"debian.example.com"},
+		Paths:      []string{"/"},
+		Headers:    []v1beta1.HeaderMatch{{Name: "X-Mirror", Value: "1"}},
+		Timeout:    "30s",
+	}
+	route = mustRoute(t, r, cfg, job)
+	parent = route["parentRefs"].([]interface{})[0].(map[string]interface{})
+	if parent["name"] != "internal" || parent["sectionName"] != "https" || parent["namespace"] != nil {
+		t.Errorf("unexpected parent %v", parent)
+	}
+	rule = route["rules"].([]interface{})[0].(map[string]interface{})
+	match = rule["matches"].([]interface{})[0].(map[string]interface{})
+	if match["path"].(map[string]interface{})["value"] != "/" || len(match["headers"].([]interface{})) != 1 {
+		t.Errorf("unexpected match %v", match)
+	}
+	if rule["timeouts"].(map[string]interface{})["request"] != "30s" {
+		t.Errorf("unexpected timeouts %v", rule["timeouts"])
+	}
+
+	cfg.FrontGateway = ""
+	job.Spec.Ingress.HTTPRoute = &v1beta1.HTTPRouteConfig{}
+	if _, err := r.desiredIngress(cfg, job); err == nil {
+		t.Error("route without gateway should fail")
+	}
+}
+
+func TestDesiredIngressHostsPaths(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	r := &JobReconciler{Scheme: scheme}
+	job := &v1beta1.Job{ObjectMeta: metav1.ObjectMeta{Name: "ubuntu-iso", Namespace: "mirror"}}
+	job.Spec.Ingress.Hosts = []string{"mirrors.example.com", "mirrors.example.org"}
+	job.Spec.Ingress.Paths = []string{"/ubuntu-releases", "/ubuntu-iso"}
+	cfg := &Config{FrontHost: "mirrors.example.com"}
+
+	obj, err := r.desiredIngress(cfg, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ig := obj.(*networkingv1.Ingress)
+	if len(ig.Spec.Rules) != 2 || ig.Spec.Rules[0].Host != "mirrors.example.com" || ig.Spec.Rules[1].Host != "mirrors.example.org" {
+		t.Fatalf("unexpected rules %v", ig.Spec.Rules)
+	}
+	for _, rule := range ig.Spec.Rules {
+		if paths := rule.HTTP.Paths; len(paths) != 2 || paths[0].Path != "/ubuntu-releases" || paths[1].Path != "/ubuntu-iso" {
+			t.Errorf("unexpected paths %v", paths)
+		}
+	}
+	if url := job.PublicUrl(); url != "/ubuntu-releases" {
+		t.Errorf("unexpected url %s", url)
+	}
+
+	cfg.FrontGateway = "mirrors"
+	route := mustRoute(t, r, cfg, job)
+	if hostnames := route["hostnames"].([]interface{}); len(hostnames) != 2 {
+		t.Errorf("unexpected hostnames %v", hostnames)
+	}
+	if matches := route["rules"].([]interface{})[0].(map[string]interface{})["matches"].([]interface{}); len(matches) != 2 {
+		t.Errorf("unexpected matches %v", matches)
+	}
+}
+
+func mustRoute(t *testing.T, r *JobReconciler, cfg *Config, job *v1beta1.Job) map[string]interface{} {
+	t.Helper()
+	obj, err := r.desiredIngress(cfg, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	route, ok := obj.(*unstructured.Unstructured)
+	if !ok || route.GroupVersionKind() != HTTPRouteGVK || len(route.GetOwnerReferences()) != 1 {
+		t.Fatalf("unexpected route %v", obj)
+	}
+	// the object is copied by the client, which panics on values that are not json
+	_ = route.DeepCopyObject().(client.Object)
+	return route.Object["spec"].(map[string]interface{})
+}
+
+func TestDeleteStaleFront(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	route := emptyHTTPRoute("debian", "mirror")
+	ig := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "debian", Namespace: "mirror"}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(route, ig).Build()
+
+	// switching between the two deletes the other, whether or not it is there
+	for i := 0; i < 2; i++ {
+		if err := deleteHTTPRoute(ctx, c, "debian", "mirror"); err != nil {
+			t.Fatal(err)
+		}
+		if err := deleteIngress(ctx, c, "debian", "mirror"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(route), route); err == nil {
+		t.Error("expected the HTTPRoute deleted")
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(ig), ig); err == nil {
+		t.Error("expected the Ingress deleted")
+	}
+}
+
+func TestRoutedByHTTPRoute(t *testing.T) {
+	for _, c := range []struct {
+		reason string
+		want   bool
+	}{
+		{"", false},
+		{"AddressAssigned", false},
+		{"NoAddress", false},
+		{reasonRouteAccepted, true},
+		{reasonRouteNotAccepted, true},
+	} {
+		var conditions []metav1.Condition
+		if c.reason != "" {
+			conditions = append(conditions, condition(v1beta1.ConditionIngressReady, c.want, c.reason, "", 1))
+		}
+		if got := routedByHTTPRoute(conditions); got != c.want {
+			t.Errorf("reason %q: got %v, want %v", c.reason, got, c.want)
+		}
+	}
+}
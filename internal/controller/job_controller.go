@@ -22,15 +22,22 @@ import (
 	"errors"
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	mirrorv1beta1 "github.com/CQUPTMirror/kubesync/api/v1beta1"
 )
@@ -38,17 +45,26 @@ import (
 // JobReconciler reconciles a Job object
 type JobReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
-	Config *Config
+	Scheme   *runtime.Scheme
+	Config   *Config
+	Recorder record.EventRecorder
 }
 
 //+kubebuilder:rbac:groups=mirror.redrock.team,resources=jobs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=mirror.redrock.team,resources=jobs/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=mirror.redrock.team,resources=jobs/finalizers,verbs=update
+//+kubebuilder:rbac:groups=mirror.redrock.team,resources=jobtemplates,verbs=get;list;watch
 //+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
+//+kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots,verbs=get;create
 //+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;create;delete
 //+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -59,6 +75,21 @@ func (r *JobReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 	if err := r.Get(ctx, req.NamespacedName, &job); err != nil {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
+	orig := job.DeepCopy()
+	// only the status is written back, so the merged spec never reaches the apiserver
+	if err := r.applyTemplate(ctx, &job); err != nil && job.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, err
+	}
+	if !job.DeletionTimestamp.IsZero() {
+		return r.reclaimVolume(ctx, orig, &job)
+	}
+	if err := r.syncVolumeFinalizer(ctx, orig, &job); err != nil {
+		return ctrl.Result{}, err
+	}
+	cfg, err := resolveConfig(ctx, r, r.Config)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
 
 	var managerName string
 	var managerList mirrorv1beta1.ManagerList
@@ -70,54 +101,110 @@ func (r *JobReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 	} else {
 		managerName = managerList.Items[0].Name
 	}
-	if job.Spec.Config.Type != "" && job.Spec.Config.Type != mirrorv1beta1.Mirror {
+	if job.Spec.Config.Type == mirrorv1beta1.External {
 		return ctrl.Result{}, nil
 	}
+	// the webhook checks jobs as they are written, their template may have changed since
+	if errs := job.Spec.Validate(); len(errs) > 0 {
+		return ctrl.Result{}, errs.ToAggregate()
+	}
 
 	var (
-		err     error
-		ig      *v1.Ingress
+		ig      client.Object
 		frontCM *corev1.ConfigMap
+		rsyncCM *corev1.ConfigMap
 		sm      *monitoringv1.ServiceMonitor
 	)
-	disableFront, _, _, _, _, _, _ := r.checkRsyncFront(&job)
+	disableFront, disableRsync, _, _, _, _, _ := r.checkRsyncFront(cfg, &job)
 	if !disableFront {
-		ig, err = r.desiredIngress(&job)
+		ig, err = r.desiredIngress(cfg, &job)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		frontCM, err = r.desiredFrontConfigmap(cfg, &job)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
-		frontCM, err = r.desiredFrontConfigmap(&job)
+	}
+
+	if !disableRsync {
+		rsyncCM, err = r.desiredRsyncConfigmap(&job)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
 	}
 
-	pvc, err := r.desiredPersistentVolumeClaim(&job)
+	pvc, err := r.desiredPersistentVolumeClaim(cfg, &job)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.expandVolume(ctx, &job, pvc); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	token, err := r.desiredTokenSecret(ctx, &job)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	app, err := r.desiredDeployment(&job, managerName, frontCM)
+	app, err := r.desiredDeployment(cfg, &job, managerName, frontCM, rsyncCM)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	svc, err := r.desiredService(&job)
+	var cj *batchv1.CronJob
+	if cronJobMode(&job) {
+		cj, err = r.desiredCronJob(cfg, &job, managerName)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	svc, err := r.desiredService(cfg, &job)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	if r.Config.EnableMetric {
+	if cfg.EnableMetric {
 		sm = r.desiredServiceMonitor(&job)
 	}
 
 	applyOpts := []client.PatchOption{client.ForceOwnership, client.FieldOwner("mirror-controller")}
 
-	err = r.Patch(ctx, pvc, client.Apply, applyOpts...)
+	// the PVC of a job moved to a shared volume is kept, it still holds the data
+	if pvc != nil {
+		err = r.Patch(ctx, pvc, client.Apply, applyOpts...)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := r.adoptVolume(ctx, &job, pvc); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	meta.SetStatusCondition(&job.Status.Conditions, volumeCondition(pvc, job.Generation))
+
+	err = r.Patch(ctx, token, client.Apply, applyOpts...)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
+	if cj != nil {
+		err = r.Patch(ctx, cj, client.Apply, applyOpts...)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	} else {
+		// the CronJob left from the cronjob sync mode, looked up in the cache so reconciles do not send a delete each
+		stale := new(batchv1.CronJob)
+		err := r.Get(ctx, client.ObjectKey{Name: job.Name, Namespace: job.Namespace}, stale)
+		if err == nil {
+			err = r.Delete(ctx, stale, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		}
+		if client.IgnoreNotFound(err) != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
 	if app != nil {
 		err = r.Patch(ctx, svc, client.Apply, applyOpts...)
 		if err != nil {
@@ -129,6 +216,12 @@ func (r *JobReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 			if err != nil {
 				return ctrl.Result{}, err
 			}
+			meta.SetStatusCondition(&job.Status.Conditions, ingressCondition(ig, job.Generation))
+			if _, ok := ig.(*unstructured.Unstructured); ok {
+				if err := deleteIngress(ctx, r.Client, job.Name, job.Namespace); err != nil {
+					return ctrl.Result{}, err
+				}
+			}
 			if frontCM != nil {
 				err = r.Patch(ctx, frontCM, client.Apply, applyOpts...)
 				if err != nil {
@@ -136,10 +229,17 @@ func (r *JobReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 				}
 			}
 		}
+		if rsyncCM != nil {
+			err = r.Patch(ctx, rsyncCM, client.Apply, applyOpts...)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+		}
 		err = r.Patch(ctx, app, client.Apply, applyOpts...)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
+		meta.SetStatusCondition(&job.Status.Conditions, deploymentCondition(app, job.Generation))
 
 		if sm != nil {
 			err = r.Patch(ctx, sm, client.Apply, applyOpts...)
@@ -148,6 +248,12 @@ func (r *JobReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 			}
 		}
 	} else {
+		message := "the job has no container to run"
+		if job.Status.Status == mirrorv1beta1.Disabled {
+			message = "the job is disabled"
+		}
+		meta.SetStatusCondition(&job.Status.Conditions, condition(mirrorv1beta1.ConditionDeploymentReady, false, "NotDeployed", message, job.Generation))
+		meta.RemoveStatusCondition(&job.Status.Conditions, mirrorv1beta1.ConditionIngressReady)
 		deploy := new(appsv1.Deployment)
 		err := r.Get(ctx, client.ObjectKey{Name: job.Name, Namespace: job.Namespace}, deploy)
 		if err == nil || deploy != nil {
@@ -172,6 +278,7 @@ func (r *JobReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 	}
 
 	if disableFront {
+		meta.RemoveStatusCondition(&job.Status.Conditions, mirrorv1beta1.ConditionIngressReady)
 		ig := new(v1.Ingress)
 		err := r.Get(ctx, client.ObjectKey{Name: job.Name, Namespace: job.Namespace}, ig)
 		if err == nil || ig != nil {
@@ -181,10 +288,29 @@ func (r *JobReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 			})
 		}
 	}
+	// a route left from when the front was routed by a gateway would keep serving
+	if routedByHTTPRoute(orig.Status.Conditions) && (app == nil || disableFront || !useHTTPRoute(cfg, &job.Spec.Ingress)) {
+		if err := deleteHTTPRoute(ctx, r.Client, job.Name, job.Namespace); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if disableRsync {
+		cm := new(corev1.ConfigMap)
+		err := r.Get(ctx, client.ObjectKey{Name: job.Name + "-rsync", Namespace: job.Namespace}, cm)
+		if err == nil {
+			err = r.Delete(ctx, cm)
+		}
+		if client.IgnoreNotFound(err) != nil {
+			return ctrl.Result{}, err
+		}
+	}
 
 	if job.Status.Status == "" {
 		job.Status.Status = mirrorv1beta1.Created
 	}
+	job.Status.SetSyncConditions(job.Generation)
+	job.Status.ObservedGeneration = job.Generation
 
 	err = r.Status().Update(ctx, &job)
 	if err != nil {
@@ -196,18 +322,48 @@ func (r *JobReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *JobReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &mirrorv1beta1.Job{}, "spec.template", func(rawObj client.Object) []string {
+		job := rawObj.(*mirrorv1beta1.Job)
+		if job.Spec.Template == "" {
+			return nil
+		}
+		return []string{job.Spec.Template}
+	}); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&mirrorv1beta1.Job{}).
-		WithEventFilter(predicate.Funcs{
+		// the status of a job is mostly written by the manager, only the spec, deletion and volume usage
+		// call for a reconcile, while the status changes of the owned objects update the conditions
+		For(&mirrorv1beta1.Job{}, builder.WithPredicates(predicate.Funcs{
 			UpdateFunc: func(e event.UpdateEvent) bool {
 				oldGeneration := e.ObjectOld.GetGeneration()
 				newGeneration := e.ObjectNew.GetGeneration()
-				return oldGeneration != newGeneration
+				deleted := e.ObjectOld.GetDeletionTimestamp().IsZero() != e.ObjectNew.GetDeletionTimestamp().IsZero()
+				return oldGeneration != newGeneration || deleted || volumeUsageChanged(e.ObjectOld, e.ObjectNew)
 			},
-		}).
+		})).
 		Owns(&corev1.PersistentVolumeClaim{}).
 		Owns(&appsv1.Deployment{}).
+		Owns(&batchv1.CronJob{}).
 		Owns(&corev1.Service{}).
+		Owns(&corev1.Secret{}).
 		Owns(&v1.Ingress{}).
+		Watches(&mirrorv1beta1.JobTemplate{}, handler.EnqueueRequestsFromMapFunc(r.jobsForTemplate)).
+		Watches(&mirrorv1beta1.KubesyncConfig{}, handler.EnqueueRequestsFromMapFunc(requestsForConfig(r, &mirrorv1beta1.JobList{}))).
 		Complete(r)
 }
+
+// jobsForTemplate requests a reconcile of every job referencing the template
+func (r *JobReconciler) jobsForTemplate(ctx context.Context, tpl client.Object) []reconcile.Request {
+	var jobs mirrorv1beta1.JobList
+	if err := r.List(ctx, &jobs, client.InNamespace(tpl.GetNamespace()), client.MatchingFields{"spec.template": tpl.GetName()}); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list jobs of template", "template", tpl.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(jobs.Items))
+	for _, job := range jobs.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&job)})
+	}
+	return requests
+}
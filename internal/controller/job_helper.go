@@ -19,40 +19,85 @@ package controller
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+	"github.com/CQUPTMirror/kubesync/internal"
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"reflect"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"strconv"
 	"strings"
 )
 
 const (
-	ApiPort    = 6000
-	FrontPort  = 80
-	RsyncPort  = 873
-	MetricPort = 2019
+	ApiPort       = 6000
+	FrontPort     = 80
+	RsyncPort     = 873
+	MetricPort    = 2019
+	GitDaemonPort = 9418
 )
 
-func (r *JobReconciler) getFrontConfig(job *v1beta1.Job) (frontConfig string, err error) {
-	// TODO add caddy config to job crd
-	/*
-		if job.Spec.Config.CaddyConfig != "" {
-			return job.Spec.Config.CaddyConfig
+// applyTemplate replaces the spec of job with its spec merged over the referenced JobTemplate
+func (r *JobReconciler) applyTemplate(ctx context.Context, job *v1beta1.Job) error {
+	if job.Spec.Template == "" {
+		return nil
+	}
+	tpl := new(v1beta1.JobTemplate)
+	if err := r.Get(ctx, client.ObjectKey{Name: job.Spec.Template, Namespace: job.Namespace}, tpl); err != nil {
+		return fmt.Errorf("failed to get template %s: %w", job.Spec.Template, err)
+	}
+	spec, err := tpl.Spec.Merge(&job.Spec)
+	if err != nil {
+		return fmt.Errorf("failed to merge template %s: %w", job.Spec.Template, err)
+	}
+	job.Spec = *spec
+	return nil
+}
+
+// getFrontConfig returns the compacted caddy config of the job, which is the config of the job
+// or else the controller one, with the front options and public paths of the job applied
+func (r *JobReconciler) getFrontConfig(cfg *Config, job *v1beta1.Job) (frontConfig string, err error) {
+	frontConfig = cfg.FrontConfig
+	if job.Spec.Deploy.FrontConfig != "" {
+		frontConfig = job.Spec.Deploy.FrontConfig
+	}
+	if !reflect.ValueOf(job.Spec.Deploy.Front).IsZero() {
+		if frontConfig == "" {
+			frontConfig = defaultFrontConfig
+		}
+		if frontConfig, err = applyFrontOptions(frontConfig, &job.Spec.Deploy.Front); err != nil {
+			return "", fmt.Errorf("failed to apply front options: %w", err)
+		}
+	}
+	aliases, err := frontAliases(job)
+	if err != nil {
+		return "", err
+	}
+	if len(aliases) > 0 {
+		if frontConfig == "" {
+			frontConfig = defaultFrontConfig
+		}
+		if frontConfig, err = applyFrontAliases(frontConfig, job.Name, aliases); err != nil {
+			return "", fmt.Errorf("failed to apply public paths: %w", err)
 		}
-	*/
-	if r.Config.FrontConfig == "" {
+	}
+	if frontConfig == "" {
 		return "", nil
 	}
-	frontConfig = r.Config.FrontConfig
 	var buf bytes.Buffer
 	if err = json.Compact(&buf, []byte(frontConfig)); err != nil {
 		return "", err
@@ -61,19 +106,19 @@ func (r *JobReconciler) getFrontConfig(job *v1beta1.Job) (frontConfig string, er
 	return buf.String(), nil
 }
 
-func (r *JobReconciler) checkRsyncFront(job *v1beta1.Job) (disableFront, disableRsync bool, frontCmd, rsyncCmd []string, frontMode, frontImage, rsyncImage string) {
-	frontMode, frontImage, rsyncImage = r.Config.FrontMode, r.Config.FrontImage, r.Config.RsyncImage
+func (r *JobReconciler) checkRsyncFront(cfg *Config, job *v1beta1.Job) (disableFront, disableRsync bool, frontCmd, rsyncCmd []string, frontMode, frontImage, rsyncImage string) {
+	frontMode, frontImage, rsyncImage = cfg.FrontMode, cfg.FrontImage, cfg.RsyncImage
 
 	if job.Spec.Deploy.FrontCmd != "" {
 		frontCmd = strings.Split(job.Spec.Deploy.FrontCmd, " ")
-	} else if r.Config.FrontCmd != "" {
-		frontCmd = strings.Split(r.Config.FrontCmd, " ")
+	} else if cfg.FrontCmd != "" {
+		frontCmd = strings.Split(cfg.FrontCmd, " ")
 	}
 
 	if job.Spec.Deploy.RsyncCmd != "" {
 		rsyncCmd = strings.Split(job.Spec.Deploy.RsyncCmd, " ")
-	} else if r.Config.RsyncCmd != "" {
-		rsyncCmd = strings.Split(r.Config.RsyncCmd, " ")
+	} else if cfg.RsyncCmd != "" {
+		rsyncCmd = strings.Split(cfg.RsyncCmd, " ")
 	}
 
 	if s, err := strconv.ParseBool(job.Spec.Deploy.DisableFront); err == nil {
@@ -98,31 +143,67 @@ func (r *JobReconciler) checkRsyncFront(job *v1beta1.Job) (disableFront, disable
 		disableRsync = true
 	}
 
+	// git jobs serve their repositories with the git http server of the worker image as front
+	if job.Spec.Config.Type == v1beta1.Git {
+		disableFront = false
+		if s, err := strconv.ParseBool(job.Spec.Deploy.DisableFront); err == nil {
+			disableFront = s
+		}
+		switch {
+		case job.Spec.Deploy.FrontImage != "":
+			frontImage = job.Spec.Deploy.FrontImage
+		case job.Spec.Deploy.Image != "":
+			frontImage = job.Spec.Deploy.Image
+		default:
+			frontImage = cfg.WorkerImage
+		}
+		if job.Spec.Deploy.FrontCmd == "" {
+			frontCmd = gitHTTPCmd
+		}
+	}
+
+	// proxy jobs serve the front port themselves, without the front and rsync containers
+	if job.Spec.Config.Type == v1beta1.Proxy {
+		disableFront, disableRsync = false, true
+		if s, err := strconv.ParseBool(job.Spec.Deploy.DisableFront); err == nil {
+			disableFront = s
+		}
+	}
+
 	return
 }
 
-func (r *JobReconciler) desiredPersistentVolumeClaim(job *v1beta1.Job) (*corev1.PersistentVolumeClaim, error) {
+// desiredPersistentVolumeClaim returns the PVC of the job, or nil for a job on a shared volume
+func (r *JobReconciler) desiredPersistentVolumeClaim(cfg *Config, job *v1beta1.Job) (*corev1.PersistentVolumeClaim, error) {
+	if job.Spec.Volume.Shared() {
+		return nil, nil
+	}
+	size := job.Spec.Volume.Size
+	if size == "" {
+		size = v1beta1.DefaultVolumeSize
+	}
+	q, err := resource.ParseQuantity(size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid volume size %q: %w", size, err)
+	}
 	pvc := corev1.PersistentVolumeClaim{
 		TypeMeta: metav1.TypeMeta{APIVersion: corev1.SchemeGroupVersion.String(), Kind: "PersistentVolumeClaim"},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      job.Name,
+			Name:      job.ClaimName(),
 			Namespace: job.Namespace,
 			Labels:    getCommonLabels(job),
 		},
 		Spec: corev1.PersistentVolumeClaimSpec{
 			Resources: corev1.VolumeResourceRequirements{
-				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(job.Spec.Volume.Size)},
+				Requests: corev1.ResourceList{corev1.ResourceStorage: q},
 			},
 		},
 	}
-	if job.Spec.Volume.Size == "" {
-		pvc.Spec.Resources.Requests[corev1.ResourceStorage] = resource.MustParse("50Gi")
-	}
 	if job.Spec.Volume.AccessMode != "" {
 		pvc.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{job.Spec.Volume.AccessMode}
 	} else {
-		if r.Config.AccessMode != "" {
-			pvc.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.PersistentVolumeAccessMode(r.Config.AccessMode)}
+		if cfg.AccessMode != "" {
+			pvc.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.PersistentVolumeAccessMode(cfg.AccessMode)}
 		} else {
 			pvc.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
 		}
@@ -130,8 +211,8 @@ func (r *JobReconciler) desiredPersistentVolumeClaim(job *v1beta1.Job) (*corev1.
 	if job.Spec.Volume.StorageClass != nil {
 		pvc.Spec.StorageClassName = job.Spec.Volume.StorageClass
 	} else {
-		if r.Config.StorageClass != "" {
-			pvc.Spec.StorageClassName = &r.Config.StorageClass
+		if cfg.StorageClass != "" {
+			pvc.Spec.StorageClassName = &cfg.StorageClass
 		}
 	}
 
@@ -141,8 +222,51 @@ func (r *JobReconciler) desiredPersistentVolumeClaim(job *v1beta1.Job) (*corev1.
 	return &pvc, nil
 }
 
-func (r *JobReconciler) desiredFrontConfigmap(job *v1beta1.Job) (*corev1.ConfigMap, error) {
-	caddyConfig, err := r.getFrontConfig(job)
+// desiredTokenSecret returns the Secret holding the worker token of the job,
+// the token is generated once and kept across reconciles
+func (r *JobReconciler) desiredTokenSecret(ctx context.Context, job *v1beta1.Job) (*corev1.Secret, error) {
+	var token []byte
+	old := new(corev1.Secret)
+	err := r.Get(ctx, client.ObjectKey{Name: tokenSecretName(job.Name), Namespace: job.Namespace}, old)
+	if err == nil {
+		token = old.Data[internal.TokenKey]
+	} else if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	if len(token) == 0 {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		token = []byte(hex.EncodeToString(buf))
+	}
+
+	labels := getCommonLabels(job)
+	labels[internal.TokenLabel] = internal.RoleWorker.String()
+	labels[internal.TokenJobLabel] = job.Name
+
+	secret := corev1.Secret{
+		TypeMeta: metav1.TypeMeta{APIVersion: corev1.SchemeGroupVersion.String(), Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      tokenSecretName(job.Name),
+			Namespace: job.Namespace,
+			Labels:    labels,
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{internal.TokenKey: token},
+	}
+
+	if err := ctrl.SetControllerReference(job, &secret, r.Scheme); err != nil {
+		return &secret, err
+	}
+	return &secret, nil
+}
+
+func (r *JobReconciler) desiredFrontConfigmap(cfg *Config, job *v1beta1.Job) (*corev1.ConfigMap, error) {
+	if job.Spec.Config.Type == v1beta1.Proxy || job.Spec.Config.Type == v1beta1.Git {
+		return nil, nil
+	}
+	caddyConfig, err := r.getFrontConfig(cfg, job)
 	if err != nil {
 		return nil, err
 	}
@@ -164,7 +288,50 @@ func (r *JobReconciler) desiredFrontConfigmap(job *v1beta1.Job) (*corev1.ConfigM
 	}, nil
 }
 
-func (r *JobReconciler) desiredDeployment(job *v1beta1.Job, manager string, frontCM *corev1.ConfigMap) (*appsv1.Deployment, error) {
+// desiredRsyncConfigmap returns the ConfigMap holding the rsyncd.conf, and motd, of the rsync service
+func (r *JobReconciler) desiredRsyncConfigmap(job *v1beta1.Job) (*corev1.ConfigMap, error) {
+	rsyncdConfig, err := renderRsyncd(job)
+	if err != nil {
+		return nil, err
+	}
+
+	cm := corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{APIVersion: corev1.SchemeGroupVersion.String(), Kind: ConfigMapKind},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      job.Name + "-rsync",
+			Namespace: job.Namespace,
+			Labels:    getCommonLabels(job),
+		},
+		Data: map[string]string{
+			"rsyncd.conf": rsyncdConfig,
+		},
+	}
+	if job.Spec.Deploy.Rsyncd.Motd != "" {
+		cm.Data["motd"] = job.Spec.Deploy.Rsyncd.Motd
+	}
+
+	if err := ctrl.SetControllerReference(job, &cm, r.Scheme); err != nil {
+		return &cm, err
+	}
+	return &cm, nil
+}
+
+// setConfigHash sets an annotation on the pod template to the hash of data
+func setConfigHash(app *appsv1.Deployment, annotation string, data map[string]string) {
+	h := sha256.New()
+	for _, k := range sortedKeys(data) {
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write([]byte(data[k]))
+		h.Write([]byte{0})
+	}
+	if app.Spec.Template.Annotations == nil {
+		app.Spec.Template.Annotations = make(map[string]string)
+	}
+	app.Spec.Template.Annotations[annotation] = hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+func (r *JobReconciler) desiredDeployment(cfg *Config, job *v1beta1.Job, manager string, frontCM, rsyncCM *corev1.ConfigMap) (*appsv1.Deployment, error) {
 	enableServiceLinks := false
 	app := appsv1.Deployment{
 		TypeMeta: metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: "Deployment"},
@@ -184,124 +351,47 @@ func (r *JobReconciler) desiredDeployment(job *v1beta1.Job, manager string, fron
 				Spec: corev1.PodSpec{
 					EnableServiceLinks: &enableServiceLinks,
 					Containers:         []corev1.Container{},
-					Volumes: []corev1.Volume{
-						{
-							Name: job.Name,
-							VolumeSource: corev1.VolumeSource{
-								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-									ClaimName: job.Name,
-								},
-							},
-						},
-					},
+					Volumes:            []corev1.Volume{dataVolume(job)},
 				},
 			},
 		},
 	}
 
-	pullPolicy := job.Spec.Deploy.ImagePullPolicy
-	if pullPolicy == "" {
-		if r.Config.PullPolicy != "" {
-			pullPolicy = corev1.PullPolicy(r.Config.PullPolicy)
-		} else {
-			pullPolicy = corev1.PullIfNotPresent
-		}
-	}
-	if job.Spec.Deploy.ImagePullSecrets != nil {
-		app.Spec.Template.Spec.ImagePullSecrets = job.Spec.Deploy.ImagePullSecrets
-	} else {
-		if r.Config.PullSecret != "" {
-			app.Spec.Template.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: r.Config.PullSecret}}
-		}
-	}
-	if job.Spec.Deploy.NodeName != "" {
-		app.Spec.Template.Spec.NodeName = job.Spec.Deploy.NodeName
-	}
-	if job.Spec.Deploy.Affinity != nil {
-		app.Spec.Template.Spec.Affinity = job.Spec.Deploy.Affinity
-	}
-	if job.Spec.Deploy.Tolerations != nil {
-		app.Spec.Template.Spec.Tolerations = job.Spec.Deploy.Tolerations
-	}
-
-	if job.Status.Status != v1beta1.Disabled {
-		if job.Spec.Config.Upstream == "" {
-			return nil, errors.New("upstream not set")
-		}
+	pullPolicy := imagePullPolicy(cfg, job)
 
-		env := []corev1.EnvVar{
-			{Name: "NAME", Value: job.Name},
-			{Name: "PROVIDER", Value: job.Spec.Config.Provider},
-			{Name: "UPSTREAM", Value: job.Spec.Config.Upstream},
-			{Name: "MIRROR_PATH", Value: job.Spec.Config.MirrorPath},
-			{Name: "CONCURRENT", Value: strconv.Itoa(job.Spec.Config.Concurrent)},
-			{Name: "INTERVAL", Value: strconv.Itoa(job.Spec.Config.Interval)},
-			{Name: "RETRY", Value: strconv.Itoa(job.Spec.Config.Retry)},
-			{Name: "TIMEOUT", Value: strconv.Itoa(job.Spec.Config.Timeout)},
-			{Name: "COMMAND", Value: job.Spec.Config.Command},
-			{Name: "FAIL_ON_MATCH", Value: job.Spec.Config.FailOnMatch},
-			{Name: "SIZE_PATTERN", Value: job.Spec.Config.SizePattern},
-			{Name: "IPV6", Value: job.Spec.Config.IPv6Only},
-			{Name: "IPV4", Value: job.Spec.Config.IPv4Only},
-			{Name: "EXCLUDE_FILE", Value: job.Spec.Config.ExcludeFile},
-			{Name: "RSYNC_OPTIONS", Value: job.Spec.Config.RsyncOptions},
-			{Name: "STAGE1_PROFILE", Value: job.Spec.Config.Stage1Profile},
-			{Name: "EXEC_ON_SUCCESS", Value: job.Spec.Config.ExecOnSuccess},
-			{Name: "EXEC_ON_FAILURE", Value: job.Spec.Config.ExecOnFailure},
-			{Name: "API", Value: fmt.Sprintf("http://%s:3000", manager)},
-			{Name: "ADDR", Value: fmt.Sprintf(":%d", ApiPort)},
+	if job.Spec.Config.Type == v1beta1.Proxy {
+		if job.Status.Status == v1beta1.Disabled {
+			return nil, nil
 		}
-		env = append(env, job.Spec.Deploy.Env...)
-		env = append(env, job.Spec.Config.AdditionEnvs...)
-		if job.Spec.Config.Debug != "" || r.Config.Debug {
-			env = append(env, corev1.EnvVar{Name: "DEBUG", Value: "true"})
+		container, err := proxyContainer(cfg, job, manager, pullPolicy)
+		if err != nil {
+			return nil, err
 		}
-		probe := &corev1.Probe{
-			ProbeHandler: corev1.ProbeHandler{
-				TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt32(ApiPort)},
-			},
-			InitialDelaySeconds: 10,
-			TimeoutSeconds:      5,
-			PeriodSeconds:       30,
-			SuccessThreshold:    1,
-			FailureThreshold:    5,
+		if container.Image == "" {
+			return nil, nil
 		}
-		container := corev1.Container{
-			Name:            job.Name,
-			Image:           job.Spec.Deploy.Image,
-			ImagePullPolicy: pullPolicy,
-			Env:             env,
-			LivenessProbe:   probe,
-			ReadinessProbe:  probe,
-			VolumeMounts: []corev1.VolumeMount{
-				{
-					Name:      job.Name,
-					MountPath: "/data/" + job.Name,
-				},
-			},
-			Ports: []corev1.ContainerPort{
-				{ContainerPort: ApiPort, Name: "api", Protocol: "TCP"},
-			},
+		addUpstreamAuth(job, &app.Spec.Template.Spec, container)
+		app.Spec.Template.Spec.Containers = append(app.Spec.Template.Spec.Containers, *container)
+		applyDeployConfig(cfg, &job.Spec.Deploy.DeployConfig, &app.Spec.Template.Spec)
+		if err := ctrl.SetControllerReference(job, &app, r.Scheme); err != nil {
+			return &app, err
 		}
+		return &app, nil
+	}
 
-		if container.Image == "" {
-			container.Image = r.Config.WorkerImage
-		}
-		if job.Spec.Deploy.MemoryLimit != "" || job.Spec.Deploy.CPULimit != "" {
-			container.Resources = corev1.ResourceRequirements{Limits: corev1.ResourceList{}}
-			if job.Spec.Deploy.MemoryLimit != "" {
-				container.Resources.Limits[corev1.ResourceLimitsMemory] = resource.MustParse(job.Spec.Deploy.MemoryLimit)
-			}
-			if job.Spec.Deploy.CPULimit != "" {
-				container.Resources.Limits[corev1.ResourceLimitsCPU] = resource.MustParse(job.Spec.Deploy.CPULimit)
-			}
+	// in the cronjob sync mode the worker runs in the jobs of the CronJob instead
+	if job.Status.Status != v1beta1.Disabled && !cronJobMode(job) {
+		container, err := workerContainer(cfg, job, manager, pullPolicy)
+		if err != nil {
+			return nil, err
 		}
 		if container.Image != "" {
-			app.Spec.Template.Spec.Containers = append(app.Spec.Template.Spec.Containers, container)
+			addUpstreamAuth(job, &app.Spec.Template.Spec, container)
+			app.Spec.Template.Spec.Containers = append(app.Spec.Template.Spec.Containers, *container)
 		}
 	}
 
-	disableFront, disableRsync, frontCmd, rsyncCmd, _, frontImage, rsyncImage := r.checkRsyncFront(job)
+	disableFront, disableRsync, frontCmd, rsyncCmd, _, frontImage, rsyncImage := r.checkRsyncFront(cfg, job)
 	if !disableFront {
 		frontProbe := &corev1.Probe{
 			ProbeHandler: corev1.ProbeHandler{
@@ -322,17 +412,13 @@ func (r *JobReconciler) desiredDeployment(job *v1beta1.Job, manager string, fron
 			},
 			LivenessProbe:  frontProbe,
 			ReadinessProbe: frontProbe,
-			VolumeMounts: []corev1.VolumeMount{
-				{
-					Name:      job.Name,
-					MountPath: "/data/" + job.Name,
-				},
-			},
+			VolumeMounts:   []corev1.VolumeMount{serveMount(job)},
 			Ports: []corev1.ContainerPort{
 				{ContainerPort: FrontPort, Name: "front", Protocol: "TCP"},
 			},
 		}
 		if frontCM != nil {
+			setConfigHash(&app, FrontConfigHashAnnotation, frontCM.Data)
 			app.Spec.Template.Spec.Volumes = append(app.Spec.Template.Spec.Volumes, corev1.Volume{
 				Name: frontCM.Name,
 				VolumeSource: corev1.VolumeSource{
@@ -349,7 +435,9 @@ func (r *JobReconciler) desiredDeployment(job *v1beta1.Job, manager string, fron
 			})
 		}
 
-		if r.Config.EnableMetric {
+		if job.Spec.Config.Type == v1beta1.Git {
+			frontContainer.Env = append(frontContainer.Env, gitFrontEnv(job)...)
+		} else if cfg.EnableMetric {
 			frontContainer.Ports = append(frontContainer.Ports, corev1.ContainerPort{ContainerPort: MetricPort, Name: "metrics", Protocol: "TCP"})
 		}
 
@@ -358,6 +446,9 @@ func (r *JobReconciler) desiredDeployment(job *v1beta1.Job, manager string, fron
 		}
 		app.Spec.Template.Spec.Containers = append(app.Spec.Template.Spec.Containers, frontContainer)
 	}
+	if gitDaemonEnabled(job) {
+		app.Spec.Template.Spec.Containers = append(app.Spec.Template.Spec.Containers, gitDaemonContainer(job, frontImage, pullPolicy))
+	}
 	if !disableRsync {
 		rsyncProbe := &corev1.Probe{
 			ProbeHandler: corev1.ProbeHandler{
@@ -375,16 +466,34 @@ func (r *JobReconciler) desiredDeployment(job *v1beta1.Job, manager string, fron
 			ImagePullPolicy: pullPolicy,
 			LivenessProbe:   rsyncProbe,
 			ReadinessProbe:  rsyncProbe,
-			VolumeMounts: []corev1.VolumeMount{
-				{
-					Name:      job.Name,
-					MountPath: "/data/" + job.Name,
-				},
-			},
+			VolumeMounts:    []corev1.VolumeMount{serveMount(job)},
 			Ports: []corev1.ContainerPort{
 				{ContainerPort: RsyncPort, Name: "rsync", Protocol: "TCP"},
 			},
 		}
+		if rsyncCM != nil {
+			setConfigHash(&app, RsyncConfigHashAnnotation, rsyncCM.Data)
+			app.Spec.Template.Spec.Volumes = append(app.Spec.Template.Spec.Volumes, corev1.Volume{
+				Name: rsyncCM.Name,
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{Name: rsyncCM.Name},
+					},
+				},
+			})
+			rsyncContainer.VolumeMounts = append(rsyncContainer.VolumeMounts, corev1.VolumeMount{
+				Name:      rsyncCM.Name,
+				SubPath:   "rsyncd.conf",
+				MountPath: RsyncdConfigPath,
+			})
+			if _, ok := rsyncCM.Data["motd"]; ok {
+				rsyncContainer.VolumeMounts = append(rsyncContainer.VolumeMounts, corev1.VolumeMount{
+					Name:      rsyncCM.Name,
+					SubPath:   "motd",
+					MountPath: RsyncdMotdPath,
+				})
+			}
+		}
 		if len(rsyncCmd) > 0 {
 			rsyncContainer.Command = rsyncCmd
 		}
@@ -394,6 +503,7 @@ func (r *JobReconciler) desiredDeployment(job *v1beta1.Job, manager string, fron
 	if len(app.Spec.Template.Spec.Containers) == 0 {
 		return nil, nil
 	}
+	applyDeployConfig(cfg, &job.Spec.Deploy.DeployConfig, &app.Spec.Template.Spec)
 
 	if err := ctrl.SetControllerReference(job, &app, r.Scheme); err != nil {
 		return &app, err
@@ -401,7 +511,90 @@ func (r *JobReconciler) desiredDeployment(job *v1beta1.Job, manager string, fron
 	return &app, nil
 }
 
-func (r *JobReconciler) desiredService(job *v1beta1.Job) (*corev1.Service, error) {
+// imagePullPolicy returns the pull policy of the containers of a job
+func imagePullPolicy(cfg *Config, job *v1beta1.Job) corev1.PullPolicy {
+	if job.Spec.Deploy.ImagePullPolicy != "" {
+		return job.Spec.Deploy.ImagePullPolicy
+	}
+	if cfg.PullPolicy != "" {
+		return corev1.PullPolicy(cfg.PullPolicy)
+	}
+	return corev1.PullIfNotPresent
+}
+
+// workerContainer returns the worker container syncing a job
+func workerContainer(cfg *Config, job *v1beta1.Job, manager string, pullPolicy corev1.PullPolicy) (*corev1.Container, error) {
+	if job.Spec.Config.Upstream == "" {
+		return nil, errors.New("upstream not set")
+	}
+
+	env := []corev1.EnvVar{
+		{Name: "NAME", Value: job.Name},
+		{Name: "PROVIDER", Value: job.Spec.Config.Provider},
+		{Name: "UPSTREAM", Value: job.Spec.Config.Upstream},
+		{Name: "MIRROR_PATH", Value: job.Spec.Config.MirrorPath},
+		{Name: "CONCURRENT", Value: strconv.Itoa(job.Spec.Config.Concurrent)},
+		{Name: "INTERVAL", Value: strconv.Itoa(job.Spec.Config.Interval)},
+		{Name: "RETRY", Value: strconv.Itoa(job.Spec.Config.Retry)},
+		{Name: "TIMEOUT", Value: strconv.Itoa(job.Spec.Config.Timeout)},
+		{Name: "COMMAND", Value: job.Spec.Config.Command},
+		{Name: "FAIL_ON_MATCH", Value: job.Spec.Config.FailOnMatch},
+		{Name: "SIZE_PATTERN", Value: job.Spec.Config.SizePattern},
+		{Name: "IPV6", Value: job.Spec.Config.IPv6Only},
+		{Name: "IPV4", Value: job.Spec.Config.IPv4Only},
+		{Name: "EXCLUDE_FILE", Value: job.Spec.Config.ExcludeFile},
+		{Name: "RSYNC_OPTIONS", Value: job.Spec.Config.RsyncOptions},
+		{Name: "STAGE1_PROFILE", Value: job.Spec.Config.Stage1Profile},
+		{Name: "EXEC_ON_SUCCESS", Value: job.Spec.Config.ExecOnSuccess},
+		{Name: "EXEC_ON_FAILURE", Value: job.Spec.Config.ExecOnFailure},
+		{Name: "API", Value: fmt.Sprintf("http://%s:3000", manager)},
+		{Name: "ADDR", Value: fmt.Sprintf(":%d", ApiPort)},
+		{Name: "TOKEN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: tokenSecretName(job.Name)},
+			Key:                  internal.TokenKey,
+		}}},
+	}
+	env = append(env, job.Spec.Deploy.Env...)
+	env = append(env, job.Spec.Config.AdditionEnvs...)
+	if job.Spec.Config.Debug != "" || cfg.Debug {
+		env = append(env, corev1.EnvVar{Name: "DEBUG", Value: "true"})
+	}
+	probe := &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt32(ApiPort)},
+		},
+		InitialDelaySeconds: 10,
+		TimeoutSeconds:      5,
+		PeriodSeconds:       30,
+		SuccessThreshold:    1,
+		FailureThreshold:    5,
+	}
+	container := corev1.Container{
+		Name:            job.Name,
+		Image:           job.Spec.Deploy.Image,
+		ImagePullPolicy: pullPolicy,
+		Env:             env,
+		LivenessProbe:   probe,
+		ReadinessProbe:  healthzProbe(),
+		VolumeMounts:    []corev1.VolumeMount{dataMount(job)},
+		Ports: []corev1.ContainerPort{
+			{ContainerPort: ApiPort, Name: "api", Protocol: "TCP"},
+		},
+	}
+
+	if container.Image == "" {
+		container.Image = cfg.WorkerImage
+	}
+	resources, err := deployResources(&job.Spec.Deploy.DeployConfig)
+	if err != nil {
+		return nil, err
+	}
+	container.Resources = resources
+	container.VolumeMounts = append(container.VolumeMounts, job.Spec.Deploy.VolumeMounts...)
+	return &container, nil
+}
+
+func (r *JobReconciler) desiredService(cfg *Config, job *v1beta1.Job) (*corev1.Service, error) {
 	svc := corev1.Service{
 		TypeMeta: metav1.TypeMeta{APIVersion: corev1.SchemeGroupVersion.String(), Kind: "Service"},
 		ObjectMeta: metav1.ObjectMeta{
@@ -417,14 +610,17 @@ func (r *JobReconciler) desiredService(job *v1beta1.Job) (*corev1.Service, error
 			Type:     corev1.ServiceTypeClusterIP,
 		},
 	}
-	disableFront, disableRsync, _, _, _, _, _ := r.checkRsyncFront(job)
+	disableFront, disableRsync, _, _, _, _, _ := r.checkRsyncFront(cfg, job)
 	if !disableFront {
 		svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{Name: "front", Port: FrontPort, Protocol: "TCP", TargetPort: intstr.FromString("front")})
 	}
 	if !disableRsync {
 		svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{Name: "rsync", Port: RsyncPort, Protocol: "TCP", TargetPort: intstr.FromString("rsync")})
 	}
-	if r.Config.EnableMetric {
+	if gitDaemonEnabled(job) {
+		svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{Name: "git", Port: GitDaemonPort, Protocol: "TCP", TargetPort: intstr.FromString("git")})
+	}
+	if cfg.EnableMetric {
 		svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{Name: "metrics", Port: MetricPort, Protocol: "TCP", TargetPort: intstr.FromString("metrics")})
 	}
 
@@ -434,9 +630,23 @@ func (r *JobReconciler) desiredService(job *v1beta1.Job) (*corev1.Service, error
 	return &svc, nil
 }
 
-func (r *JobReconciler) desiredIngress(job *v1beta1.Job) (*v1.Ingress, error) {
+// desiredIngress returns the Ingress of the directory service, or the HTTPRoute if routes are used
+func (r *JobReconciler) desiredIngress(cfg *Config, job *v1beta1.Job) (client.Object, error) {
+	if useHTTPRoute(cfg, &job.Spec.Ingress) {
+		route, err := desiredHTTPRoute(cfg, &job.Spec.Ingress,
+			metav1.ObjectMeta{Name: job.Name, Namespace: job.Namespace, Labels: getCommonLabels(job)},
+			routeBackend{service: serviceName(job.Name), port: FrontPort, paths: job.PublicPaths(), pathMatch: PathMatchPrefix})
+		if err != nil {
+			return nil, err
+		}
+		if err := ctrl.SetControllerReference(job, route, r.Scheme); err != nil {
+			return route, err
+		}
+		return route, nil
+	}
+
 	annotations := make(map[string]string)
-	for k, v := range r.Config.FrontAnn {
+	for k, v := range cfg.FrontAnn {
 		annotations[k] = v
 	}
 	for k, v := range job.Spec.Ingress.Annotations {
@@ -453,52 +663,46 @@ func (r *JobReconciler) desiredIngress(job *v1beta1.Job) (*v1.Ingress, error) {
 			Labels:      getCommonLabels(job),
 			Annotations: annotations,
 		},
-		Spec: v1.IngressSpec{
-			Rules: []v1.IngressRule{
-				{
-					IngressRuleValue: v1.IngressRuleValue{
-						HTTP: &v1.HTTPIngressRuleValue{
-							Paths: []v1.HTTPIngressPath{
-								{
-									Path:     "/" + job.Name,
-									PathType: &pathType,
-									Backend: v1.IngressBackend{
-										Service: &v1.IngressServiceBackend{
-											Name: serviceName(job.Name),
-											Port: v1.ServiceBackendPort{Name: "front"},
-										},
-									},
-								},
-							},
-						},
-					},
+	}
+	var paths []v1.HTTPIngressPath
+	for _, p := range job.PublicPaths() {
+		paths = append(paths, v1.HTTPIngressPath{
+			Path:     p,
+			PathType: &pathType,
+			Backend: v1.IngressBackend{
+				Service: &v1.IngressServiceBackend{
+					Name: serviceName(job.Name),
+					Port: v1.ServiceBackendPort{Name: "front"},
 				},
 			},
-		},
+		})
+	}
+	hosts := ingressHosts(cfg, &job.Spec.Ingress)
+	if len(hosts) == 0 {
+		hosts = []string{""}
+	}
+	for _, h := range hosts {
+		ig.Spec.Rules = append(ig.Spec.Rules, v1.IngressRule{
+			Host:             h,
+			IngressRuleValue: v1.IngressRuleValue{HTTP: &v1.HTTPIngressRuleValue{Paths: paths}},
+		})
 	}
 
-	if r.Config.FrontClass != "" || job.Spec.Ingress.IngressClass != "" {
-		ig.Spec.IngressClassName = &r.Config.FrontClass
+	if cfg.FrontClass != "" || job.Spec.Ingress.IngressClass != "" {
+		ig.Spec.IngressClassName = &cfg.FrontClass
 		if job.Spec.Ingress.IngressClass != "" {
 			ig.Spec.IngressClassName = &job.Spec.Ingress.IngressClass
 		}
 	}
 
-	if r.Config.FrontTLS != "" || job.Spec.Ingress.TLSSecret != "" {
-		secretName := r.Config.FrontTLS
+	if cfg.FrontTLS != "" || job.Spec.Ingress.TLSSecret != "" {
+		secretName := cfg.FrontTLS
 		if job.Spec.Ingress.TLSSecret != "" {
 			secretName = job.Spec.Ingress.TLSSecret
 		}
 		ig.Spec.TLS = []v1.IngressTLS{{SecretName: secretName}}
 	}
 
-	if r.Config.FrontHost != "" || job.Spec.Ingress.Host != "" {
-		ig.Spec.Rules[0].Host = r.Config.FrontHost
-		if job.Spec.Ingress.Host != "" {
-			ig.Spec.Rules[0].Host = job.Spec.Ingress.Host
-		}
-	}
-
 	if err := ctrl.SetControllerReference(job, &ig, r.Scheme); err != nil {
 		return &ig, err
 	}
@@ -0,0 +1,70 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+func TestMergeTemplate(t *testing.T) {
+	hdd := "hdd"
+	tpl := &v1beta1.JobTemplateSpec{
+		Config: v1beta1.JobConfig{
+			Provider:      "rsync",
+			ExecOnSuccess: "reporter",
+			AdditionEnvs:  []corev1.EnvVar{{Name: "A", Value: "1"}},
+		},
+		Deploy:  v1beta1.JobDeploy{DeployConfig: v1beta1.DeployConfig{CPULimit: "1", MemoryLimit: "1Gi"}},
+		Volume:  v1beta1.PVConfig{Size: "1Ti", StorageClass: &hdd},
+		Ingress: v1beta1.IngressConfig{Annotations: map[string]string{"a": "1", "b": "1"}},
+	}
+	spec := &v1beta1.JobSpec{
+		Template: "rsync",
+		Config: v1beta1.JobConfig{
+			Upstream:     "rsync://a/debian/",
+			AdditionEnvs: []corev1.EnvVar{{Name: "B", Value: "2"}},
+		},
+		Deploy:  v1beta1.JobDeploy{DeployConfig: v1beta1.DeployConfig{MemoryLimit: "2Gi"}},
+		Volume:  v1beta1.PVConfig{Size: "2Ti"},
+		Ingress: v1beta1.IngressConfig{Annotations: map[string]string{"b": "2"}},
+	}
+
+	merged, err := tpl.Merge(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.Template != "rsync" || merged.Config.Upstream != "rsync://a/debian/" || merged.Config.Provider != "rsync" || merged.Config.ExecOnSuccess != "reporter" {
+		t.Errorf("unexpected config %+v", merged.Config)
+	}
+	if len(merged.Config.AdditionEnvs) != 1 || merged.Config.AdditionEnvs[0].Name != "B" {
+		t.Errorf("lists should be replaced, got %+v", merged.Config.AdditionEnvs)
+	}
+	if merged.Deploy.CPULimit != "1" || merged.Deploy.MemoryLimit != "2Gi" {
+		t.Errorf("unexpected deploy %+v", merged.Deploy)
+	}
+	if merged.Volume.Size != "2Ti" || merged.Volume.StorageClass == nil || *merged.Volume.StorageClass != "hdd" {
+		t.Errorf("unexpected volume %+v", merged.Volume)
+	}
+	if merged.Ingress.Annotations["a"] != "1" || merged.Ingress.Annotations["b"] != "2" {
+		t.Errorf("maps should be merged, got %+v", merged.Ingress.Annotations)
+	}
+}
@@ -25,14 +25,20 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	v12 "k8s.io/api/networking/v1"
 	v1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 )
 
+// Config is the controller config read from the environment, the KubesyncConfig
+// of the cluster overrides it at every reconcile
 type Config struct {
 	ManagerImage string
 	WorkerImage  string
@@ -49,6 +55,7 @@ type Config struct {
 	FrontHost    string
 	FrontTLS     string
 	FrontClass   string
+	FrontGateway string
 	FrontAnn     map[string]string
 	EnableMetric bool
 	Debug        bool
@@ -68,6 +75,7 @@ type ManagerReconciler struct {
 // +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles,verbs=get;list;watch;create;update;patch;delete;escalate;bind
 // +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=rolebindings,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
@@ -93,6 +101,11 @@ func (r *ManagerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		return ctrl.Result{}, errors.New("already have one active manager in this namespace")
 	}
 
+	cfg, err := resolveConfig(ctx, r, r.Config)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
 	sa, err := r.desiredSA(&manager)
 	if err != nil {
 		return ctrl.Result{}, err
@@ -108,7 +121,7 @@ func (r *ManagerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		return ctrl.Result{}, err
 	}
 
-	app, err := r.desiredDeployment(&manager)
+	app, err := r.desiredDeployment(cfg, &manager)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
@@ -118,7 +131,7 @@ func (r *ManagerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		return ctrl.Result{}, err
 	}
 
-	ig, err := r.desiredIngress(&manager)
+	ig, err := r.desiredIngress(cfg, &manager)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
@@ -146,13 +159,17 @@ func (r *ManagerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		if err := r.Get(ctx, client.ObjectKey{Name: manager.Name, Namespace: manager.Namespace}, ds); err == nil || ds != nil {
 			r.Delete(ctx, ds)
 		}
-		err = r.Patch(ctx, app, client.Apply, applyOpts...)
+		if err = r.Patch(ctx, app, client.Apply, applyOpts...); err == nil {
+			meta.SetStatusCondition(&manager.Status.Conditions, deploymentCondition(app, manager.Generation))
+		}
 	case *appsv1.DaemonSet:
 		dm := new(appsv1.Deployment)
 		if err := r.Get(ctx, client.ObjectKey{Name: manager.Name, Namespace: manager.Namespace}, dm); err == nil || dm != nil {
 			r.Delete(ctx, dm)
 		}
-		err = r.Patch(ctx, app, client.Apply, applyOpts...)
+		if err = r.Patch(ctx, app, client.Apply, applyOpts...); err == nil {
+			meta.SetStatusCondition(&manager.Status.Conditions, daemonSetCondition(app, manager.Generation))
+		}
 	default:
 		return ctrl.Result{}, err
 	}
@@ -170,8 +187,19 @@ func (r *ManagerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	if err != nil {
 		return ctrl.Result{}, err
 	}
+	routed := routedByHTTPRoute(manager.Status.Conditions)
+	meta.SetStatusCondition(&manager.Status.Conditions, ingressCondition(ig, manager.Generation))
+	if _, ok := ig.(*unstructured.Unstructured); ok {
+		err = deleteIngress(ctx, r.Client, manager.Name, manager.Namespace)
+	} else if routed {
+		err = deleteHTTPRoute(ctx, r.Client, manager.Name, manager.Namespace)
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
 
 	manager.Status.Phase = mirrorv1beta1.DeploySucceeded
+	manager.Status.ObservedGeneration = manager.Generation
 
 	err = r.Status().Update(ctx, &manager)
 	if err != nil {
@@ -191,14 +219,14 @@ func (r *ManagerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	}
 
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&mirrorv1beta1.Manager{}).
-		WithEventFilter(predicate.Funcs{
+		// the status changes of the owned objects update the conditions
+		For(&mirrorv1beta1.Manager{}, builder.WithPredicates(predicate.Funcs{
 			UpdateFunc: func(e event.UpdateEvent) bool {
 				oldGeneration := e.ObjectOld.GetGeneration()
 				newGeneration := e.ObjectNew.GetGeneration()
 				return oldGeneration != newGeneration
 			},
-		}).
+		})).
 		Owns(&corev1.ServiceAccount{}).
 		Owns(&v1.Role{}).
 		Owns(&v1.RoleBinding{}).
@@ -206,5 +234,6 @@ func (r *ManagerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Owns(&appsv1.Deployment{}).
 		Owns(&corev1.Service{}).
 		Owns(&v12.Ingress{}).
+		Watches(&mirrorv1beta1.KubesyncConfig{}, handler.EnqueueRequestsFromMapFunc(requestsForConfig(r, &mirrorv1beta1.ManagerList{}))).
 		Complete(r)
 }
@@ -21,13 +21,14 @@ import (
 	"fmt"
 	"github.com/CQUPTMirror/kubesync/api/v1beta1"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	v12 "k8s.io/api/networking/v1"
 	v1 "k8s.io/api/rbac/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const ManagerPort = 3000
@@ -65,6 +66,11 @@ func (r *ManagerReconciler) desiredRole(manager *v1beta1.Manager) (*v1.Role, err
 				APIGroups: []string{v1beta1.GroupVersion.Group}, Resources: []string{"jobs/status"},
 				Verbs: []string{"get", "patch", "update"},
 			},
+			{
+				// templates are read to merge the jobs over them, only the bundle import writes them
+				APIGroups: []string{v1beta1.GroupVersion.Group}, Resources: []string{"jobtemplates"},
+				Verbs: []string{"create", "get", "list", "patch", "update", "watch"},
+			},
 			{
 				APIGroups: []string{v1beta1.GroupVersion.Group}, Resources: []string{"announcements"},
 				Verbs: []string{"create", "delete", "get", "list", "patch", "update", "watch"},
@@ -81,6 +87,23 @@ func (r *ManagerReconciler) desiredRole(manager *v1beta1.Manager) (*v1.Role, err
 				APIGroups: []string{v1beta1.GroupVersion.Group}, Resources: []string{"files/status"},
 				Verbs: []string{"get", "patch", "update"},
 			},
+			{
+				APIGroups: []string{corev1.GroupName}, Resources: []string{"secrets"},
+				Verbs: []string{"get", "list", "watch"},
+			},
+			{
+				APIGroups: []string{corev1.GroupName}, Resources: []string{"events"},
+				Verbs: []string{"create", "patch"},
+			},
+			// to run and stop the syncs of the jobs in the cronjob sync mode
+			{
+				APIGroups: []string{batchv1.GroupName}, Resources: []string{"cronjobs"},
+				Verbs: []string{"get"},
+			},
+			{
+				APIGroups: []string{batchv1.GroupName}, Resources: []string{"jobs"},
+				Verbs: []string{"create", "delete", "get", "list"},
+			},
 		},
 	}
 
@@ -108,7 +131,7 @@ func (r *ManagerReconciler) desiredRoleBinding(manager *v1beta1.Manager) (*v1.Ro
 	return &roleBinding, nil
 }
 
-func (r *ManagerReconciler) desiredDeployment(manager *v1beta1.Manager) (metav1.Object, error) {
+func (r *ManagerReconciler) desiredDeployment(cfg *Config, manager *v1beta1.Manager) (metav1.Object, error) {
 	deployType := v1beta1.Deployment
 	if manager.Spec.DeployType != "" {
 		deployType = manager.Spec.DeployType
@@ -155,7 +178,7 @@ func (r *ManagerReconciler) desiredDeployment(manager *v1beta1.Manager) (metav1.
 	}
 
 	if manager.Spec.Deploy.Image == "" {
-		podTemplate.Spec.Containers[0].Image = r.Config.ManagerImage
+		podTemplate.Spec.Containers[0].Image = cfg.ManagerImage
 	}
 	if podTemplate.Spec.Containers[0].Image == "" {
 		return nil, nil
@@ -164,35 +187,17 @@ func (r *ManagerReconciler) desiredDeployment(manager *v1beta1.Manager) (metav1.
 	if manager.Spec.Deploy.ImagePullPolicy != "" {
 		podTemplate.Spec.Containers[0].ImagePullPolicy = manager.Spec.Deploy.ImagePullPolicy
 	} else {
-		if r.Config.PullPolicy != "" {
-			podTemplate.Spec.Containers[0].ImagePullPolicy = corev1.PullPolicy(r.Config.PullPolicy)
-		}
-	}
-	if manager.Spec.Deploy.MemoryLimit != "" || manager.Spec.Deploy.CPULimit != "" {
-		podTemplate.Spec.Containers[0].Resources = corev1.ResourceRequirements{Limits: corev1.ResourceList{}}
-		if manager.Spec.Deploy.MemoryLimit != "" {
-			podTemplate.Spec.Containers[0].Resources.Limits[corev1.ResourceLimitsMemory] = resource.MustParse(manager.Spec.Deploy.MemoryLimit)
-		}
-		if manager.Spec.Deploy.CPULimit != "" {
-			podTemplate.Spec.Containers[0].Resources.Limits[corev1.ResourceLimitsCPU] = resource.MustParse(manager.Spec.Deploy.CPULimit)
-		}
-	}
-	if manager.Spec.Deploy.ImagePullSecrets != nil {
-		podTemplate.Spec.ImagePullSecrets = manager.Spec.Deploy.ImagePullSecrets
-	} else {
-		if r.Config.PullSecret != "" {
-			podTemplate.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: r.Config.PullSecret}}
+		if cfg.PullPolicy != "" {
+			podTemplate.Spec.Containers[0].ImagePullPolicy = corev1.PullPolicy(cfg.PullPolicy)
 		}
 	}
-	if manager.Spec.Deploy.NodeName != "" {
-		podTemplate.Spec.NodeName = manager.Spec.Deploy.NodeName
-	}
-	if manager.Spec.Deploy.Affinity != nil {
-		podTemplate.Spec.Affinity = manager.Spec.Deploy.Affinity
-	}
-	if manager.Spec.Deploy.Tolerations != nil {
-		podTemplate.Spec.Tolerations = manager.Spec.Deploy.Tolerations
+	resources, err := deployResources(&manager.Spec.Deploy)
+	if err != nil {
+		return nil, err
 	}
+	podTemplate.Spec.Containers[0].Resources = resources
+	podTemplate.Spec.Containers[0].VolumeMounts = manager.Spec.Deploy.VolumeMounts
+	applyDeployConfig(cfg, &manager.Spec.Deploy, &podTemplate.Spec)
 
 	var app metav1.Object
 
@@ -218,7 +223,7 @@ func (r *ManagerReconciler) desiredDeployment(manager *v1beta1.Manager) (metav1.
 	default:
 		return nil, nil
 	}
-	err := ctrl.SetControllerReference(manager, app, r.Scheme)
+	err = ctrl.SetControllerReference(manager, app, r.Scheme)
 	return app, err
 }
 
@@ -245,9 +250,26 @@ func (r *ManagerReconciler) desiredService(manager *v1beta1.Manager) (*corev1.Se
 	return &svc, nil
 }
 
-func (r *ManagerReconciler) desiredIngress(manager *v1beta1.Manager) (*v12.Ingress, error) {
+// managerPublicPaths are the api paths of the manager exposed to the public
+var managerPublicPaths = []string{"/api/mirrors", "/api/news", "/api/files", "/api/mirrorz.json", "/api/events"}
+
+// desiredIngress returns the Ingress of the public api, or the HTTPRoute if routes are used
+func (r *ManagerReconciler) desiredIngress(cfg *Config, manager *v1beta1.Manager) (client.Object, error) {
+	if useHTTPRoute(cfg, &manager.Spec.Ingress) {
+		route, err := desiredHTTPRoute(cfg, &manager.Spec.Ingress,
+			metav1.ObjectMeta{Name: manager.Name, Namespace: manager.Namespace, Labels: map[string]string{"manager": manager.Name}},
+			routeBackend{service: manager.Name, port: ManagerPort, paths: managerPublicPaths, pathMatch: PathMatchExact})
+		if err != nil {
+			return nil, err
+		}
+		if err := ctrl.SetControllerReference(manager, route, r.Scheme); err != nil {
+			return route, err
+		}
+		return route, nil
+	}
+
 	annotations := make(map[string]string)
-	for k, v := range r.Config.FrontAnn {
+	for k, v := range cfg.FrontAnn {
 		annotations[k] = v
 	}
 	for k, v := range manager.Spec.Ingress.Annotations {
@@ -270,46 +292,37 @@ func (r *ManagerReconciler) desiredIngress(manager *v1beta1.Manager) (*v12.Ingre
 			Labels:      map[string]string{"manager": manager.Name},
 			Annotations: annotations,
 		},
-		Spec: v12.IngressSpec{
-			Rules: []v12.IngressRule{
-				{
-					IngressRuleValue: v12.IngressRuleValue{
-						HTTP: &v12.HTTPIngressRuleValue{
-							Paths: []v12.HTTPIngressPath{
-								{Path: "/api/mirrors", PathType: &pathType, Backend: svc},
-								{Path: "/api/news", PathType: &pathType, Backend: svc},
-								{Path: "/api/files", PathType: &pathType, Backend: svc},
-								{Path: "/api/mirrorz.json", PathType: &pathType, Backend: svc},
-							},
-						},
-					},
-				},
-			},
-		},
+	}
+	var paths []v12.HTTPIngressPath
+	for _, p := range managerPublicPaths {
+		paths = append(paths, v12.HTTPIngressPath{Path: p, PathType: &pathType, Backend: svc})
+	}
+	hosts := ingressHosts(cfg, &manager.Spec.Ingress)
+	if len(hosts) == 0 {
+		hosts = []string{""}
+	}
+	for _, h := range hosts {
+		ig.Spec.Rules = append(ig.Spec.Rules, v12.IngressRule{
+			Host:             h,
+			IngressRuleValue: v12.IngressRuleValue{HTTP: &v12.HTTPIngressRuleValue{Paths: paths}},
+		})
 	}
 
-	if r.Config.FrontClass != "" || manager.Spec.Ingress.IngressClass != "" {
-		ig.Spec.IngressClassName = &r.Config.FrontClass
+	if cfg.FrontClass != "" || manager.Spec.Ingress.IngressClass != "" {
+		ig.Spec.IngressClassName = &cfg.FrontClass
 		if manager.Spec.Ingress.IngressClass != "" {
 			ig.Spec.IngressClassName = &manager.Spec.Ingress.IngressClass
 		}
 	}
 
-	if r.Config.FrontTLS != "" || manager.Spec.Ingress.TLSSecret != "" {
-		secretName := r.Config.FrontTLS
+	if cfg.FrontTLS != "" || manager.Spec.Ingress.TLSSecret != "" {
+		secretName := cfg.FrontTLS
 		if manager.Spec.Ingress.TLSSecret != "" {
 			secretName = manager.Spec.Ingress.TLSSecret
 		}
 		ig.Spec.TLS = []v12.IngressTLS{{SecretName: secretName}}
 	}
 
-	if r.Config.FrontHost != "" || manager.Spec.Ingress.Host != "" {
-		ig.Spec.Rules[0].Host = r.Config.FrontHost
-		if manager.Spec.Ingress.Host != "" {
-			ig.Spec.Rules[0].Host = manager.Spec.Ingress.Host
-		}
-	}
-
 	if err := ctrl.SetControllerReference(manager, &ig, r.Scheme); err != nil {
 		return &ig, err
 	}
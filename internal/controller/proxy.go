@@ -0,0 +1,151 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+	"github.com/CQUPTMirror/kubesync/internal"
+)
+
+// ProxyProvider is the worker provider running the caching reverse proxy of proxy jobs
+const ProxyProvider = "proxy"
+
+// defaultCacheRatio is the part of the volume the cache of a proxy job takes if no cache size is set
+const defaultCacheRatio = 0.9
+
+// proxyCacheSize returns the cache size of a proxy job in bytes
+func proxyCacheSize(job *v1beta1.Job) (int64, error) {
+	if job.Spec.Proxy.CacheSize != "" {
+		q, err := resource.ParseQuantity(job.Spec.Proxy.CacheSize)
+		if err != nil {
+			return 0, fmt.Errorf("invalid cache size: %w", err)
+		}
+		return q.Value(), nil
+	}
+	size := job.Spec.Volume.Size
+	if size == "" {
+		size = v1beta1.DefaultVolumeSize
+	}
+	q, err := resource.ParseQuantity(size)
+	if err != nil {
+		return 0, fmt.Errorf("invalid volume size: %w", err)
+	}
+	return int64(float64(q.Value()) * defaultCacheRatio), nil
+}
+
+// proxyRules renders the cache rules of a proxy job as path=ttl pairs split by ';'
+func proxyRules(job *v1beta1.Job) (string, error) {
+	if job.Spec.Proxy.TTL != "" {
+		if _, err := time.ParseDuration(job.Spec.Proxy.TTL); err != nil {
+			return "", fmt.Errorf("invalid proxy ttl: %w", err)
+		}
+	}
+	rules := make([]string, 0, len(job.Spec.Proxy.Rules))
+	for _, rule := range job.Spec.Proxy.Rules {
+		if rule.Path == "" || strings.ContainsAny(rule.Path, "=;") {
+			return "", fmt.Errorf("invalid proxy rule path %q", rule.Path)
+		}
+		if _, err := time.ParseDuration(rule.TTL); err != nil {
+			return "", fmt.Errorf("invalid ttl of proxy rule %s: %w", rule.Path, err)
+		}
+		rules = append(rules, rule.Path+"="+rule.TTL)
+	}
+	return strings.Join(rules, ";"), nil
+}
+
+// proxyContainer returns the worker container running the proxy of a proxy job,
+// it serves the front port itself so the job has no front and rsync containers
+func proxyContainer(cfg *Config, job *v1beta1.Job, manager string, pullPolicy corev1.PullPolicy) (*corev1.Container, error) {
+	cacheSize, err := proxyCacheSize(job)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := proxyRules(job)
+	if err != nil {
+		return nil, err
+	}
+
+	env := []corev1.EnvVar{
+		{Name: "NAME", Value: job.Name},
+		{Name: "PROVIDER", Value: ProxyProvider},
+		{Name: "UPSTREAM", Value: job.Spec.Config.Upstream},
+		{Name: "API", Value: fmt.Sprintf("http://%s:3000", manager)},
+		{Name: "ADDR", Value: fmt.Sprintf(":%d", ApiPort)},
+		{Name: "TOKEN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: tokenSecretName(job.Name)},
+			Key:                  internal.TokenKey,
+		}}},
+		{Name: "PROXY_ADDR", Value: fmt.Sprintf(":%d", FrontPort)},
+		{Name: "PROXY_PATHS", Value: strings.Join(job.PublicPaths(), ";")},
+		{Name: "PROXY_CACHE_SIZE", Value: strconv.FormatInt(cacheSize, 10)},
+		{Name: "PROXY_TTL", Value: job.Spec.Proxy.TTL},
+		{Name: "PROXY_RULES", Value: rules},
+	}
+	if cfg.EnableMetric {
+		env = append(env, corev1.EnvVar{Name: "METRICS_ADDR", Value: fmt.Sprintf(":%d", MetricPort)})
+	}
+	env = append(env, job.Spec.Deploy.Env...)
+	env = append(env, job.Spec.Config.AdditionEnvs...)
+	if job.Spec.Config.Debug != "" || cfg.Debug {
+		env = append(env, corev1.EnvVar{Name: "DEBUG", Value: "true"})
+	}
+
+	probe := &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt32(FrontPort)},
+		},
+		InitialDelaySeconds: 10,
+		TimeoutSeconds:      5,
+		PeriodSeconds:       30,
+		SuccessThreshold:    1,
+		FailureThreshold:    5,
+	}
+	container := &corev1.Container{
+		Name:            job.Name,
+		Image:           job.Spec.Deploy.Image,
+		ImagePullPolicy: pullPolicy,
+		Env:             env,
+		LivenessProbe:   probe,
+		ReadinessProbe:  healthzProbe(),
+		VolumeMounts:    []corev1.VolumeMount{dataMount(job)},
+		Ports: []corev1.ContainerPort{
+			{ContainerPort: ApiPort, Name: "api", Protocol: "TCP"},
+			{ContainerPort: FrontPort, Name: "front", Protocol: "TCP"},
+		},
+	}
+	if container.Image == "" {
+		container.Image = cfg.WorkerImage
+	}
+	if cfg.EnableMetric {
+		container.Ports = append(container.Ports, corev1.ContainerPort{ContainerPort: MetricPort, Name: "metrics", Protocol: "TCP"})
+	}
+	if container.Resources, err = deployResources(&job.Spec.Deploy.DeployConfig); err != nil {
+		return nil, err
+	}
+	container.VolumeMounts = append(container.VolumeMounts, job.Spec.Deploy.VolumeMounts...)
+	return container, nil
+}
@@ -0,0 +1,86 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+func TestProxyDeployment(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	r := &JobReconciler{Scheme: scheme}
+	job := &v1beta1.Job{ObjectMeta: metav1.ObjectMeta{Name: "npm", Namespace: "mirror"}}
+	job.Spec.Config.Type = v1beta1.Proxy
+	job.Spec.Config.Upstream = "https://registry.npmjs.org"
+	job.Spec.Volume.Size = "10Gi"
+	job.Spec.Proxy.Rules = []v1beta1.ProxyCacheRule{{Path: "*.tgz", TTL: "720h"}, {Path: "/-/*", TTL: "0"}}
+	cfg := &Config{WorkerImage: "worker", FrontMode: "caddy", RsyncImage: "rsync", EnableMetric: true}
+
+	disableFront, disableRsync, _, _, _, _, _ := r.checkRsyncFront(cfg, job)
+	if disableFront || !disableRsync {
+		t.Fatalf("proxy jobs should serve the front without rsync, got %v %v", disableFront, disableRsync)
+	}
+	if cm, err := r.desiredFrontConfigmap(cfg, job); err != nil || cm != nil {
+		t.Fatalf("proxy jobs have no front config, got %v %v", cm, err)
+	}
+
+	app, err := r.desiredDeployment(cfg, job, "manager", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	containers := app.Spec.Template.Spec.Containers
+	if len(containers) != 1 {
+		t.Fatalf("expected only the proxy container, got %d", len(containers))
+	}
+	env := make(map[string]string)
+	for _, e := range containers[0].Env {
+		env[e.Name] = e.Value
+	}
+	want := map[string]string{
+		"PROVIDER":         ProxyProvider,
+		"PROXY_PATHS":      "/npm",
+		"PROXY_CACHE_SIZE": "9663676416",
+		"PROXY_RULES":      "*.tgz=720h;/-/*=0",
+		"METRICS_ADDR":     ":2019",
+	}
+	for k, v := range want {
+		if env[k] != v {
+			t.Errorf("env %s is %q, expected %q", k, env[k], v)
+		}
+	}
+	if len(containers[0].Ports) != 3 || containers[0].Ports[1].Name != "front" {
+		t.Errorf("unexpected ports %v", containers[0].Ports)
+	}
+
+	job.Spec.Proxy.CacheSize = "1Gi"
+	if size, err := proxyCacheSize(job); err != nil || size != 1<<30 {
+		t.Errorf("unexpected cache size %d %v", size, err)
+	}
+	job.Spec.Proxy.Rules = []v1beta1.ProxyCacheRule{{Path: "*.tgz", TTL: "a month"}}
+	if _, err := r.desiredDeployment(cfg, job, "manager", nil, nil); err == nil {
+		t.Error("invalid ttl should fail")
+	}
+}
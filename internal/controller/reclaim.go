@@ -0,0 +1,187 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+// VolumeSnapshotGVK is the CSI VolumeSnapshot, built unstructured like the HTTPRoute
+// so the controller runs on clusters without the snapshot CRDs
+var VolumeSnapshotGVK = schema.GroupVersionKind{Group: "snapshot.storage.k8s.io", Version: "v1", Kind: "VolumeSnapshot"}
+
+// snapshotPollInterval is how often a deleted job checks if the snapshot of its PVC is taken
+const snapshotPollInterval = 10 * time.Second
+
+// needsVolumeFinalizer tells if the PVC of a job has to be retained or snapshotted when the job is deleted
+func needsVolumeFinalizer(job *v1beta1.Job) bool {
+	policy := job.Spec.Volume.ReclaimPolicy
+	return !job.Spec.Volume.Shared() && (policy == v1beta1.ReclaimRetain || policy == v1beta1.ReclaimSnapshot)
+}
+
+// syncVolumeFinalizer adds or removes the volume finalizer by the reclaim policy of job. The finalizer is
+// patched on orig, the job as stored, since job holds the spec merged with its template
+func (r *JobReconciler) syncVolumeFinalizer(ctx context.Context, orig, job *v1beta1.Job) error {
+	if needsVolumeFinalizer(job) == controllerutil.ContainsFinalizer(orig, VolumeFinalizer) {
+		return nil
+	}
+	patch := client.MergeFromWithOptions(orig.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	if needsVolumeFinalizer(job) {
+		controllerutil.AddFinalizer(orig, VolumeFinalizer)
+	} else {
+		controllerutil.RemoveFinalizer(orig, VolumeFinalizer)
+	}
+	if err := r.Patch(ctx, orig, patch); err != nil {
+		return err
+	}
+	job.ResourceVersion = orig.ResourceVersion
+	return nil
+}
+
+// reclaimVolume applies the reclaim policy to the PVC of a deleted job, then lets the job go.
+// Delete leaves the PVC to the garbage collector
+func (r *JobReconciler) reclaimVolume(ctx context.Context, orig, job *v1beta1.Job) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(orig, VolumeFinalizer) {
+		return ctrl.Result{}, nil
+	}
+	if !job.Spec.Volume.Shared() {
+		var err error
+		taken := true
+		switch job.Spec.Volume.ReclaimPolicy {
+		case v1beta1.ReclaimRetain:
+			err = r.retainVolume(ctx, job)
+		case v1beta1.ReclaimSnapshot:
+			taken, err = r.snapshotVolume(ctx, job)
+		}
+		if err != nil {
+			if r.Recorder != nil {
+				r.Recorder.Eventf(job, corev1.EventTypeWarning, "ReclaimFailed", "failed to %s the volume: %s", job.Spec.Volume.ReclaimPolicy, err.Error())
+			}
+			return ctrl.Result{}, err
+		}
+		// the garbage collector deletes the PVC once the finalizer is gone, and the snapshot
+		// controller refuses to snapshot a PVC being deleted
+		if !taken {
+			return ctrl.Result{RequeueAfter: snapshotPollInterval}, nil
+		}
+	}
+	patch := client.MergeFromWithOptions(orig.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	controllerutil.RemoveFinalizer(orig, VolumeFinalizer)
+	return ctrl.Result{}, r.Patch(ctx, orig, patch)
+}
+
+// retainVolume orphans the PVC of a job and labels it, so a new job of the same name or with volumeRef set adopts it
+func (r *JobReconciler) retainVolume(ctx context.Context, job *v1beta1.Job) error {
+	pvc := new(corev1.PersistentVolumeClaim)
+	if err := r.Get(ctx, client.ObjectKey{Name: job.ClaimName(), Namespace: job.Namespace}, pvc); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	patch := client.MergeFrom(pvc.DeepCopy())
+	owners := pvc.OwnerReferences[:0]
+	for _, ref := range pvc.OwnerReferences {
+		if ref.UID != job.UID {
+			owners = append(owners, ref)
+		}
+	}
+	pvc.OwnerReferences = owners
+	if pvc.Labels == nil {
+		pvc.Labels = make(map[string]string)
+	}
+	pvc.Labels[RetainedLabel] = job.Name
+	if err := r.Patch(ctx, pvc, patch); err != nil {
+		return err
+	}
+	if r.Recorder != nil {
+		r.Recorder.Eventf(job, corev1.EventTypeNormal, "VolumeRetained", "retained PVC %s", pvc.Name)
+	}
+	return nil
+}
+
+// snapshotVolume takes a VolumeSnapshot of the PVC of a job before the garbage collector deletes it, and tells
+// if the snapshot is taken. It is once the snapshot is bound to its content, from then on the snapshot
+// controller keeps the PVC until its data is copied
+func (r *JobReconciler) snapshotVolume(ctx context.Context, job *v1beta1.Job) (bool, error) {
+	pvc := new(corev1.PersistentVolumeClaim)
+	if err := r.Get(ctx, client.ObjectKey{Name: job.ClaimName(), Namespace: job.Namespace}, pvc); err != nil {
+		return true, client.IgnoreNotFound(err)
+	}
+	snapshot := new(unstructured.Unstructured)
+	snapshot.SetGroupVersionKind(VolumeSnapshotGVK)
+	// named after the uid of the job, so retries do not take more snapshots
+	key := client.ObjectKey{Name: fmt.Sprintf("%s-%s", pvc.Name, string(job.UID)[:8]), Namespace: job.Namespace}
+	err := r.Get(ctx, key, snapshot)
+	if err == nil {
+		content, _, _ := unstructured.NestedString(snapshot.Object, "status", "boundVolumeSnapshotContentName")
+		ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse")
+		return content != "" || ready, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return false, err
+	}
+
+	snapshot.SetName(key.Name)
+	snapshot.SetNamespace(key.Namespace)
+	snapshot.SetLabels(map[string]string{RetainedLabel: job.Name})
+	spec := map[string]interface{}{
+		"source": map[string]interface{}{"persistentVolumeClaimName": pvc.Name},
+	}
+	if class := job.Spec.Volume.SnapshotClass; class != nil {
+		spec["volumeSnapshotClassName"] = *class
+	}
+	snapshot.Object["spec"] = spec
+	if err := r.Create(ctx, snapshot); err != nil {
+		return false, client.IgnoreAlreadyExists(err)
+	}
+	if r.Recorder != nil {
+		r.Recorder.Eventf(job, corev1.EventTypeNormal, "VolumeSnapshotted", "took VolumeSnapshot %s of PVC %s", snapshot.GetName(), pvc.Name)
+	}
+	return false, nil
+}
+
+// adoptVolume clears the retained label of a PVC a job has taken over
+func (r *JobReconciler) adoptVolume(ctx context.Context, job *v1beta1.Job, pvc *corev1.PersistentVolumeClaim) error {
+	current := new(corev1.PersistentVolumeClaim)
+	if err := r.Get(ctx, client.ObjectKeyFromObject(pvc), current); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	from, ok := current.Labels[RetainedLabel]
+	if !ok {
+		return nil
+	}
+	patch := client.MergeFrom(current.DeepCopy())
+	delete(current.Labels, RetainedLabel)
+	if err := r.Patch(ctx, current, patch); err != nil {
+		return err
+	}
+	if r.Recorder != nil {
+		r.Recorder.Eventf(job, corev1.EventTypeNormal, "VolumeAdopted", "adopted PVC %s retained from job %s", current.Name, from)
+	}
+	return nil
+}
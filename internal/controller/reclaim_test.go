@@ -0,0 +1,148 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+func reclaimScheme(t *testing.T) *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return scheme
+}
+
+func TestRetainVolume(t *testing.T) {
+	scheme := reclaimScheme(t)
+	ctx := context.Background()
+	job := &v1beta1.Job{ObjectMeta: metav1.ObjectMeta{Name: "debian", Namespace: "mirror", UID: "0123456789"}}
+	job.Spec.Volume.ReclaimPolicy = v1beta1.ReclaimRetain
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+		Name:            "debian",
+		Namespace:       "mirror",
+		OwnerReferences: []metav1.OwnerReference{{APIVersion: "mirror.redrock.team/v1beta1", Kind: "Job", Name: "debian", UID: job.UID}},
+	}}
+	r := &JobReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(job, pvc).Build(), Scheme: scheme}
+
+	orig := job.DeepCopy()
+	if err := r.syncVolumeFinalizer(ctx, orig, job); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(job), orig); err != nil || len(orig.Finalizers) != 1 {
+		t.Fatalf("expected the volume finalizer, got %v %v", orig.Finalizers, err)
+	}
+
+	if err := r.Delete(ctx, orig); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(job), orig); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.reclaimVolume(ctx, orig, orig.DeepCopy()); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(job), orig); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the job gone, got %v", err)
+	}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(pvc), pvc); err != nil {
+		t.Fatal(err)
+	}
+	if len(pvc.OwnerReferences) != 0 || pvc.Labels[RetainedLabel] != "debian" {
+		t.Errorf("expected the PVC orphaned and labeled, got %+v", pvc.ObjectMeta)
+	}
+
+	if err := r.adoptVolume(ctx, job, pvc); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(pvc), pvc); err != nil || pvc.Labels[RetainedLabel] != "" {
+		t.Errorf("expected the retained label cleared, got %v %v", pvc.Labels, err)
+	}
+}
+
+func TestSnapshotVolume(t *testing.T) {
+	scheme := reclaimScheme(t)
+	ctx := context.Background()
+	class := "zfs"
+	job := &v1beta1.Job{ObjectMeta: metav1.ObjectMeta{Name: "debian", Namespace: "mirror", UID: "0123456789", Finalizers: []string{VolumeFinalizer}}}
+	job.Spec.Volume = v1beta1.PVConfig{ReclaimPolicy: v1beta1.ReclaimSnapshot, SnapshotClass: &class, VolumeRef: "debian-old"}
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "debian-old", Namespace: "mirror"}}
+	r := &JobReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(job, pvc).Build(), Scheme: scheme}
+	if err := r.Delete(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(job), job); err != nil {
+		t.Fatal(err)
+	}
+
+	// retried until the snapshot is bound, so it takes the snapshot once and keeps the finalizer meanwhile
+	for i := 0; i < 2; i++ {
+		result, err := r.reclaimVolume(ctx, job, job.DeepCopy())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.RequeueAfter == 0 || !controllerutil.ContainsFinalizer(job, VolumeFinalizer) {
+			t.Fatalf("expected the job kept until the snapshot is taken, got %v %v", result, job.Finalizers)
+		}
+	}
+	snapshot := new(unstructured.Unstructured)
+	snapshot.SetGroupVersionKind(VolumeSnapshotGVK)
+	if err := r.Get(ctx, client.ObjectKey{Name: "debian-old-01234567", Namespace: "mirror"}, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	source, _, _ := unstructured.NestedString(snapshot.Object, "spec", "source", "persistentVolumeClaimName")
+	snapshotClass, _, _ := unstructured.NestedString(snapshot.Object, "spec", "volumeSnapshotClassName")
+	if source != "debian-old" || snapshotClass != "zfs" || snapshot.GetLabels()[RetainedLabel] != "debian" {
+		t.Errorf("unexpected snapshot %v", snapshot.Object)
+	}
+
+	if err := unstructured.SetNestedField(snapshot.Object, "snapcontent-0123", "status", "boundVolumeSnapshotContentName"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Update(ctx, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := r.reclaimVolume(ctx, job, job.DeepCopy()); err != nil || result.RequeueAfter != 0 {
+		t.Fatalf("unexpected result %v %v", result, err)
+	}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(job), job); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the job gone once the snapshot is bound, got %v", err)
+	}
+
+	job.Spec.Volume.HostPath = "/tank/mirror"
+	if needsVolumeFinalizer(job) {
+		t.Error("jobs on a shared volume have no PVC to reclaim")
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+const (
+	RsyncdConfigPath = "/etc/rsyncd.conf"
+	RsyncdMotdPath   = "/etc/rsyncd.motd"
+
+	defaultRsyncdTimeout = 600
+)
+
+// renderRsyncd returns the rsyncd.conf of the job, serving the mirror path as one module
+func renderRsyncd(job *v1beta1.Job) (string, error) {
+	opts := &job.Spec.Deploy.Rsyncd
+	readOnly := true
+	if opts.ReadOnly != "" {
+		var err error
+		if readOnly, err = strconv.ParseBool(opts.ReadOnly); err != nil {
+			return "", fmt.Errorf("invalid rsyncd readOnly: %w", err)
+		}
+	}
+	module := opts.Module
+	if module == "" {
+		module = job.Name
+	}
+	comment := opts.Comment
+	if comment == "" {
+		comment = job.Spec.Config.Desc
+	}
+	path := job.Spec.Config.MirrorPath
+	if path == "" {
+		path = "/data/" + job.Name
+	}
+	// the module of a job serving its shared volume holds the directories of every job on it
+	if serveAll(job) {
+		path = "/data"
+	}
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = defaultRsyncdTimeout
+	}
+	// a ] would close the module header, any newline would start a new parameter
+	if strings.ContainsAny(module, "\n]") {
+		return "", fmt.Errorf("invalid rsyncd module %q", module)
+	}
+	for _, v := range []string{comment, path} {
+		if strings.Contains(v, "\n") {
+			return "", fmt.Errorf("invalid rsyncd value %q", v)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("use chroot = no\n")
+	b.WriteString("reverse lookup = no\n")
+	b.WriteString("log file = /dev/stdout\n")
+	fmt.Fprintf(&b, "max connections = %d\n", opts.MaxConnections)
+	fmt.Fprintf(&b, "timeout = %d\n", timeout)
+	if opts.Motd != "" {
+		fmt.Fprintf(&b, "motd file = %s\n", RsyncdMotdPath)
+	}
+	fmt.Fprintf(&b, "\n[%s]\n", module)
+	fmt.Fprintf(&b, "path = %s\n", path)
+	if comment != "" {
+		fmt.Fprintf(&b, "comment = %s\n", comment)
+	}
+	fmt.Fprintf(&b, "read only = %s\n", yesNo(readOnly))
+	b.WriteString("list = yes\n")
+	if len(opts.HostsAllow) > 0 {
+		fmt.Fprintf(&b, "hosts allow = %s\n", strings.Join(opts.HostsAllow, " "))
+	}
+	if len(opts.HostsDeny) > 0 {
+		fmt.Fprintf(&b, "hosts deny = %s\n", strings.Join(opts.HostsDeny, " "))
+	}
+	return b.String(), nil
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
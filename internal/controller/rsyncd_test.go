@@ -0,0 +1,80 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+func TestRenderRsyncd(t *testing.T) {
+	job := &v1beta1.Job{ObjectMeta: metav1.ObjectMeta{Name: "debian"}}
+	job.Spec.Config.Desc = "Debian GNU/Linux"
+	conf, err := renderRsyncd(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"timeout = 600", "[debian]", "path = /data/debian", "comment = Debian GNU/Linux", "read only = yes"} {
+		if !strings.Contains(conf, line+"\n") {
+			t.Errorf("missing %q in\n%s", line, conf)
+		}
+	}
+	if strings.Contains(conf, "motd file") || strings.Contains(conf, "hosts allow") {
+		t.Errorf("unexpected options in\n%s", conf)
+	}
+
+	job.Spec.Config.MirrorPath = "/data/debian/debian"
+	job.Spec.Deploy.Rsyncd = v1beta1.RsyncdOptions{
+		Module:         "debian-archive",
+		MaxConnections: 20,
+		HostsAllow:     []string{"10.0.0.0/8", "172.16.0.0/12"},
+		HostsDeny:      []string{"*"},
+		Motd:           "welcome",
+		Timeout:        300,
+		ReadOnly:       "false",
+	}
+	conf, err = renderRsyncd(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"max connections = 20", "timeout = 300", "motd file = " + RsyncdMotdPath, "[debian-archive]",
+		"path = /data/debian/debian", "read only = no", "hosts allow = 10.0.0.0/8 172.16.0.0/12", "hosts deny = *"} {
+		if !strings.Contains(conf, line+"\n") {
+			t.Errorf("missing %q in\n%s", line, conf)
+		}
+	}
+
+	job.Spec.Deploy.Rsyncd.Module = "a]\n[b"
+	if _, err := renderRsyncd(job); err == nil {
+		t.Error("module breaking the config should fail")
+	}
+
+	job.Spec.Deploy.Rsyncd.Module = ""
+	job.Spec.Config.Desc = "Debian [stable]"
+	conf, err = renderRsyncd(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(conf, "comment = Debian [stable]\n") {
+		t.Errorf("missing comment in\n%s", conf)
+	}
+}
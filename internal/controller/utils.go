@@ -17,3 +17,7 @@ func serviceName(jobName string) string {
 	// add an environment variable "KUBERNETES_SERVICE_HOST" to the pod, which the environment points to kubernetes api server by default.
 	return "mirror-" + jobName
 }
+
+func tokenSecretName(jobName string) string {
+	return jobName + "-token"
+}
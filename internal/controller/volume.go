@@ -0,0 +1,64 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+// dataVolume returns the volume holding the data of a job, its own PVC or a volume shared with other jobs
+func dataVolume(job *v1beta1.Job) corev1.Volume {
+	volume := corev1.Volume{Name: job.Name}
+	switch {
+	case job.Spec.Volume.SharedClaim != "":
+		volume.PersistentVolumeClaim = &corev1.PersistentVolumeClaimVolumeSource{ClaimName: job.Spec.Volume.SharedClaim}
+	case job.Spec.Volume.HostPath != "":
+		hostPathType := corev1.HostPathDirectoryOrCreate
+		volume.HostPath = &corev1.HostPathVolumeSource{Path: job.Spec.Volume.HostPath, Type: &hostPathType}
+	default:
+		volume.PersistentVolumeClaim = &corev1.PersistentVolumeClaimVolumeSource{ClaimName: job.ClaimName()}
+	}
+	return volume
+}
+
+// dataMount mounts the data of a job at /data/<job>, the subdirectory of the job on a shared volume
+func dataMount(job *v1beta1.Job) corev1.VolumeMount {
+	mount := corev1.VolumeMount{Name: job.Name, MountPath: "/data/" + job.Name}
+	if job.Spec.Volume.Shared() {
+		mount.SubPath = job.Name
+	}
+	return mount
+}
+
+// serveAll tells if the front and rsync of a job serve every job on its shared volume
+func serveAll(job *v1beta1.Job) bool {
+	s, _ := strconv.ParseBool(job.Spec.Volume.ServeAll)
+	return s && job.Spec.Volume.Shared()
+}
+
+// serveMount mounts the data the front and rsync of a job serve, the whole shared volume at /data if serveAll
+func serveMount(job *v1beta1.Job) corev1.VolumeMount {
+	if serveAll(job) {
+		return corev1.VolumeMount{Name: job.Name, MountPath: "/data", ReadOnly: true}
+	}
+	return dataMount(job)
+}
@@ -0,0 +1,74 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+func TestSharedVolume(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	r := &JobReconciler{Scheme: scheme}
+	job := &v1beta1.Job{ObjectMeta: metav1.ObjectMeta{Name: "debian", Namespace: "mirror"}}
+	job.Spec.Config.Upstream = "rsync://mirrors.tuna.tsinghua.edu.cn/debian/"
+	cfg := &Config{WorkerImage: "worker", FrontMode: "caddy", FrontImage: "caddy", RsyncImage: "rsync"}
+
+	if v := dataVolume(job); v.PersistentVolumeClaim == nil || v.PersistentVolumeClaim.ClaimName != "debian" {
+		t.Errorf("unexpected volume %+v", v)
+	}
+	if m := dataMount(job); m.SubPath != "" || m.MountPath != "/data/debian" {
+		t.Errorf("unexpected mount %+v", m)
+	}
+
+	job.Spec.Volume.HostPath = "/tank/mirror"
+	job.Spec.Volume.ServeAll = "true"
+	if pvc, err := r.desiredPersistentVolumeClaim(cfg, job); pvc != nil || err != nil {
+		t.Errorf("expected no PVC on a shared volume, got %v %v", pvc, err)
+	}
+	app, err := r.desiredDeployment(cfg, job, "manager", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := app.Spec.Template.Spec
+	if len(spec.Volumes) != 1 || spec.Volumes[0].HostPath == nil || spec.Volumes[0].HostPath.Path != "/tank/mirror" {
+		t.Errorf("unexpected volumes %+v", spec.Volumes)
+	}
+	worker, front, rsync := spec.Containers[0].VolumeMounts[0], spec.Containers[1].VolumeMounts[0], spec.Containers[2].VolumeMounts[0]
+	if worker.SubPath != "debian" || worker.MountPath != "/data/debian" {
+		t.Errorf("unexpected worker mount %+v", worker)
+	}
+	if front.SubPath != "" || front.MountPath != "/data" || !front.ReadOnly || rsync.MountPath != "/data" {
+		t.Errorf("unexpected front and rsync mounts %+v %+v", front, rsync)
+	}
+
+	job.Spec.Volume = v1beta1.PVConfig{SharedClaim: "pool"}
+	if v := dataVolume(job); v.PersistentVolumeClaim == nil || v.PersistentVolumeClaim.ClaimName != "pool" {
+		t.Errorf("unexpected volume %+v", v)
+	}
+	if m := serveMount(job); m.SubPath != "debian" || m.MountPath != "/data/debian" {
+		t.Errorf("unexpected front mount %+v", m)
+	}
+}
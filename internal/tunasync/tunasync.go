@@ -0,0 +1,334 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package tunasync translates the mirrors of a tunasync worker.conf into jobs
+package tunasync
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-units"
+	"github.com/pelletier/go-toml/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+	"github.com/CQUPTMirror/kubesync/internal"
+)
+
+// Global is the [global] section of worker.conf
+type Global struct {
+	Name          string   `toml:"name"`
+	LogDir        string   `toml:"log_dir"`
+	MirrorDir     string   `toml:"mirror_dir"`
+	Concurrent    int      `toml:"concurrent"`
+	Interval      int      `toml:"interval"`
+	Retry         int      `toml:"retry"`
+	Timeout       int      `toml:"timeout"`
+	ExecOnSuccess []string `toml:"exec_on_success"`
+	ExecOnFailure []string `toml:"exec_on_failure"`
+}
+
+// Mirror is one [[mirrors]] block of worker.conf
+type Mirror struct {
+	Name         string            `toml:"name"`
+	Provider     string            `toml:"provider"`
+	Upstream     string            `toml:"upstream"`
+	Interval     int               `toml:"interval"`
+	Retry        int               `toml:"retry"`
+	Timeout      int               `toml:"timeout"`
+	MirrorDir    string            `toml:"mirror_dir"`
+	MirrorSubDir string            `toml:"mirror_subdir"`
+	LogDir       string            `toml:"log_dir"`
+	Env          map[string]string `toml:"env"`
+	Role         string            `toml:"role"`
+
+	ExecOnSuccess      []string `toml:"exec_on_success"`
+	ExecOnFailure      []string `toml:"exec_on_failure"`
+	ExecOnSuccessExtra []string `toml:"exec_on_success_extra"`
+	ExecOnFailureExtra []string `toml:"exec_on_failure_extra"`
+
+	Command           string   `toml:"command"`
+	FailOnMatch       string   `toml:"fail_on_match"`
+	SizePattern       string   `toml:"size_pattern"`
+	UseIPv6           bool     `toml:"use_ipv6"`
+	UseIPv4           bool     `toml:"use_ipv4"`
+	ExcludeFile       string   `toml:"exclude_file"`
+	Username          string   `toml:"username"`
+	Password          string   `toml:"password"`
+	RsyncNoTimeo      bool     `toml:"rsync_no_timeout"`
+	RsyncTimeout      int      `toml:"rsync_timeout"`
+	RsyncOptions      []string `toml:"rsync_options"`
+	RsyncOverride     []string `toml:"rsync_override"`
+	RsyncOverrideOnly bool     `toml:"rsync_override_only"`
+	Stage1Profile     string   `toml:"stage1_profile"`
+
+	MemoryLimit string `toml:"memory_limit"`
+
+	DockerImage   string   `toml:"docker_image"`
+	DockerVolumes []string `toml:"docker_volumes"`
+	DockerOptions []string `toml:"docker_options"`
+
+	SnapshotPath string `toml:"snapshot_path"`
+
+	ChildMirrors []Mirror `toml:"mirrors"`
+}
+
+// Config is a tunasync worker.conf, the sections which only configure the worker itself are kept opaque
+type Config struct {
+	Global  Global `toml:"global"`
+	Include struct {
+		IncludeMirrors string `toml:"include_mirrors"`
+	} `toml:"include"`
+	Mirrors []Mirror `toml:"mirrors"`
+
+	Manager map[string]interface{} `toml:"manager"`
+	Server  map[string]interface{} `toml:"server"`
+	Cgroup  map[string]interface{} `toml:"cgroup"`
+	ZFS     map[string]interface{} `toml:"zfs"`
+	Btrfs   map[string]interface{} `toml:"btrfs_snapshot"`
+	Docker  map[string]interface{} `toml:"docker"`
+}
+
+// IncludeFunc returns the contents of the files matching the include_mirrors pattern
+type IncludeFunc func(pattern string) ([][]byte, error)
+
+// Import translates worker.conf into jobs, fields which can not be mapped are reported as warnings.
+// Files included by include_mirrors are read with include, they are skipped with a warning if it is nil.
+func Import(data []byte, include IncludeFunc) ([]v1beta1.Job, []internal.ImportWarning, error) {
+	cfg, warnings, err := Parse(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if pattern := cfg.Include.IncludeMirrors; pattern != "" {
+		if include == nil {
+			warnings = append(warnings, internal.ImportWarning{Field: "include.include_mirrors",
+				Message: "included files are not read here, import them one by one"})
+		} else {
+			files, err := include(pattern)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, f := range files {
+				var included struct {
+					Mirrors []Mirror `toml:"mirrors"`
+				}
+				w, err := decode(f, &included)
+				if err != nil {
+					return nil, nil, err
+				}
+				warnings = append(warnings, w...)
+				cfg.Mirrors = append(cfg.Mirrors, included.Mirrors...)
+			}
+		}
+	}
+
+	for _, section := range []struct {
+		name   string
+		values map[string]interface{}
+	}{{"cgroup", cfg.Cgroup}, {"zfs", cfg.ZFS}, {"btrfs_snapshot", cfg.Btrfs}, {"docker", cfg.Docker}} {
+		if enabled, _ := section.values["enable"].(bool); enabled {
+			warnings = append(warnings, internal.ImportWarning{Field: section.name,
+				Message: "worker level feature, it is not supported by kubesync jobs"})
+		}
+	}
+
+	var jobs []v1beta1.Job
+	names := make(map[string]string)
+	for _, m := range cfg.Mirrors {
+		job, w := translate(&cfg.Global, &m)
+		warnings = append(warnings, w...)
+		if job == nil {
+			continue
+		}
+		if other, ok := names[job.Name]; ok {
+			warnings = append(warnings, internal.ImportWarning{Mirror: m.Name, Field: "name",
+				Message: fmt.Sprintf("job name %s is already used by %s, mirror skipped", job.Name, other)})
+			continue
+		}
+		names[job.Name] = m.Name
+		jobs = append(jobs, *job)
+	}
+	return jobs, warnings, nil
+}
+
+// Parse parses worker.conf without resolving include_mirrors, unknown fields are reported as warnings
+func Parse(data []byte) (*Config, []internal.ImportWarning, error) {
+	cfg := new(Config)
+	warnings, err := decode(data, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, warnings, nil
+}
+
+// decode decodes data into v, unknown fields are reported as warnings instead of failing the import
+func decode(data []byte, v interface{}) ([]internal.ImportWarning, error) {
+	err := toml.NewDecoder(bytes.NewReader(data)).DisallowUnknownFields().Decode(v)
+	var strict *toml.StrictMissingError
+	if !errors.As(err, &strict) {
+		return nil, err
+	}
+	var warnings []internal.ImportWarning
+	for _, e := range strict.Errors {
+		row, _ := e.Position()
+		warnings = append(warnings, internal.ImportWarning{Field: strings.Join(e.Key(), "."),
+			Message: "unknown field at line " + strconv.Itoa(row)})
+	}
+	return warnings, toml.Unmarshal(data, v)
+}
+
+var invalidName = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// jobName turns a mirror name into a valid dns label
+func jobName(name string) string {
+	return strings.Trim(invalidName.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+func translate(g *Global, m *Mirror) (*v1beta1.Job, []internal.ImportWarning) {
+	var warnings []internal.ImportWarning
+	warn := func(field, msg string) {
+		warnings = append(warnings, internal.ImportWarning{Mirror: m.Name, Field: field, Message: msg})
+	}
+
+	name := jobName(m.Name)
+	if name == "" {
+		warn("name", "mirror without a valid name skipped")
+		return nil, warnings
+	}
+	if len(m.ChildMirrors) > 0 {
+		warn("mirrors", "nested mirrors are not supported, flatten them into [[mirrors]] blocks")
+	}
+
+	cfg := v1beta1.JobConfig{
+		Provider:      m.Provider,
+		Upstream:      m.Upstream,
+		Concurrent:    g.Concurrent,
+		Interval:      m.Interval,
+		Retry:         m.Retry,
+		Timeout:       m.Timeout,
+		Command:       m.Command,
+		FailOnMatch:   m.FailOnMatch,
+		SizePattern:   m.SizePattern,
+		ExcludeFile:   m.ExcludeFile,
+		RsyncOptions:  strings.Join(m.RsyncOptions, ";"),
+		Stage1Profile: m.Stage1Profile,
+	}
+	if name != m.Name {
+		cfg.Alias = m.Name
+		warn("name", fmt.Sprintf("renamed to %s to be a valid kubernetes name", name))
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = g.Interval
+	}
+	if cfg.Retry == 0 {
+		cfg.Retry = g.Retry
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = g.Timeout
+	}
+	if m.UseIPv6 {
+		cfg.IPv6Only = "true"
+	}
+	if m.UseIPv4 {
+		cfg.IPv4Only = "true"
+	}
+
+	// like tunasync, hooks of the mirror replace the global ones and the extra hooks are appended
+	execOnSuccess, execOnFailure := g.ExecOnSuccess, g.ExecOnFailure
+	if len(m.ExecOnSuccess) > 0 {
+		execOnSuccess = m.ExecOnSuccess
+	}
+	if len(m.ExecOnFailure) > 0 {
+		execOnFailure = m.ExecOnFailure
+	}
+	cfg.ExecOnSuccess = strings.Join(append(append([]string{}, execOnSuccess...), m.ExecOnSuccessExtra...), ";")
+	cfg.ExecOnFailure = strings.Join(append(append([]string{}, execOnFailure...), m.ExecOnFailureExtra...), ";")
+
+	keys := make([]string, 0, len(m.Env))
+	for k := range m.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		cfg.AdditionEnvs = append(cfg.AdditionEnvs, corev1.EnvVar{Name: k, Value: m.Env[k]})
+	}
+	// the worker reads these from the environment, the job has no field for them
+	if m.RsyncNoTimeo {
+		cfg.AdditionEnvs = append(cfg.AdditionEnvs, corev1.EnvVar{Name: "RSYNC_NO_TIMEOUT", Value: "true"})
+	}
+	if m.RsyncTimeout != 0 {
+		cfg.AdditionEnvs = append(cfg.AdditionEnvs, corev1.EnvVar{Name: "RSYNC_TIMEOUT", Value: strconv.Itoa(m.RsyncTimeout)})
+	}
+	if len(m.RsyncOverride) > 0 {
+		cfg.AdditionEnvs = append(cfg.AdditionEnvs, corev1.EnvVar{Name: "RSYNC_OVERRIDE", Value: strings.Join(m.RsyncOverride, ";")})
+	}
+
+	switch m.Provider {
+	case "rsync", "two-stage-rsync":
+	case "command":
+		warn("command", "the command must exist in the worker image")
+	case "":
+		warn("provider", "no provider, the worker defaults to rsync")
+	default:
+		warn("provider", "unknown provider "+m.Provider)
+	}
+	if m.RsyncOverrideOnly {
+		warn("rsync_override_only", "not supported by the worker, rsync_override is appended to the default options")
+	}
+	if m.Username != "" || m.Password != "" {
+		warn("username", "credentials are not imported, pass them with additionEnvs from a Secret")
+	}
+	if m.MirrorDir != "" || m.MirrorSubDir != "" {
+		warn("mirror_dir", "the mirror is stored on the volume of the job")
+	}
+	if m.LogDir != "" {
+		warn("log_dir", "the worker logs to its container")
+	}
+	if m.Role != "" {
+		warn("role", "not supported")
+	}
+	if m.DockerImage != "" || len(m.DockerVolumes) > 0 || len(m.DockerOptions) > 0 {
+		warn("docker_image", "set deploy.image to run the job in another image")
+	}
+	if m.SnapshotPath != "" {
+		warn("snapshot_path", "not supported")
+	}
+
+	var deploy v1beta1.JobDeploy
+	if m.MemoryLimit != "" {
+		if b, err := units.RAMInBytes(m.MemoryLimit); err != nil {
+			warn("memory_limit", "invalid memory limit "+m.MemoryLimit)
+		} else {
+			deploy.MemoryLimit = resource.NewQuantity(b, resource.BinarySI).String()
+		}
+	}
+
+	return &v1beta1.Job{
+		TypeMeta:   metav1.TypeMeta{Kind: "Job", APIVersion: v1beta1.GroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       v1beta1.JobSpec{Config: cfg, Deploy: deploy},
+	}, warnings
+}
@@ -0,0 +1,154 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package tunasync
+
+import (
+	"testing"
+
+	"github.com/CQUPTMirror/kubesync/internal"
+)
+
+const workerConf = `
+[global]
+name = "mirror_worker"
+log_dir = "/var/log/tunasync/{{.Name}}"
+mirror_dir = "/data/mirrors"
+concurrent = 10
+interval = 120
+exec_on_success = ["/usr/local/bin/notify"]
+
+[manager]
+api_base = "http://localhost:12345"
+
+[zfs]
+enable = true
+zpool = "pool"
+
+[include]
+include_mirrors = "mirrors/*.conf"
+
+[[mirrors]]
+name = "CentOS"
+provider = "rsync"
+upstream = "rsync://mirrors.example.com/centos/"
+rsync_options = ["--delete-excluded", "--info=progress2"]
+exclude_file = "/etc/excludes/centos.txt"
+exec_on_success_extra = ["/usr/local/bin/size centos"]
+memory_limit = "512M"
+rsync_timeout = 30
+use_ipv6 = true
+	[mirrors.env]
+	RSYNC_PASSWORD = "secret"
+	FOO = "bar"
+
+[[mirrors]]
+name = "pypi"
+provider = "command"
+upstream = "https://pypi.org/"
+command = "/home/scripts/pypi.sh"
+interval = 5
+docker_image = "tunathu/bandersnatch"
+colour = "blue"
+`
+
+func TestImport(t *testing.T) {
+	jobs, warnings, err := Import([]byte(workerConf), func(pattern string) ([][]byte, error) {
+		if pattern != "mirrors/*.conf" {
+			t.Errorf("unexpected pattern %s", pattern)
+		}
+		return [][]byte{[]byte("[[mirrors]]\nname = \"elvish\"\nprovider = \"rsync\"\nupstream = \"rsync://rsync.elvish.io/elvish/\"\n")}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 3 {
+		t.Fatalf("expected 3 jobs, got %d", len(jobs))
+	}
+
+	centos := jobs[0].Spec
+	if jobs[0].Name != "centos" || centos.Config.Alias != "CentOS" {
+		t.Errorf("unexpected name %s alias %s", jobs[0].Name, centos.Config.Alias)
+	}
+	if centos.Config.Interval != 120 || centos.Config.Concurrent != 10 || centos.Config.IPv6Only != "true" {
+		t.Errorf("global fields not inherited: %+v", centos.Config)
+	}
+	if centos.Config.RsyncOptions != "--delete-excluded;--info=progress2" {
+		t.Errorf("unexpected rsync options %s", centos.Config.RsyncOptions)
+	}
+	if centos.Config.ExecOnSuccess != "/usr/local/bin/notify;/usr/local/bin/size centos" {
+		t.Errorf("unexpected exec on success %s", centos.Config.ExecOnSuccess)
+	}
+	if centos.Deploy.MemoryLimit != "512Mi" {
+		t.Errorf("unexpected memory limit %s", centos.Deploy.MemoryLimit)
+	}
+	envs := map[string]string{}
+	for _, e := range centos.Config.AdditionEnvs {
+		envs[e.Name] = e.Value
+	}
+	if envs["FOO"] != "bar" || envs["RSYNC_PASSWORD"] != "secret" || envs["RSYNC_TIMEOUT"] != "30" {
+		t.Errorf("unexpected envs %v", envs)
+	}
+
+	if pypi := jobs[1].Spec.Config; pypi.Interval != 5 || pypi.Command != "/home/scripts/pypi.sh" {
+		t.Errorf("unexpected pypi config %+v", pypi)
+	}
+	if jobs[2].Name != "elvish" {
+		t.Errorf("included mirror not imported: %s", jobs[2].Name)
+	}
+
+	expected := map[string]bool{
+		"zfs": false, "CentOS/name": false, "pypi/command": false, "pypi/docker_image": false, "mirrors.colour": false,
+	}
+	for _, w := range warnings {
+		key := w.Field
+		if w.Mirror != "" {
+			key = w.Mirror + "/" + w.Field
+		}
+		if _, ok := expected[key]; ok {
+			expected[key] = true
+		}
+	}
+	for k, found := range expected {
+		if !found {
+			t.Errorf("missing warning %s in %v", k, warnings)
+		}
+	}
+}
+
+func TestImportWithoutInclude(t *testing.T) {
+	_, warnings, err := Import([]byte(workerConf), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range warnings {
+		if w.Field == "include.include_mirrors" {
+			return
+		}
+	}
+	t.Errorf("no warning for the skipped include in %v", warnings)
+}
+
+func TestImportDuplicateName(t *testing.T) {
+	jobs, warnings, err := Import([]byte("[[mirrors]]\nname = \"a_b\"\n[[mirrors]]\nname = \"a.b\"\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || len(warnings) == 0 || warnings[len(warnings)-1] == (internal.ImportWarning{}) {
+		t.Fatalf("duplicate job not skipped: %v %v", jobs, warnings)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/CQUPTMirror/kubesync/api/v1beta1"
 )
@@ -49,6 +50,10 @@ type MirrorStatus struct {
 	HelpUrl string             `json:"helpUrl"`
 	Type    v1beta1.MirrorType `json:"type"`
 	SizeStr string             `json:"sizeStr"`
+	// HitRatio is the cache hit ratio of proxy jobs
+	HitRatio float64 `json:"hitRatio,omitempty"`
+	// Quota is the quota in bytes of jobs on a shared volume
+	Quota uint64 `json:"quota,omitempty"`
 
 	v1beta1.JobStatus
 }
@@ -60,7 +65,39 @@ type MirrorConfig struct {
 }
 
 type MirrorSchedule struct {
-	NextSchedule int64 `json:"next_schedule"`
+	NextSchedule int64 `json:"nextSchedule"`
+}
+
+// UnmarshalJSON also accepts the next_schedule field sent by older workers
+func (s *MirrorSchedule) UnmarshalJSON(b []byte) error {
+	var j struct {
+		NextSchedule       *int64 `json:"nextSchedule"`
+		LegacyNextSchedule *int64 `json:"next_schedule"`
+	}
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	switch {
+	case j.NextSchedule != nil:
+		s.NextSchedule = *j.NextSchedule
+	case j.LegacyNextSchedule != nil:
+		s.NextSchedule = *j.LegacyNextSchedule
+	}
+	return nil
+}
+
+// StatusChange is one status transition of a job
+type StatusChange struct {
+	Time     int64              `json:"time"`
+	From     v1beta1.SyncStatus `json:"from"`
+	To       v1beta1.SyncStatus `json:"to"`
+	Size     uint64             `json:"size"`
+	ErrorMsg string             `json:"errorMsg,omitempty"`
+}
+
+// SizeMsg is the mirror size reported by the worker
+type SizeMsg struct {
+	Size uint64 `json:"size"`
 }
 
 // A CmdVerb is an action to a job or worker
@@ -124,6 +161,203 @@ type ClientCmd struct {
 	Force bool    `json:"force"`
 }
 
+const (
+	// TokenLabel marks a Secret as a manager api token, the value is the role of the token
+	TokenLabel = "mirror.redrock.team/token"
+	// TokenJobLabel binds a worker token to the job it belongs to
+	TokenJobLabel = "mirror.redrock.team/job"
+	// TokenKey is the key of the token in the Secret data
+	TokenKey = "token"
+	// SyncJobLabel marks the CronJob syncing a job in the cronjob sync mode and its Jobs, the value is the job name
+	SyncJobLabel = "mirror.redrock.team/sync"
+)
+
+const (
+	// AuthDir is where the credentials of the upstream are mounted in the worker
+	AuthDir = "/etc/kubesync/auth"
+	// the files of the credentials below AuthDir, the Secrets of the dirs are mounted whole
+	AuthRsyncPasswordFile = "rsync/password"
+	AuthBearerTokenFile   = "bearer/token"
+	AuthBasicDir          = "basic"
+	AuthSSHDir            = "ssh"
+	AuthS3Dir             = "s3"
+)
+
+// A Role is the permission level of a manager api caller
+type Role uint8
+
+const (
+	// RolePublic can only read public information
+	RolePublic Role = iota
+	// RoleWorker can report the status of its own job
+	RoleWorker
+	// RoleOperator can control jobs and edit announcements and files
+	RoleOperator
+	// RoleAdmin can create and delete jobs
+	RoleAdmin
+)
+
+func (r Role) String() string {
+	mapping := map[Role]string{
+		RolePublic:   "public",
+		RoleWorker:   "worker",
+		RoleOperator: "operator",
+		RoleAdmin:    "admin",
+	}
+	return mapping[r]
+}
+
+func NewRoleFromString(s string) Role {
+	mapping := map[string]Role{
+		"public":   RolePublic,
+		"worker":   RoleWorker,
+		"operator": RoleOperator,
+		"admin":    RoleAdmin,
+	}
+	return mapping[s]
+}
+
+// Marshal and Unmarshal for Role
+func (r Role) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+func (r *Role) UnmarshalJSON(b []byte) error {
+	var j string
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	*r = NewRoleFromString(j)
+	return nil
+}
+
+// Identity is the caller of a manager api request
+type Identity struct {
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+	// Job is only set for worker tokens, which are bound to one job
+	Job string `json:"job,omitempty"`
+}
+
+// AuditChange is the old and new value of one changed field
+type AuditChange struct {
+	Old interface{} `json:"old,omitempty"`
+	New interface{} `json:"new,omitempty"`
+}
+
+// ImportWarning is a field of an imported configuration which could not be mapped to a job
+type ImportWarning struct {
+	Mirror  string `json:"mirror,omitempty"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ImportedJob is a job created, or that would be created, by an import
+type ImportedJob struct {
+	ID string `json:"id"`
+	// Result is one of created, exists, failed or dry-run
+	Result string          `json:"result"`
+	Error  string          `json:"error,omitempty"`
+	Spec   v1beta1.JobSpec `json:"spec"`
+}
+
+// ImportResult is the response of an import
+type ImportResult struct {
+	Jobs     []ImportedJob   `json:"jobs"`
+	Warnings []ImportWarning `json:"warnings"`
+}
+
+// BundleVersion is the version of the bundle format written by the manager
+const BundleVersion = 1
+
+// Bundle holds the specs of the job templates, jobs, announcements and files of a site
+type Bundle struct {
+	Version int `json:"version"`
+	// Templates is absent from bundles written before job templates existed
+	Templates     []BundleTemplate     `json:"templates,omitempty"`
+	Jobs          []BundleJob          `json:"jobs"`
+	Announcements []BundleAnnouncement `json:"announcements"`
+	Files         []BundleFile         `json:"files"`
+}
+
+type BundleTemplate struct {
+	Name string                  `json:"name"`
+	Spec v1beta1.JobTemplateSpec `json:"spec"`
+}
+
+type BundleJob struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Spec   v1beta1.JobSpec   `json:"spec"`
+}
+
+type BundleAnnouncement struct {
+	Name string                   `json:"name"`
+	Spec v1beta1.AnnouncementSpec `json:"spec"`
+}
+
+type BundleFile struct {
+	Name string           `json:"name"`
+	Spec v1beta1.FileSpec `json:"spec"`
+}
+
+// BundleChange is what an import does, or would do, to one object
+type BundleChange struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Action is one of create, update, unchanged, skip or conflict
+	Action string                 `json:"action"`
+	Diff   map[string]AuditChange `json:"diff,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+}
+
+// BundleResult is the response of a bundle import, Applied is false for dry runs
+// and for imports refused because of conflicts
+type BundleResult struct {
+	Applied bool           `json:"applied"`
+	Changes []BundleChange `json:"changes"`
+}
+
+// AuditRecord describes one mutating request received by the manager
+type AuditRecord struct {
+	Time     time.Time `json:"time"`
+	User     string    `json:"user"`
+	Role     Role      `json:"role"`
+	SourceIP string    `json:"sourceIP"`
+	Method   string    `json:"method"`
+	Path     string    `json:"path"`
+	Kind     string    `json:"kind"`
+	Name     string    `json:"name"`
+	Action   string    `json:"action"`
+	Code     int       `json:"code"`
+	// Request is the request body, only kept when it is valid json
+	Request json.RawMessage `json:"request,omitempty"`
+	// Diff maps the dotted path of every changed field to its old and new value
+	Diff map[string]AuditChange `json:"diff,omitempty"`
+}
+
+const (
+	EventJob          = "job"
+	EventSchedule     = "schedule"
+	EventAnnouncement = "announcement"
+	EventFile         = "file"
+
+	EventAdded   = "added"
+	EventUpdated = "updated"
+	EventDeleted = "deleted"
+)
+
+// Event is pushed to the subscribers of the manager event stream,
+// Data is a MirrorStatus, MirrorSchedule, AnnouncementInfo or FileInfo depending on Type
+type Event struct {
+	ID     uint64      `json:"-"`
+	Type   string      `json:"type"`
+	Action string      `json:"action"`
+	Name   string      `json:"name"`
+	Time   int64       `json:"time"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
 func ParseSize(size uint64) (sizeStr string) {
 	switch {
 	case size > T:
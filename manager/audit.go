@@ -0,0 +1,298 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+	"github.com/CQUPTMirror/kubesync/internal"
+	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	AuditJob          = "Job"
+	AuditJobTemplate  = "JobTemplate"
+	AuditAnnouncement = "Announcement"
+	AuditFile         = "File"
+	// AuditBundle is the kind of bundle imports, which change many objects at once
+	AuditBundle = "Bundle"
+
+	// AuditUserAnnotation is set on the audit Events to the caller of the request
+	AuditUserAnnotation = "mirror.redrock.team/audit-user"
+
+	_defaultAuditSize = 1000
+	_maxAuditBody     = 16 * 1024
+)
+
+// auditLog keeps the latest audit records in memory
+type auditLog struct {
+	mu      sync.RWMutex
+	size    int
+	records []internal.AuditRecord
+}
+
+func newAuditLog(size int) *auditLog {
+	if size <= 0 {
+		size = _defaultAuditSize
+	}
+	return &auditLog{size: size}
+}
+
+func (a *auditLog) add(r internal.AuditRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.records = append(a.records, r)
+	if len(a.records) > a.size {
+		a.records = a.records[len(a.records)-a.size:]
+	}
+}
+
+// query returns the matching records, newest first
+func (a *auditLog) query(match func(*internal.AuditRecord) bool, limit int) []internal.AuditRecord {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	records := make([]internal.AuditRecord, 0)
+	for i := len(a.records) - 1; i >= 0 && (limit <= 0 || len(records) < limit); i-- {
+		if match(&a.records[i]) {
+			records = append(records, a.records[i])
+		}
+	}
+	return records
+}
+
+func newAuditObject(kind string) client.Object {
+	switch kind {
+	case AuditJob:
+		return new(v1beta1.Job)
+	case AuditJobTemplate:
+		return new(v1beta1.JobTemplate)
+	case AuditAnnouncement:
+		return new(v1beta1.Announcement)
+	case AuditFile:
+		return new(v1beta1.File)
+	}
+	return nil
+}
+
+// getAuditObject reads the object from the api server, bypassing the cache
+// so that the state right after the request is seen
+func (m *Manager) getAuditObject(ctx context.Context, kind, name string) client.Object {
+	obj := newAuditObject(kind)
+	if obj == nil || m.apiReader == nil {
+		return nil
+	}
+	if err := m.apiReader.Get(ctx, client.ObjectKey{Name: name}, obj); err != nil {
+		return nil
+	}
+	return obj
+}
+
+// audit records the request with its caller and the changes it made to the object named by the id param,
+// requests of workers reporting their own status are not recorded
+func (m *Manager) audit(kind, action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := getIdentity(c)
+		if id.Role == internal.RoleWorker {
+			c.Next()
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			body, _ = io.ReadAll(io.LimitReader(c.Request.Body, _maxAuditBody))
+			c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+		}
+
+		name := c.Param("id")
+		ctx := context.Background()
+		before := m.getAuditObject(ctx, kind, name)
+		c.Next()
+		after := m.getAuditObject(ctx, kind, name)
+
+		record := internal.AuditRecord{
+			Time:     time.Now(),
+			User:     id.Name,
+			Role:     id.Role,
+			SourceIP: c.ClientIP(),
+			Method:   c.Request.Method,
+			Path:     c.Request.URL.Path,
+			Kind:     kind,
+			Name:     name,
+			Action:   action,
+			Code:     c.Writer.Status(),
+			Diff:     diffObjects(before, after),
+		}
+		if json.Valid(body) {
+			record.Request = redactJSON(body)
+		}
+		m.auditLog.add(record)
+		runLog.Info("audit", "user", record.User, "ip", record.SourceIP, "action", action, "kind", kind, "name", name, "code", record.Code)
+
+		obj := after
+		if obj == nil {
+			obj = before
+		}
+		if obj != nil && m.recorder != nil {
+			eventType := corev1.EventTypeNormal
+			if record.Code >= http.StatusBadRequest {
+				eventType = corev1.EventTypeWarning
+			}
+			m.recorder.AnnotatedEventf(obj, map[string]string{AuditUserAnnotation: record.User}, eventType,
+				"Audit"+strings.ToUpper(action[:1])+action[1:], "%s", auditMessage(&record))
+		}
+	}
+}
+
+func auditMessage(r *internal.AuditRecord) string {
+	msg := fmt.Sprintf("%s %s from %s %s %s/%s (%d)", r.Role, r.User, r.SourceIP, r.Action, r.Kind, r.Name, r.Code)
+	if len(r.Diff) > 0 {
+		var changes []string
+		for k, v := range r.Diff {
+			changes = append(changes, fmt.Sprintf("%s: %v -> %v", k, v.Old, v.New))
+		}
+		sort.Strings(changes)
+		msg += ", " + strings.Join(changes, ", ")
+	} else if len(r.Request) > 0 {
+		msg += ", " + string(r.Request)
+	}
+	// events with a long message are rejected by the api server
+	if len(msg) > 1024 {
+		n := 1021
+		for n > 0 && !utf8.RuneStart(msg[n]) {
+			n--
+		}
+		msg = msg[:n] + "..."
+	}
+	return msg
+}
+
+// diffObjects compares the spec and status of the objects, nil means the object does not exist
+func diffObjects(before, after client.Object) map[string]internal.AuditChange {
+	return diffFields(before, after, "spec", "status")
+}
+
+// diffFields compares the given top level fields of the objects
+func diffFields(before, after client.Object, fields ...string) map[string]internal.AuditChange {
+	diff := make(map[string]internal.AuditChange)
+	flatten := func(obj client.Object) map[string]interface{} {
+		flat := make(map[string]interface{})
+		if obj == nil || reflect.ValueOf(obj).IsNil() {
+			return flat
+		}
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return flat
+		}
+		redactEnv(u)
+		for _, k := range fields {
+			flattenInto(flat, k, u[k])
+		}
+		return flat
+	}
+	o, n := flatten(before), flatten(after)
+	for k, v := range o {
+		if nv, ok := n[k]; !ok || !reflect.DeepEqual(v, nv) {
+			diff[k] = internal.AuditChange{Old: v, New: nv}
+		}
+	}
+	for k, v := range n {
+		if _, ok := o[k]; !ok {
+			diff[k] = internal.AuditChange{New: v}
+		}
+	}
+	if len(diff) == 0 {
+		return nil
+	}
+	return diff
+}
+
+// redactJSON hides the values of the env looking like credentials anywhere in the json body,
+// as job specs and bundles carry them
+func redactJSON(body []byte) []byte {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return body
+	}
+	redactEnv(v)
+	b, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+	return b
+}
+
+// redactEnv hides the values of the objects with a name and a value, like env, named as holding credentials
+func redactEnv(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		name, ok := v["name"].(string)
+		if value, isString := v["value"].(string); ok && isString && value != "" && isSecretEnv(name) {
+			v["value"] = redacted
+		}
+		for _, val := range v {
+			redactEnv(val)
+		}
+	case []interface{}:
+		for _, val := range v {
+			redactEnv(val)
+		}
+	}
+}
+
+func flattenInto(flat map[string]interface{}, prefix string, v interface{}) {
+	if m, ok := v.(map[string]interface{}); ok {
+		for k, val := range m {
+			flattenInto(flat, prefix+"."+k, val)
+		}
+		return
+	}
+	if v != nil {
+		flat[prefix] = v
+	}
+}
+
+// listAudit respond with the audit records matching the query
+func (m *Manager) listAudit(c *gin.Context) {
+	kind, name, user := c.Query("kind"), c.Query("name"), c.Query("user")
+	since, _ := strconv.ParseInt(c.Query("since"), 10, 64)
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	records := m.auditLog.query(func(r *internal.AuditRecord) bool {
+		return (kind == "" || strings.EqualFold(r.Kind, kind)) &&
+			(name == "" || r.Name == name) &&
+			(user == "" || r.User == user) &&
+			r.Time.Unix() >= since
+	}, limit)
+	c.JSON(http.StatusOK, records)
+}
@@ -0,0 +1,119 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+	"github.com/CQUPTMirror/kubesync/internal"
+)
+
+func TestDiffObjects(t *testing.T) {
+	before := &v1beta1.Job{}
+	before.Spec.Config.Upstream = "rsync://a/"
+	before.Status.Status = v1beta1.Success
+	after := before.DeepCopy()
+	after.Status.Status = v1beta1.Disabled
+
+	diff := diffObjects(before, after)
+	if len(diff) != 1 {
+		t.Fatalf("unexpected diff %v", diff)
+	}
+	if c := diff["status.status"]; c.Old != string(v1beta1.Success) || c.New != string(v1beta1.Disabled) {
+		t.Fatalf("unexpected change %+v", c)
+	}
+
+	diff = diffObjects(before, nil)
+	if c, ok := diff["spec.config.upstream"]; !ok || c.New != nil {
+		t.Fatalf("delete should clear every field, got %v", diff)
+	}
+}
+
+func TestAuditMessage(t *testing.T) {
+	r := &internal.AuditRecord{Kind: AuditAnnouncement, Name: "a", Request: []byte(strings.Repeat("镜像", 400))}
+	msg := auditMessage(r)
+	if len(msg) > 1024 || !strings.HasSuffix(msg, "...") {
+		t.Fatalf("message of %d bytes not truncated", len(msg))
+	}
+	if !utf8.ValidString(msg) {
+		t.Fatalf("message truncated inside a rune: %q", msg[len(msg)-8:])
+	}
+}
+
+func TestAuditLogQuery(t *testing.T) {
+	a := newAuditLog(2)
+	a.add(internal.AuditRecord{Name: "a"})
+	a.add(internal.AuditRecord{Name: "b"})
+	a.add(internal.AuditRecord{Name: "c"})
+
+	records := a.query(func(*internal.AuditRecord) bool { return true }, 0)
+	if len(records) != 2 || records[0].Name != "c" || records[1].Name != "b" {
+		t.Fatalf("unexpected records %v", records)
+	}
+}
+
+func TestAuditRedact(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	m := &Manager{client: c, apiReader: c, auditLog: newAuditLog(10)}
+	engine := gin.New()
+	// the fake client does not apply, the job is created as is
+	engine.POST("/job/:id", m.audit(AuditJob, "apply"), func(ctx *gin.Context) {
+		job := &v1beta1.Job{ObjectMeta: metav1.ObjectMeta{Name: ctx.Param("id")}}
+		if err := ctx.BindJSON(&job.Spec); err != nil {
+			return
+		}
+		if err := c.Create(ctx, job); err != nil {
+			ctx.AbortWithError(http.StatusInternalServerError, err)
+		}
+	})
+	engine.GET("/audit", m.listAudit)
+
+	body := `{"config":{"upstream":"rsync://a/debian/","additionEnvs":[{"name":"RSYNC_PASSWORD","value":"hunter2"}]},` +
+		`"deploy":{"env":[{"name":"LANG","value":"C.UTF-8"}]}}`
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/job/debian", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/audit", nil))
+	if strings.Contains(w.Body.String(), "hunter2") {
+		t.Errorf("the password leaked into the audit log: %s", w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "C.UTF-8") || !strings.Contains(w.Body.String(), "******") {
+		t.Errorf("unexpected audit log: %s", w.Body.String())
+	}
+	if msg := auditMessage(&m.auditLog.query(func(*internal.AuditRecord) bool { return true }, 0)[0]); strings.Contains(msg, "hunter2") {
+		t.Errorf("the password leaked into the event: %s", msg)
+	}
+}
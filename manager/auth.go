@@ -0,0 +1,125 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package manager
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/CQUPTMirror/kubesync/internal"
+	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const _identityKey = "identity"
+
+var anonymous = &internal.Identity{Name: "anonymous", Role: internal.RolePublic}
+
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// lookupToken finds the token Secret matching the given token,
+// it returns nil if no Secret matches
+func (m *Manager) lookupToken(ctx context.Context, token string) (*internal.Identity, error) {
+	secrets := new(corev1.SecretList)
+	if err := m.client.List(ctx, secrets, client.HasLabels{internal.TokenLabel}); err != nil {
+		return nil, err
+	}
+	for _, v := range secrets.Items {
+		expected := v.Data[internal.TokenKey]
+		if len(expected) == 0 || subtle.ConstantTimeCompare(expected, []byte(token)) != 1 {
+			continue
+		}
+		id := &internal.Identity{Name: v.Name, Role: internal.NewRoleFromString(v.Labels[internal.TokenLabel])}
+		if id.Role == internal.RoleWorker {
+			id.Job = v.Labels[internal.TokenJobLabel]
+		}
+		return id, nil
+	}
+	return nil, nil
+}
+
+// authenticate resolves the identity of the request from the bearer token
+// or the login session, requests without credentials are treated as public
+func (m *Manager) authenticate(c *gin.Context) {
+	id := anonymous
+	if token := bearerToken(c.Request); token != "" {
+		found, err := m.lookupToken(c.Request.Context(), token)
+		if err != nil {
+			err := fmt.Errorf("failed to look up token: %s", err.Error())
+			c.Error(err)
+			m.returnErrJSON(c, http.StatusInternalServerError, err)
+			c.Abort()
+			return
+		}
+		if found == nil {
+			m.returnErrJSON(c, http.StatusUnauthorized, errors.New("invalid token"))
+			c.Abort()
+			return
+		}
+		id = found
+	} else if m.oauth != nil {
+		if found := m.oauth.sessionIdentity(c); found != nil {
+			id = found
+		}
+	}
+	c.Set(_identityKey, id)
+	c.Next()
+}
+
+// authorize only lets the request pass if its identity has at least the given role,
+// worker tokens are further restricted to the job they belong to
+func (m *Manager) authorize(role internal.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := getIdentity(c)
+		if id.Role < role {
+			if id.Role == internal.RolePublic {
+				m.returnErrJSON(c, http.StatusUnauthorized, errors.New("authorization required"))
+			} else {
+				m.returnErrJSON(c, http.StatusForbidden, fmt.Errorf("%s role required", role))
+			}
+			c.Abort()
+			return
+		}
+		if id.Role == internal.RoleWorker && id.Job != c.Param("id") {
+			m.returnErrJSON(c, http.StatusForbidden, fmt.Errorf("token is not allowed to access %s", c.Param("id")))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func getIdentity(c *gin.Context) *internal.Identity {
+	if v, ok := c.Get(_identityKey); ok {
+		if id, ok := v.(*internal.Identity); ok {
+			return id
+		}
+	}
+	return anonymous
+}
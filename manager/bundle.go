@@ -0,0 +1,267 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package manager
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+	"github.com/CQUPTMirror/kubesync/internal"
+)
+
+const (
+	_maxBundleBody = 16 << 20
+
+	ConflictFail      = "fail"
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+)
+
+// exportBundle respond with the specs of all job templates, jobs, announcements and files,
+// as yaml if format=yaml is given
+func (m *Manager) exportBundle(c *gin.Context) {
+	bundle, err := m.buildBundle(c.Request.Context())
+	if err != nil {
+		err := fmt.Errorf("failed to export bundle: %s", err.Error())
+		c.Error(err)
+		m.returnErrJSON(c, http.StatusInternalServerError, err)
+		return
+	}
+	if c.Query("format") == "yaml" {
+		b, err := yaml.Marshal(bundle)
+		if err != nil {
+			c.Error(err)
+			m.returnErrJSON(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.Data(http.StatusOK, "application/yaml", b)
+		return
+	}
+	c.JSON(http.StatusOK, bundle)
+}
+
+func (m *Manager) buildBundle(ctx context.Context) (*internal.Bundle, error) {
+	m.rwmu.RLock()
+	defer m.rwmu.RUnlock()
+
+	bundle := &internal.Bundle{
+		Version:       internal.BundleVersion,
+		Templates:     []internal.BundleTemplate{},
+		Jobs:          []internal.BundleJob{},
+		Announcements: []internal.BundleAnnouncement{},
+		Files:         []internal.BundleFile{},
+	}
+	templates := new(v1beta1.JobTemplateList)
+	if err := m.client.List(ctx, templates); err != nil {
+		return nil, err
+	}
+	for _, v := range templates.Items {
+		bundle.Templates = append(bundle.Templates, internal.BundleTemplate{Name: v.Name, Spec: v.Spec})
+	}
+	jobs := new(v1beta1.JobList)
+	if err := m.client.List(ctx, jobs); err != nil {
+		return nil, err
+	}
+	for _, v := range jobs.Items {
+		bundle.Jobs = append(bundle.Jobs, internal.BundleJob{Name: v.Name, Labels: v.Labels, Spec: v.Spec})
+	}
+	news := new(v1beta1.AnnouncementList)
+	if err := m.client.List(ctx, news); err != nil {
+		return nil, err
+	}
+	for _, v := range news.Items {
+		bundle.Announcements = append(bundle.Announcements, internal.BundleAnnouncement{Name: v.Name, Spec: v.Spec})
+	}
+	files := new(v1beta1.FileList)
+	if err := m.client.List(ctx, files); err != nil {
+		return nil, err
+	}
+	for _, v := range files.Items {
+		bundle.Files = append(bundle.Files, internal.BundleFile{Name: v.Name, Spec: v.Spec})
+	}
+
+	sort.Slice(bundle.Templates, func(i, j int) bool { return bundle.Templates[i].Name < bundle.Templates[j].Name })
+	sort.Slice(bundle.Jobs, func(i, j int) bool { return bundle.Jobs[i].Name < bundle.Jobs[j].Name })
+	sort.Slice(bundle.Announcements, func(i, j int) bool { return bundle.Announcements[i].Name < bundle.Announcements[j].Name })
+	sort.Slice(bundle.Files, func(i, j int) bool { return bundle.Files[i].Name < bundle.Files[j].Name })
+	return bundle, nil
+}
+
+// bundleObjects turns the bundle into the objects it describes, templates come before the jobs using them
+func bundleObjects(bundle *internal.Bundle) []client.Object {
+	var objs []client.Object
+	for _, v := range bundle.Templates {
+		objs = append(objs, &v1beta1.JobTemplate{
+			TypeMeta:   metav1.TypeMeta{Kind: AuditJobTemplate, APIVersion: v1beta1.GroupVersion.String()},
+			ObjectMeta: metav1.ObjectMeta{Name: v.Name},
+			Spec:       v.Spec,
+		})
+	}
+	for _, v := range bundle.Jobs {
+		objs = append(objs, &v1beta1.Job{
+			TypeMeta:   metav1.TypeMeta{Kind: AuditJob, APIVersion: v1beta1.GroupVersion.String()},
+			ObjectMeta: metav1.ObjectMeta{Name: v.Name, Labels: v.Labels},
+			Spec:       v.Spec,
+		})
+	}
+	for _, v := range bundle.Announcements {
+		objs = append(objs, &v1beta1.Announcement{
+			TypeMeta:   metav1.TypeMeta{Kind: AuditAnnouncement, APIVersion: v1beta1.GroupVersion.String()},
+			ObjectMeta: metav1.ObjectMeta{Name: v.Name},
+			Spec:       v.Spec,
+		})
+	}
+	for _, v := range bundle.Files {
+		objs = append(objs, &v1beta1.File{
+			TypeMeta:   metav1.TypeMeta{Kind: AuditFile, APIVersion: v1beta1.GroupVersion.String()},
+			ObjectMeta: metav1.ObjectMeta{Name: v.Name},
+			Spec:       v.Spec,
+		})
+	}
+	return objs
+}
+
+// importBundle creates or updates the objects of a bundle. Objects whose spec differs are conflicts,
+// which are refused as a whole by default, or skipped or overwritten as given by the conflict param.
+// With dryRun=true the changes are only reported.
+func (m *Manager) importBundle(c *gin.Context) {
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, _maxBundleBody))
+	if err != nil {
+		err := fmt.Errorf("failed to read bundle: %s", err.Error())
+		c.Error(err)
+		m.returnErrJSON(c, http.StatusBadRequest, err)
+		return
+	}
+	bundle := new(internal.Bundle)
+	// yaml is a superset of json, so both are accepted
+	if err := yaml.UnmarshalStrict(data, bundle); err != nil {
+		err := fmt.Errorf("failed to parse bundle: %s", err.Error())
+		c.Error(err)
+		m.returnErrJSON(c, http.StatusBadRequest, err)
+		return
+	}
+	if bundle.Version != internal.BundleVersion {
+		err := fmt.Errorf("unsupported bundle version %d", bundle.Version)
+		c.Error(err)
+		m.returnErrJSON(c, http.StatusBadRequest, err)
+		return
+	}
+	dryRun, _ := strconv.ParseBool(c.Query("dryRun"))
+	conflict := c.DefaultQuery("conflict", ConflictFail)
+	switch conflict {
+	case ConflictFail, ConflictSkip, ConflictOverwrite:
+	default:
+		err := fmt.Errorf("unknown conflict handling %s", conflict)
+		c.Error(err)
+		m.returnErrJSON(c, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	m.rwmu.Lock()
+	defer m.rwmu.Unlock()
+
+	objs := bundleObjects(bundle)
+	result := internal.BundleResult{Changes: make([]internal.BundleChange, 0, len(objs))}
+	existing := make([]client.Object, len(objs))
+	conflicts := false
+	for i, obj := range objs {
+		change := internal.BundleChange{Kind: obj.GetObjectKind().GroupVersionKind().Kind, Name: obj.GetName()}
+		cur := newAuditObject(change.Kind)
+		err := m.client.Get(ctx, client.ObjectKey{Name: obj.GetName()}, cur)
+		switch {
+		case apierrors.IsNotFound(err):
+			change.Action = "create"
+			change.Diff = diffFields(nil, obj, "spec")
+		case err != nil:
+			err := fmt.Errorf("failed to get %s %s: %s", change.Kind, change.Name, err.Error())
+			c.Error(err)
+			m.returnErrJSON(c, http.StatusInternalServerError, err)
+			return
+		default:
+			existing[i] = cur
+			change.Diff = diffFields(cur, obj, "spec")
+			switch {
+			case len(change.Diff) == 0:
+				change.Action = "unchanged"
+			case conflict == ConflictOverwrite:
+				change.Action = "update"
+			case conflict == ConflictSkip:
+				change.Action = "skip"
+			default:
+				change.Action = "conflict"
+				conflicts = true
+			}
+		}
+		result.Changes = append(result.Changes, change)
+	}
+	if dryRun || conflicts {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	for i, obj := range objs {
+		change := &result.Changes[i]
+		var err error
+		switch change.Action {
+		case "create":
+			err = m.client.Patch(ctx, obj, client.Apply, []client.PatchOption{client.ForceOwnership, client.FieldOwner("mirror-controller")}...)
+		case "update":
+			// the spec is replaced as a whole, fields missing from the bundle are cleared
+			err = m.client.Update(ctx, replaceSpec(existing[i], obj))
+		default:
+			continue
+		}
+		if err != nil {
+			change.Error = err.Error()
+			runLog.Error(err, fmt.Sprintf("failed to import %s %s", change.Kind, change.Name))
+		}
+	}
+	result.Applied = true
+	c.JSON(http.StatusOK, result)
+}
+
+// replaceSpec copies the spec, and the labels of jobs, of desired into cur
+func replaceSpec(cur, desired client.Object) client.Object {
+	switch o := cur.(type) {
+	case *v1beta1.Job:
+		d := desired.(*v1beta1.Job)
+		o.Spec = d.Spec
+		if d.Labels != nil {
+			o.Labels = d.Labels
+		}
+	case *v1beta1.JobTemplate:
+		o.Spec = desired.(*v1beta1.JobTemplate).Spec
+	case *v1beta1.Announcement:
+		o.Spec = desired.(*v1beta1.Announcement).Spec
+	case *v1beta1.File:
+		o.Spec = desired.(*v1beta1.File).Spec
+	}
+	return cur
+}
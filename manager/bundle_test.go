@@ -0,0 +1,145 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+	"github.com/CQUPTMirror/kubesync/internal"
+)
+
+func newBundleTestManager(t *testing.T) (*Manager, *gin.Engine) {
+	scheme := runtime.NewScheme()
+	if err := v1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	m := &Manager{client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&v1beta1.Job{ObjectMeta: metav1.ObjectMeta{Name: "debian"}, Spec: v1beta1.JobSpec{Config: v1beta1.JobConfig{Upstream: "rsync://a/debian/", Interval: 60}}},
+		&v1beta1.Job{ObjectMeta: metav1.ObjectMeta{Name: "centos"}, Spec: v1beta1.JobSpec{Config: v1beta1.JobConfig{Upstream: "rsync://a/centos/"}}},
+		&v1beta1.JobTemplate{ObjectMeta: metav1.ObjectMeta{Name: "rsync"}, Spec: v1beta1.JobTemplateSpec{Config: v1beta1.JobConfig{Provider: "rsync"}}},
+		&v1beta1.Announcement{ObjectMeta: metav1.ObjectMeta{Name: "welcome"}, Spec: v1beta1.AnnouncementSpec{Title: "Welcome"}},
+	).Build()}
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/bundle", m.exportBundle)
+	engine.POST("/bundle", m.importBundle)
+	return m, engine
+}
+
+func postBundle(t *testing.T, engine *gin.Engine, query, body string) (int, internal.BundleResult) {
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/bundle?"+query, strings.NewReader(body)))
+	var result internal.BundleResult
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w.Code, result
+}
+
+func TestExportBundle(t *testing.T) {
+	_, engine := newBundleTestManager(t)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/bundle", nil))
+	var bundle internal.Bundle
+	if err := json.Unmarshal(w.Body.Bytes(), &bundle); err != nil {
+		t.Fatal(err)
+	}
+	if bundle.Version != internal.BundleVersion || len(bundle.Jobs) != 2 || bundle.Jobs[0].Name != "centos" || len(bundle.Announcements) != 1 ||
+		len(bundle.Templates) != 1 || bundle.Templates[0].Spec.Config.Provider != "rsync" {
+		t.Fatalf("unexpected bundle %+v", bundle)
+	}
+
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/bundle?format=yaml", nil))
+	if !strings.Contains(w.Body.String(), "upstream: rsync://a/centos/") {
+		t.Fatalf("unexpected yaml bundle %s", w.Body.String())
+	}
+}
+
+func TestImportBundle(t *testing.T) {
+	m, engine := newBundleTestManager(t)
+	bundle := `
+version: 1
+jobs:
+- name: centos
+  spec:
+    config:
+      upstream: rsync://a/centos/
+- name: debian
+  spec:
+    config:
+      upstream: rsync://b/debian/
+      interval: 60
+- name: ubuntu
+  spec:
+    config:
+      upstream: rsync://a/ubuntu/
+`
+	code, result := postBundle(t, engine, "dryRun=true", bundle)
+	if code != http.StatusOK || result.Applied {
+		t.Fatalf("dry run returned %d %+v", code, result)
+	}
+	actions := map[string]string{}
+	for _, c := range result.Changes {
+		actions[c.Name] = c.Action
+	}
+	if actions["centos"] != "unchanged" || actions["debian"] != "conflict" || actions["ubuntu"] != "create" {
+		t.Fatalf("unexpected actions %v", actions)
+	}
+	if d := result.Changes[1].Diff["spec.config.upstream"]; d.Old != "rsync://a/debian/" || d.New != "rsync://b/debian/" {
+		t.Fatalf("unexpected diff %v", result.Changes[1].Diff)
+	}
+
+	if _, result := postBundle(t, engine, "", bundle); result.Applied {
+		t.Fatal("bundle with conflicts applied")
+	}
+
+	code, result = postBundle(t, engine, "conflict=overwrite", strings.Split(bundle, "- name: ubuntu")[0])
+	if code != http.StatusOK || !result.Applied {
+		t.Fatalf("overwrite returned %d %+v", code, result)
+	}
+	job := new(v1beta1.Job)
+	if err := m.client.Get(context.Background(), client.ObjectKey{Name: "debian"}, job); err != nil {
+		t.Fatal(err)
+	}
+	if job.Spec.Config.Upstream != "rsync://b/debian/" {
+		t.Fatalf("job not overwritten: %+v", job.Spec.Config)
+	}
+
+	if code, _ := postBundle(t, engine, "", "version: 2\n"); code != http.StatusBadRequest {
+		t.Fatalf("unknown version returned %d", code)
+	}
+	if code, _ := postBundle(t, engine, "", "version: 1\njobz: []\n"); code != http.StatusBadRequest {
+		t.Fatalf("unknown field returned %d", code)
+	}
+}
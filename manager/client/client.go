@@ -0,0 +1,435 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package client is a typed client of the manager api, see /openapi.json of the manager for the routes
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+	"github.com/CQUPTMirror/kubesync/internal"
+	"github.com/CQUPTMirror/kubesync/manager/mirrorz"
+)
+
+// Types shared with the manager
+type (
+	MirrorStatus     = internal.MirrorStatus
+	MirrorConfig     = internal.MirrorConfig
+	MirrorSchedule   = internal.MirrorSchedule
+	AnnouncementInfo = internal.AnnouncementInfo
+	FileBase         = internal.FileBase
+	FileInfo         = internal.FileInfo
+	ClientCmd        = internal.ClientCmd
+	CmdVerb          = internal.CmdVerb
+	Role             = internal.Role
+	Identity         = internal.Identity
+	AuditRecord      = internal.AuditRecord
+	AuditChange      = internal.AuditChange
+	Event            = internal.Event
+	StatusChange     = internal.StatusChange
+	ImportResult     = internal.ImportResult
+	ImportedJob      = internal.ImportedJob
+	ImportWarning    = internal.ImportWarning
+	Bundle           = internal.Bundle
+	BundleResult     = internal.BundleResult
+	BundleChange     = internal.BundleChange
+)
+
+const (
+	CmdStart   = internal.CmdStart
+	CmdStop    = internal.CmdStop
+	CmdRestart = internal.CmdRestart
+	CmdPing    = internal.CmdPing
+)
+
+// Error is returned when the manager responds with a non 2xx status
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("manager returned %d: %s", e.Code, e.Message)
+}
+
+// Client talks to one manager
+type Client struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+type Option func(*Client)
+
+// WithToken sets the bearer token sent with every request
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithHTTPClient replaces the default http client
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+// New creates a client of the manager at base, e.g. http://manager:3000
+func New(base string, opts ...Option) *Client {
+	c := &Client{
+		base: strings.TrimSuffix(base, "/"),
+		http: &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// rawBody is sent as is instead of being encoded as json
+type rawBody struct {
+	contentType string
+	data        []byte
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, in interface{}) (*http.Request, error) {
+	var body io.Reader
+	contentType := "application/json; charset=utf-8"
+	if raw, ok := in.(rawBody); ok {
+		body = bytes.NewReader(raw.data)
+		contentType = raw.contentType
+	} else if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(resp.Body)
+	e := &Error{Code: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	var msg struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &msg) == nil && msg.Error != "" {
+		e.Message = msg.Error
+	}
+	return e
+}
+
+// do sends in as json body and decodes the json response into out, both can be nil
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	req, err := c.newRequest(ctx, method, path, in)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+	if out == nil || method == http.MethodHead {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func escape(id string) string {
+	return url.PathEscape(id)
+}
+
+// ListJobs lists the status of all jobs
+func (c *Client) ListJobs(ctx context.Context) ([]MirrorStatus, error) {
+	var jobs []MirrorStatus
+	return jobs, c.do(ctx, http.MethodGet, "/jobs", nil, &jobs)
+}
+
+// GetJob gets the status of a job
+func (c *Client) GetJob(ctx context.Context, id string) (*v1beta1.JobStatus, error) {
+	status := new(v1beta1.JobStatus)
+	return status, c.do(ctx, http.MethodGet, "/job/"+escape(id), nil, status)
+}
+
+// GetJobConfig gets the spec of a job
+func (c *Client) GetJobConfig(ctx context.Context, id string) (*MirrorConfig, error) {
+	config := new(MirrorConfig)
+	return config, c.do(ctx, http.MethodGet, "/job/"+escape(id)+"/config", nil, config)
+}
+
+// GetJobLog gets the latest sync log of a job
+func (c *Client) GetJobLog(ctx context.Context, id string) (string, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/job/"+escape(id)+"/log", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return "", err
+	}
+	b, err := io.ReadAll(resp.Body)
+	return string(b), err
+}
+
+// GetJobHistory gets the status transitions of a job, newest first
+func (c *Client) GetJobHistory(ctx context.Context, id string) ([]StatusChange, error) {
+	var history []StatusChange
+	return history, c.do(ctx, http.MethodGet, "/job/"+escape(id)+"/history", nil, &history)
+}
+
+// ApplyJob creates a job, or merges the non empty fields of spec into an existing job
+func (c *Client) ApplyJob(ctx context.Context, id string, spec interface{}) error {
+	return c.do(ctx, http.MethodPost, "/job/"+escape(id), spec, nil)
+}
+
+// DeleteJob deletes a job
+func (c *Client) DeleteJob(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/job/"+escape(id), nil, nil)
+}
+
+// RegisterJob marks the worker of a job online
+func (c *Client) RegisterJob(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodHead, "/job/"+escape(id), nil, nil)
+}
+
+// UpdateJobStatus reports the status of a job
+func (c *Client) UpdateJobStatus(ctx context.Context, id string, status v1beta1.JobStatus) (*v1beta1.JobStatus, error) {
+	updated := new(v1beta1.JobStatus)
+	return updated, c.do(ctx, http.MethodPatch, "/job/"+escape(id), status, updated)
+}
+
+// UpdateJobSize reports the size of a job
+func (c *Client) UpdateJobSize(ctx context.Context, id string, size uint64) error {
+	return c.do(ctx, http.MethodPost, "/job/"+escape(id)+"/size", internal.SizeMsg{Size: size}, nil)
+}
+
+// UpdateSchedule reports the next schedule of a job
+func (c *Client) UpdateSchedule(ctx context.Context, id string, next int64) error {
+	return c.do(ctx, http.MethodPost, "/job/"+escape(id)+"/schedule", MirrorSchedule{NextSchedule: next}, nil)
+}
+
+// EnableJob enables a job
+func (c *Client) EnableJob(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/job/"+escape(id)+"/enable", nil, nil)
+}
+
+// DisableJob disables a job
+func (c *Client) DisableJob(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/job/"+escape(id)+"/disable", nil, nil)
+}
+
+// SendCmd sends a command to the worker of a job
+func (c *Client) SendCmd(ctx context.Context, id string, cmd ClientCmd) error {
+	return c.do(ctx, http.MethodPost, "/job/"+escape(id)+"/cmd", cmd, nil)
+}
+
+// ListAnnouncements lists all announcements
+func (c *Client) ListAnnouncements(ctx context.Context) ([]AnnouncementInfo, error) {
+	var news []AnnouncementInfo
+	return news, c.do(ctx, http.MethodGet, "/announcements", nil, &news)
+}
+
+// GetAnnouncement gets an announcement
+func (c *Client) GetAnnouncement(ctx context.Context, id string) (*AnnouncementInfo, error) {
+	news := new(AnnouncementInfo)
+	return news, c.do(ctx, http.MethodGet, "/announcement/"+escape(id), nil, news)
+}
+
+// ApplyAnnouncement creates an announcement, or merges the non empty fields of spec into an existing one
+func (c *Client) ApplyAnnouncement(ctx context.Context, id string, spec interface{}) error {
+	return c.do(ctx, http.MethodPost, "/announcement/"+escape(id), spec, nil)
+}
+
+// DeleteAnnouncement deletes an announcement
+func (c *Client) DeleteAnnouncement(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/announcement/"+escape(id), nil, nil)
+}
+
+// ListFiles lists all file lists
+func (c *Client) ListFiles(ctx context.Context) ([]FileInfo, error) {
+	var files []FileInfo
+	return files, c.do(ctx, http.MethodGet, "/files", nil, &files)
+}
+
+// GetFile gets the file list of a job
+func (c *Client) GetFile(ctx context.Context, id string) (*FileInfo, error) {
+	file := new(FileInfo)
+	return file, c.do(ctx, http.MethodGet, "/file/"+escape(id), nil, file)
+}
+
+// UpdateFile updates the file list of a job
+func (c *Client) UpdateFile(ctx context.Context, id string, file FileBase) error {
+	return c.do(ctx, http.MethodPost, "/file/"+escape(id), file, nil)
+}
+
+// DeleteFile deletes the file list of a job
+func (c *Client) DeleteFile(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/file/"+escape(id), nil, nil)
+}
+
+// MirrorZ gets the mirrorz document
+func (c *Client) MirrorZ(ctx context.Context) (*mirrorz.MirrorZ, error) {
+	doc := new(mirrorz.MirrorZ)
+	return doc, c.do(ctx, http.MethodGet, "/api/mirrorz.json", nil, doc)
+}
+
+// Me gets the identity of the client
+func (c *Client) Me(ctx context.Context) (*Identity, error) {
+	id := new(Identity)
+	return id, c.do(ctx, http.MethodGet, "/auth/me", nil, id)
+}
+
+// AuditQuery filters the audit records, empty fields match everything
+type AuditQuery struct {
+	Kind  string
+	Name  string
+	User  string
+	Since time.Time
+	Limit int
+}
+
+// Audit queries the audit log, newest first
+func (c *Client) Audit(ctx context.Context, q AuditQuery) ([]AuditRecord, error) {
+	v := url.Values{}
+	for k, val := range map[string]string{"kind": q.Kind, "name": q.Name, "user": q.User} {
+		if val != "" {
+			v.Set(k, val)
+		}
+	}
+	if !q.Since.IsZero() {
+		v.Set("since", strconv.FormatInt(q.Since.Unix(), 10))
+	}
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+	var records []AuditRecord
+	return records, c.do(ctx, http.MethodGet, "/audit?"+v.Encode(), nil, &records)
+}
+
+// ExportBundle exports the specs of all jobs, announcements and files
+func (c *Client) ExportBundle(ctx context.Context) (*Bundle, error) {
+	bundle := new(Bundle)
+	return bundle, c.do(ctx, http.MethodGet, "/bundle", nil, bundle)
+}
+
+// ImportBundle imports a bundle, conflict is one of fail, skip or overwrite and nothing is changed if dryRun is set
+func (c *Client) ImportBundle(ctx context.Context, bundle *Bundle, dryRun bool, conflict string) (*BundleResult, error) {
+	v := url.Values{}
+	v.Set("dryRun", strconv.FormatBool(dryRun))
+	if conflict != "" {
+		v.Set("conflict", conflict)
+	}
+	result := new(BundleResult)
+	return result, c.do(ctx, http.MethodPost, "/bundle?"+v.Encode(), bundle, result)
+}
+
+// ImportTunasync creates jobs from the mirrors of a tunasync worker.conf, nothing is created if dryRun is set
+func (c *Client) ImportTunasync(ctx context.Context, config []byte, dryRun bool) (*ImportResult, error) {
+	result := new(ImportResult)
+	path := "/import/tunasync?dryRun=" + strconv.FormatBool(dryRun)
+	return result, c.do(ctx, http.MethodPost, path, rawBody{contentType: "application/toml", data: config}, result)
+}
+
+// Events subscribes to the event stream, the channel is closed when ctx is done or the stream ends,
+// Data of the events is left as json.RawMessage
+func (c *Client) Events(ctx context.Context, types ...string) (<-chan Event, error) {
+	path := "/events"
+	if len(types) > 0 {
+		path += "?types=" + url.QueryEscape(strings.Join(types, ","))
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	// the stream must not be cut by the client timeout
+	hc := *c.http
+	hc.Timeout = 0
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	ch := make(chan Event)
+	go func() {
+		defer close(ch)
+		defer resp.Body.Close()
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+		var id uint64
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				id, _ = strconv.ParseUint(line[4:], 10, 64)
+			case strings.HasPrefix(line, "data: "):
+				var e struct {
+					Event
+					Data json.RawMessage `json:"data,omitempty"`
+				}
+				if json.Unmarshal([]byte(line[6:]), &e) != nil {
+					continue
+				}
+				e.Event.ID, e.Event.Data = id, e.Data
+				select {
+				case ch <- e.Event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
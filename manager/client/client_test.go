@@ -0,0 +1,79 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = io.WriteString(w, `{"error":"authorization required"}`)
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "POST /job/centos/schedule":
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			_, _ = io.WriteString(w, `{}`)
+		case "GET /job/centos":
+			_, _ = io.WriteString(w, `{"status":"success","nextSchedule":42}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `{"error":"not found"}`)
+		}
+	}))
+	defer server.Close()
+
+	c := New(server.URL, WithToken("secret"))
+	if err := c.UpdateSchedule(context.Background(), "centos", 42); err != nil {
+		t.Fatal(err)
+	}
+	if body["nextSchedule"] != float64(42) {
+		t.Fatalf("unexpected schedule body %v", body)
+	}
+
+	status, err := c.GetJob(context.Background(), "centos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != "success" || status.Scheduled != 42 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	err = New(server.URL).DeleteJob(context.Background(), "centos")
+	var e *Error
+	if !errors.As(err, &e) || e.Code != http.StatusUnauthorized || e.Message != "authorization required" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestMirrorScheduleLegacyField(t *testing.T) {
+	var s MirrorSchedule
+	if err := json.Unmarshal([]byte(`{"next_schedule":7}`), &s); err != nil || s.NextSchedule != 7 {
+		t.Fatalf("legacy field not accepted: %v %+v", err, s)
+	}
+}
@@ -22,6 +22,9 @@ import (
 	"flag"
 	"github.com/CQUPTMirror/kubesync/manager/mirrorz"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -71,11 +74,40 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	var oauth *manager.OAuthConfig
+	if provider := os.Getenv("OAUTH_PROVIDER"); provider != "" {
+		var ttl time.Duration
+		if s := os.Getenv("SESSION_TTL"); s != "" {
+			var err error
+			if ttl, err = time.ParseDuration(s); err != nil {
+				setupLog.Error(err, "invalid SESSION_TTL")
+				os.Exit(1)
+			}
+		}
+		oauth = &manager.OAuthConfig{
+			Provider:       provider,
+			URL:            os.Getenv("OAUTH_URL"),
+			ClientID:       os.Getenv("OAUTH_CLIENT_ID"),
+			ClientSecret:   os.Getenv("OAUTH_CLIENT_SECRET"),
+			RedirectURL:    os.Getenv("OAUTH_REDIRECT_URL"),
+			Scopes:         getListEnv("OAUTH_SCOPES"),
+			GroupsClaim:    os.Getenv("OAUTH_GROUPS_CLAIM"),
+			AdminGroups:    getListEnv("OAUTH_ADMIN_GROUPS"),
+			OperatorGroups: getListEnv("OAUTH_OPERATOR_GROUPS"),
+			SessionSecret:  os.Getenv("SESSION_SECRET"),
+			SessionTTL:     ttl,
+		}
+	}
+
+	auditSize, _ := strconv.Atoi(os.Getenv("AUDIT_SIZE"))
+
 	mgr, err := manager.GetTUNASyncManager(ctrl.GetConfigOrDie(), manager.Options{
-		Scheme:  scheme,
-		Address: apiAddr,
-		MirrorZ: mirrorZ,
-		Total:   os.Getenv("TOTAL"),
+		Scheme:    scheme,
+		Address:   apiAddr,
+		MirrorZ:   mirrorZ,
+		Total:     os.Getenv("TOTAL"),
+		OAuth:     oauth,
+		AuditSize: auditSize,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start api service")
@@ -88,3 +120,10 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+func getListEnv(key string) []string {
+	if v := os.Getenv(key); v != "" {
+		return strings.Split(v, ";")
+	}
+	return nil
+}
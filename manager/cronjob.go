@@ -0,0 +1,118 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/CQUPTMirror/kubesync/internal"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// getSyncCronJob returns the CronJob syncing a job in the cronjob sync mode, or nil if a worker syncs the job
+func (m *Manager) getSyncCronJob(ctx context.Context, mirrorID string) (*batchv1.CronJob, error) {
+	if m.apiReader == nil {
+		return nil, nil
+	}
+	cj := new(batchv1.CronJob)
+	if err := m.apiReader.Get(ctx, client.ObjectKey{Name: mirrorID}, cj); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	if cj.Labels[internal.SyncJobLabel] != mirrorID {
+		return nil, nil
+	}
+	return cj, nil
+}
+
+// runningSyncJobs returns the unfinished Jobs syncing a job in the cronjob sync mode
+func (m *Manager) runningSyncJobs(ctx context.Context, mirrorID string) ([]batchv1.Job, error) {
+	var jobs batchv1.JobList
+	if err := m.apiReader.List(ctx, &jobs, client.MatchingLabels{internal.SyncJobLabel: mirrorID}); err != nil {
+		return nil, err
+	}
+	running := make([]batchv1.Job, 0, len(jobs.Items))
+	for _, job := range jobs.Items {
+		if job.DeletionTimestamp == nil && !syncJobFinished(&job) {
+			running = append(running, job)
+		}
+	}
+	return running, nil
+}
+
+func syncJobFinished(job *batchv1.Job) bool {
+	for _, c := range job.Status.Conditions {
+		if (c.Type == batchv1.JobComplete || c.Type == batchv1.JobFailed) && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// runCronJobCmd runs a command on a job in the cronjob sync mode. Start creates a Job from the CronJob
+// like kubectl create job --from, stop deletes the running Job and restart does both
+func (m *Manager) runCronJobCmd(ctx context.Context, cj *batchv1.CronJob, cmd internal.ClientCmd) (int, error) {
+	running, err := m.runningSyncJobs(ctx, cj.Name)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to list the syncs of %s: %w", cj.Name, err)
+	}
+	switch cmd.Cmd {
+	case internal.CmdPing:
+		return http.StatusOK, nil
+	case internal.CmdStop, internal.CmdRestart:
+		for _, job := range running {
+			if err := m.client.Delete(ctx, &job, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+				return http.StatusInternalServerError, fmt.Errorf("failed to stop sync %s: %w", job.Name, err)
+			}
+		}
+		if cmd.Cmd == internal.CmdStop {
+			return http.StatusOK, nil
+		}
+	case internal.CmdStart:
+		if len(running) > 0 {
+			return http.StatusConflict, fmt.Errorf("sync %s of %s is running", running[0].Name, cj.Name)
+		}
+	default:
+		return http.StatusNotAcceptable, errors.New("invalid command")
+	}
+
+	annotations := map[string]string{"cronjob.kubernetes.io/instantiate": "manual"}
+	for k, v := range cj.Spec.JobTemplate.Annotations {
+		annotations[k] = v
+	}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            fmt.Sprintf("%s-manual-%d", cj.Name, time.Now().Unix()),
+			Namespace:       cj.Namespace,
+			Labels:          cj.Spec.JobTemplate.Labels,
+			Annotations:     annotations,
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(cj, batchv1.SchemeGroupVersion.WithKind("CronJob"))},
+		},
+		Spec: *cj.Spec.JobTemplate.Spec.DeepCopy(),
+	}
+	if err := m.client.Create(ctx, job); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to start sync of %s: %w", cj.Name, err)
+	}
+	return http.StatusOK, nil
+}
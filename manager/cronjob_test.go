@@ -0,0 +1,101 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package manager
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/CQUPTMirror/kubesync/internal"
+)
+
+func TestRunCronJobCmd(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := batchv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	labels := map[string]string{internal.SyncJobLabel: "debian"}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "debian", Labels: labels},
+			Spec:       batchv1.CronJobSpec{JobTemplate: batchv1.JobTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: labels}}},
+		},
+		&batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "other"}},
+	).Build()
+	m := &Manager{client: c, apiReader: c}
+	ctx := context.Background()
+
+	if cj, err := m.getSyncCronJob(ctx, "other"); err != nil || cj != nil {
+		t.Fatalf("a CronJob not made by the controller should be ignored, got %v %v", cj, err)
+	}
+	cj, err := m.getSyncCronJob(ctx, "debian")
+	if err != nil || cj == nil {
+		t.Fatalf("failed to get the CronJob: %v", err)
+	}
+
+	if code, err := m.runCronJobCmd(ctx, cj, internal.ClientCmd{Cmd: internal.CmdStart}); err != nil {
+		t.Fatalf("start failed with %d: %v", code, err)
+	}
+	var jobs batchv1.JobList
+	if err := c.List(ctx, &jobs, client.MatchingLabels(labels)); err != nil || len(jobs.Items) != 1 {
+		t.Fatalf("expected one sync, got %v %v", jobs.Items, err)
+	}
+	if ref := metav1.GetControllerOf(&jobs.Items[0]); ref == nil || ref.Name != "debian" {
+		t.Errorf("the sync should be owned by the CronJob, got %v", ref)
+	}
+	if code, _ := m.runCronJobCmd(ctx, cj, internal.ClientCmd{Cmd: internal.CmdStart}); code != http.StatusConflict {
+		t.Errorf("starting a running sync should conflict, got %d", code)
+	}
+
+	if code, err := m.runCronJobCmd(ctx, cj, internal.ClientCmd{Cmd: internal.CmdStop}); err != nil {
+		t.Fatalf("stop failed with %d: %v", code, err)
+	}
+	if running, err := m.runningSyncJobs(ctx, "debian"); err != nil || len(running) != 0 {
+		t.Errorf("the sync should be stopped, got %v %v", running, err)
+	}
+}
+
+func TestCronJobLog(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := batchv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "debian", Labels: map[string]string{internal.SyncJobLabel: "debian"}},
+	}).Build()
+	m := &Manager{client: c, apiReader: c}
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/job/:id/log", m.getJobLatestLog)
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/job/debian/log", nil))
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "CronJob debian") {
+		t.Errorf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,250 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+	"github.com/CQUPTMirror/kubesync/internal"
+	"github.com/gin-gonic/gin"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+const (
+	_eventBuffer    = 64
+	_eventHeartbeat = 15 * time.Second
+)
+
+// eventHub fans out events to the subscribers, slow subscribers are dropped
+// so that they reconnect instead of blocking the informers
+type eventHub struct {
+	mu          sync.Mutex
+	seq         uint64
+	subscribers map[chan internal.Event]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: make(map[chan internal.Event]struct{})}
+}
+
+func (h *eventHub) subscribe() chan internal.Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch := make(chan internal.Event, _eventBuffer)
+	h.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan internal.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscribers[ch]; ok {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (h *eventHub) publish(e internal.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	e.ID = h.seq
+	e.Time = time.Now().Unix()
+	for ch := range h.subscribers {
+		select {
+		case ch <- e:
+		default:
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// watchEvents registers handlers on the informers of the manager cache,
+// it must be called before the cache is started
+func (m *Manager) watchEvents(ctx context.Context) error {
+	// the templates the job events are merged over are synced with the jobs
+	if _, err := m.cache.GetInformer(ctx, &v1beta1.JobTemplate{}); err != nil {
+		return err
+	}
+	jobInformer, err := m.cache.GetInformer(ctx, &v1beta1.Job{})
+	if err != nil {
+		return err
+	}
+	if _, err = jobInformer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		// jobs are published merged over their template, as /jobs lists them
+		AddFunc: func(obj interface{}) {
+			job, ok := obj.(*v1beta1.Job)
+			if !ok {
+				return
+			}
+			if job = m.mergedJob(ctx, job); job.Spec.Config.Type != v1beta1.External {
+				m.events.publish(internal.Event{Type: internal.EventJob, Action: internal.EventAdded, Name: job.Name, Data: mirrorStatus(job)})
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			o, ok1 := oldObj.(*v1beta1.Job)
+			n, ok2 := newObj.(*v1beta1.Job)
+			if !ok1 || !ok2 {
+				return
+			}
+			if n = m.mergedJob(ctx, n); n.Spec.Config.Type == v1beta1.External {
+				return
+			}
+			if o.Status.Status != n.Status.Status {
+				m.history.add(o, n)
+				m.events.publish(internal.Event{Type: internal.EventJob, Action: internal.EventUpdated, Name: n.Name, Data: mirrorStatus(n)})
+			}
+			if o.Status.Scheduled != n.Status.Scheduled {
+				m.events.publish(internal.Event{Type: internal.EventSchedule, Action: internal.EventUpdated, Name: n.Name,
+					Data: internal.MirrorSchedule{NextSchedule: n.Status.Scheduled}})
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if d, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+				obj = d.Obj
+			}
+			if job, ok := obj.(*v1beta1.Job); ok && job.Spec.Config.Type != v1beta1.External {
+				m.history.remove(job.Name)
+				m.events.publish(internal.Event{Type: internal.EventJob, Action: internal.EventDeleted, Name: job.Name})
+			}
+		},
+	}); err != nil {
+		return err
+	}
+
+	announcementInformer, err := m.cache.GetInformer(ctx, &v1beta1.Announcement{})
+	if err != nil {
+		return err
+	}
+	announcementInfo := func(obj interface{}) (string, interface{}) {
+		if v, ok := obj.(*v1beta1.Announcement); ok {
+			return v.Name, internal.AnnouncementInfo{ID: v.Name, Title: v.Spec.Title, Author: v.Spec.Author, Content: v.Spec.Content, AnnouncementStatus: v.Status}
+		}
+		return "", nil
+	}
+	if _, err = announcementInformer.AddEventHandler(m.objectEventHandler(internal.EventAnnouncement, announcementInfo)); err != nil {
+		return err
+	}
+
+	fileInformer, err := m.cache.GetInformer(ctx, &v1beta1.File{})
+	if err != nil {
+		return err
+	}
+	fileInfo := func(obj interface{}) (string, interface{}) {
+		if v, ok := obj.(*v1beta1.File); ok {
+			return v.Name, internal.FileInfo{ID: v.Name, Type: v.Spec.Type, Alias: v.Spec.Alias, FileStatus: v.Status}
+		}
+		return "", nil
+	}
+	_, err = fileInformer.AddEventHandler(m.objectEventHandler(internal.EventFile, fileInfo))
+	return err
+}
+
+// objectEventHandler publishes every change of spec or status, resyncs of unchanged objects are ignored
+func (m *Manager) objectEventHandler(eventType string, info func(obj interface{}) (string, interface{})) toolscache.ResourceEventHandler {
+	return toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if name, data := info(obj); data != nil {
+				m.events.publish(internal.Event{Type: eventType, Action: internal.EventAdded, Name: name, Data: data})
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			_, o := info(oldObj)
+			name, n := info(newObj)
+			if n == nil {
+				return
+			}
+			ob, _ := json.Marshal(o)
+			nb, _ := json.Marshal(n)
+			if string(ob) != string(nb) {
+				m.events.publish(internal.Event{Type: eventType, Action: internal.EventUpdated, Name: name, Data: n})
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if d, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+				obj = d.Obj
+			}
+			if name, data := info(obj); data != nil {
+				m.events.publish(internal.Event{Type: eventType, Action: internal.EventDeleted, Name: name})
+			}
+		},
+	}
+}
+
+// streamEvents pushes events to the client as server-sent events,
+// the types query param limits the event types, split by ','
+func (m *Manager) streamEvents(c *gin.Context) {
+	types := make(map[string]bool)
+	for _, t := range strings.Split(c.Query("types"), ",") {
+		if t != "" {
+			types[t] = true
+		}
+	}
+
+	// the stream lives longer than the write timeout of the server
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		c.Error(err)
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	ch := m.events.subscribe()
+	defer m.events.unsubscribe(ch)
+	heartbeat := time.NewTicker(_eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if len(types) > 0 && !types[e.Type] {
+				continue
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				c.Error(err)
+				continue
+			}
+			if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
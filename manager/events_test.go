@@ -0,0 +1,80 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package manager
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CQUPTMirror/kubesync/internal"
+	"github.com/gin-gonic/gin"
+)
+
+func TestStreamEvents(t *testing.T) {
+	m := &Manager{events: newEventHub()}
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/events", m.streamEvents)
+	server := httptest.NewServer(engine)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events?types=job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %s", ct)
+	}
+
+	// wait for the handler to subscribe
+	for i := 0; ; i++ {
+		m.events.mu.Lock()
+		n := len(m.events.subscribers)
+		m.events.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if i > 100 {
+			t.Fatal("handler did not subscribe")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	m.events.publish(internal.Event{Type: internal.EventFile, Action: internal.EventUpdated, Name: "ubuntu"})
+	m.events.publish(internal.Event{Type: internal.EventJob, Action: internal.EventUpdated, Name: "centos"})
+
+	reader := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 3 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if lines[1] != "event: job" || !strings.Contains(lines[2], `"name":"centos"`) {
+		t.Fatalf("unexpected event %v", lines)
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package manager
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+	"github.com/CQUPTMirror/kubesync/internal"
+	"github.com/gin-gonic/gin"
+)
+
+const _historySize = 100
+
+// jobHistory keeps the latest status transitions of every job in memory
+type jobHistory struct {
+	mu      sync.RWMutex
+	changes map[string][]internal.StatusChange
+}
+
+func newJobHistory() *jobHistory {
+	return &jobHistory{changes: make(map[string][]internal.StatusChange)}
+}
+
+func (h *jobHistory) add(o, n *v1beta1.Job) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	changes := append(h.changes[n.Name], internal.StatusChange{
+		Time:     time.Now().Unix(),
+		From:     o.Status.Status,
+		To:       n.Status.Status,
+		Size:     n.Status.Size,
+		ErrorMsg: n.Status.ErrorMsg,
+	})
+	if len(changes) > _historySize {
+		changes = changes[len(changes)-_historySize:]
+	}
+	h.changes[n.Name] = changes
+}
+
+func (h *jobHistory) remove(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.changes, name)
+}
+
+// get returns the status transitions of the job, newest first
+func (h *jobHistory) get(name string) []internal.StatusChange {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	changes := h.changes[name]
+	history := make([]internal.StatusChange, 0, len(changes))
+	for i := len(changes) - 1; i >= 0; i-- {
+		history = append(history, changes[i])
+	}
+	return history
+}
+
+// getJobHistory respond with the status transitions seen since the manager started
+func (m *Manager) getJobHistory(c *gin.Context) {
+	c.JSON(http.StatusOK, m.history.get(c.Param("id")))
+}
@@ -0,0 +1,88 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package manager
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+	"github.com/CQUPTMirror/kubesync/internal"
+	"github.com/CQUPTMirror/kubesync/internal/tunasync"
+)
+
+const _maxImportBody = 1 << 20
+
+// importTunasync creates the jobs translated from a tunasync worker.conf,
+// jobs which already exist are reported and left untouched
+func (m *Manager) importTunasync(c *gin.Context) {
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, _maxImportBody))
+	if err != nil {
+		err := fmt.Errorf("failed to read config: %s", err.Error())
+		c.Error(err)
+		m.returnErrJSON(c, http.StatusBadRequest, err)
+		return
+	}
+	jobs, warnings, err := tunasync.Import(data, nil)
+	if err != nil {
+		err := fmt.Errorf("failed to parse config: %s", err.Error())
+		c.Error(err)
+		m.returnErrJSON(c, http.StatusBadRequest, err)
+		return
+	}
+	dryRun, _ := strconv.ParseBool(c.Query("dryRun"))
+
+	result := internal.ImportResult{Jobs: []internal.ImportedJob{}, Warnings: warnings}
+	if result.Warnings == nil {
+		result.Warnings = []internal.ImportWarning{}
+	}
+
+	m.rwmu.Lock()
+	defer m.rwmu.Unlock()
+	for _, job := range jobs {
+		imported := internal.ImportedJob{ID: job.Name, Spec: job.Spec}
+		err := m.client.Get(c.Request.Context(), client.ObjectKey{Name: job.Name}, new(v1beta1.Job))
+		switch {
+		case err == nil:
+			imported.Result = "exists"
+		case !apierrors.IsNotFound(err):
+			imported.Result = "failed"
+			imported.Error = err.Error()
+		case dryRun:
+			imported.Result = "dry-run"
+		default:
+			err = m.client.Patch(c.Request.Context(), &job, client.Apply, []client.PatchOption{client.ForceOwnership, client.FieldOwner("mirror-controller")}...)
+			if err != nil {
+				imported.Result = "failed"
+				imported.Error = err.Error()
+				runLog.Error(err, fmt.Sprintf("failed to import job %s", job.Name))
+			} else {
+				imported.Result = "created"
+				runLog.Info(fmt.Sprintf("Job <%s> imported", job.Name))
+			}
+		}
+		result.Jobs = append(result.Jobs, imported)
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,427 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package manager
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CQUPTMirror/kubesync/internal"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+)
+
+const (
+	ProviderOIDC   = "oidc"
+	ProviderGitHub = "github"
+	ProviderGitea  = "gitea"
+
+	_sessionCookie = "kubesync_session"
+	_stateCookie   = "kubesync_oauth"
+	_stateTTL      = 10 * time.Minute
+)
+
+// OAuthConfig configures the login of dashboard users through an external identity provider
+type OAuthConfig struct {
+	// Provider is one of oidc, github and gitea
+	Provider string
+	// URL is the issuer for oidc, the server address for gitea and github enterprise
+	URL          string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// GroupsClaim is the id token claim holding the groups of the user, only used by oidc
+	GroupsClaim string
+
+	// AdminGroups and OperatorGroups map the groups of the user to roles,
+	// github and gitea groups are organizations and org/team
+	AdminGroups    []string
+	OperatorGroups []string
+
+	SessionSecret string
+	SessionTTL    time.Duration
+}
+
+type oauth struct {
+	config   *OAuthConfig
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+	apiBase  string
+	client   *http.Client
+}
+
+type oauthState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Redirect string `json:"redirect"`
+	Expire   int64  `json:"exp"`
+}
+
+type session struct {
+	Name   string        `json:"name"`
+	Role   internal.Role `json:"role"`
+	Expire int64         `json:"exp"`
+}
+
+func newOAuth(ctx context.Context, config *OAuthConfig, hc *http.Client) (*oauth, error) {
+	if config.SessionSecret == "" {
+		return nil, errors.New("session secret is required for oauth login")
+	}
+	if config.SessionTTL == 0 {
+		config.SessionTTL = 12 * time.Hour
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+
+	o := &oauth{
+		config: config,
+		client: hc,
+		oauth2: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Scopes:       config.Scopes,
+		},
+	}
+
+	base := strings.TrimSuffix(config.URL, "/")
+	switch config.Provider {
+	case ProviderOIDC:
+		provider, err := oidc.NewProvider(oidc.ClientContext(ctx, hc), config.URL)
+		if err != nil {
+			return nil, err
+		}
+		o.oauth2.Endpoint = provider.Endpoint()
+		o.verifier = provider.Verifier(&oidc.Config{ClientID: config.ClientID})
+		if len(o.oauth2.Scopes) == 0 {
+			// the groups claim is not a scope, providers needing one for it get it through Scopes
+			o.oauth2.Scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+		}
+	case ProviderGitHub:
+		if base == "" || base == "https://github.com" {
+			base, o.apiBase = "https://github.com", "https://api.github.com"
+		} else {
+			o.apiBase = base + "/api/v3"
+		}
+		if len(o.oauth2.Scopes) == 0 {
+			o.oauth2.Scopes = []string{"read:org"}
+		}
+	case ProviderGitea:
+		if base == "" {
+			return nil, errors.New("gitea address is required for oauth login")
+		}
+		o.apiBase = base + "/api/v1"
+	default:
+		return nil, fmt.Errorf("unknown oauth provider %s", config.Provider)
+	}
+	if o.verifier == nil {
+		o.oauth2.Endpoint = oauth2.Endpoint{
+			AuthURL:  base + "/login/oauth/authorize",
+			TokenURL: base + "/login/oauth/access_token",
+		}
+	}
+
+	return o, nil
+}
+
+// identify exchanges the authorization code and returns the user name and groups
+func (o *oauth) identify(ctx context.Context, code, nonce string) (string, []string, error) {
+	ctx = oidc.ClientContext(ctx, o.client)
+	token, err := o.oauth2.Exchange(ctx, code)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if o.verifier != nil {
+		raw, ok := token.Extra("id_token").(string)
+		if !ok {
+			return "", nil, errors.New("no id_token in token response")
+		}
+		idToken, err := o.verifier.Verify(ctx, raw)
+		if err != nil {
+			return "", nil, err
+		}
+		if idToken.Nonce != nonce {
+			return "", nil, errors.New("id_token nonce mismatch")
+		}
+		claims := map[string]interface{}{}
+		if err := idToken.Claims(&claims); err != nil {
+			return "", nil, err
+		}
+		name := idToken.Subject
+		for _, k := range []string{"preferred_username", "email"} {
+			if v, ok := claims[k].(string); ok && v != "" {
+				name = v
+				break
+			}
+		}
+		var groups []string
+		if v, ok := claims[o.config.GroupsClaim].([]interface{}); ok {
+			for _, g := range v {
+				if s, ok := g.(string); ok {
+					groups = append(groups, s)
+				}
+			}
+		}
+		return name, groups, nil
+	}
+
+	hc := o.oauth2.Client(ctx, token)
+	var user struct {
+		Login    string `json:"login"`
+		Username string `json:"username"`
+	}
+	if err := getJSON(hc, o.apiBase+"/user", &user); err != nil {
+		return "", nil, err
+	}
+	name := user.Login
+	if name == "" {
+		name = user.Username
+	}
+
+	var orgs []struct {
+		Login    string `json:"login"`
+		Username string `json:"username"`
+	}
+	if err := getJSON(hc, o.apiBase+"/user/orgs", &orgs); err != nil {
+		return "", nil, err
+	}
+	var groups []string
+	for _, v := range orgs {
+		if v.Login != "" {
+			groups = append(groups, v.Login)
+		} else {
+			groups = append(groups, v.Username)
+		}
+	}
+
+	var teams []struct {
+		Name         string `json:"name"`
+		Slug         string `json:"slug"`
+		Organization struct {
+			Login    string `json:"login"`
+			Username string `json:"username"`
+		} `json:"organization"`
+	}
+	if err := getJSON(hc, o.apiBase+"/user/teams", &teams); err != nil {
+		return "", nil, err
+	}
+	for _, v := range teams {
+		org, team := v.Organization.Login, v.Slug
+		if org == "" {
+			org = v.Organization.Username
+		}
+		if team == "" {
+			team = v.Name
+		}
+		groups = append(groups, org+"/"+team)
+	}
+
+	return name, groups, nil
+}
+
+// role returns the highest role the groups are mapped to
+func (o *oauth) role(groups []string) internal.Role {
+	role := internal.RolePublic
+	for _, g := range groups {
+		for _, v := range o.config.AdminGroups {
+			if g == v {
+				return internal.RoleAdmin
+			}
+		}
+		for _, v := range o.config.OperatorGroups {
+			if g == v {
+				role = internal.RoleOperator
+			}
+		}
+	}
+	return role
+}
+
+// sign serializes v into a cookie value protected by the session secret
+func (o *oauth) sign(v interface{}) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, []byte(o.config.SessionSecret))
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verify checks a cookie value created by sign and unmarshals it into v
+func (o *oauth) verify(value string, v interface{}) error {
+	p, s, ok := strings.Cut(value, ".")
+	if !ok {
+		return errors.New("malformed cookie")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(p)
+	if err != nil {
+		return err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, []byte(o.config.SessionSecret))
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return errors.New("invalid cookie signature")
+	}
+	return json.Unmarshal(payload, v)
+}
+
+func (o *oauth) setCookie(c *gin.Context, name, value string, ttl time.Duration) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(ttl.Seconds()),
+		Secure:   strings.HasPrefix(o.config.RedirectURL, "https://"),
+		HttpOnly: true,
+		// Lax keeps the cookie away from cross site POST requests
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// sessionIdentity returns the identity of a valid session cookie, or nil
+func (o *oauth) sessionIdentity(c *gin.Context) *internal.Identity {
+	value, err := c.Cookie(_sessionCookie)
+	if err != nil {
+		return nil
+	}
+	var s session
+	if err := o.verify(value, &s); err != nil || time.Now().Unix() > s.Expire {
+		return nil
+	}
+	return &internal.Identity{Name: s.Name, Role: s.Role}
+}
+
+func (m *Manager) authLogin(c *gin.Context) {
+	redirect := c.Query("redirect")
+	// only allow redirecting to local paths
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") {
+		redirect = "/"
+	}
+	state := oauthState{
+		State:    randomString(),
+		Nonce:    randomString(),
+		Redirect: redirect,
+		Expire:   time.Now().Add(_stateTTL).Unix(),
+	}
+	value, err := m.oauth.sign(state)
+	if err != nil {
+		err := fmt.Errorf("failed to create oauth state: %s", err.Error())
+		c.Error(err)
+		m.returnErrJSON(c, http.StatusInternalServerError, err)
+		return
+	}
+	m.oauth.setCookie(c, _stateCookie, value, _stateTTL)
+
+	var opts []oauth2.AuthCodeOption
+	if m.oauth.verifier != nil {
+		opts = append(opts, oidc.Nonce(state.Nonce))
+	}
+	c.Redirect(http.StatusFound, m.oauth.oauth2.AuthCodeURL(state.State, opts...))
+}
+
+func (m *Manager) authCallback(c *gin.Context) {
+	var state oauthState
+	value, err := c.Cookie(_stateCookie)
+	if err == nil {
+		err = m.oauth.verify(value, &state)
+	}
+	if err != nil || time.Now().Unix() > state.Expire || state.State != c.Query("state") {
+		m.returnErrJSON(c, http.StatusBadRequest, errors.New("invalid oauth state"))
+		return
+	}
+	m.oauth.setCookie(c, _stateCookie, "", -1)
+
+	if e := c.Query("error"); e != "" {
+		m.returnErrJSON(c, http.StatusUnauthorized, fmt.Errorf("login failed: %s", e))
+		return
+	}
+
+	name, groups, err := m.oauth.identify(c.Request.Context(), c.Query("code"), state.Nonce)
+	if err != nil {
+		err := fmt.Errorf("failed to identify user: %s", err.Error())
+		c.Error(err)
+		m.returnErrJSON(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	s := session{
+		Name:   name,
+		Role:   m.oauth.role(groups),
+		Expire: time.Now().Add(m.oauth.config.SessionTTL).Unix(),
+	}
+	value, err = m.oauth.sign(s)
+	if err != nil {
+		err := fmt.Errorf("failed to create session: %s", err.Error())
+		c.Error(err)
+		m.returnErrJSON(c, http.StatusInternalServerError, err)
+		return
+	}
+	m.oauth.setCookie(c, _sessionCookie, value, m.oauth.config.SessionTTL)
+	c.Redirect(http.StatusFound, state.Redirect)
+}
+
+func (m *Manager) authLogout(c *gin.Context) {
+	m.oauth.setCookie(c, _sessionCookie, "", -1)
+	c.JSON(http.StatusOK, gin.H{_infoKey: "logged out"})
+}
+
+func (m *Manager) authMe(c *gin.Context) {
+	c.JSON(http.StatusOK, getIdentity(c))
+}
+
+func getJSON(hc *http.Client, url string, obj interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(obj)
+}
+
+func randomString() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
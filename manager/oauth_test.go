@@ -0,0 +1,226 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package manager
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/CQUPTMirror/kubesync/internal"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v3"
+)
+
+// mockIssuer is a minimal OIDC issuer which accepts any authorization code
+type mockIssuer struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	nonce  string
+	groups []string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                m.URL,
+			"authorization_endpoint":                m.URL + "/authorize",
+			"token_endpoint":                        m.URL + "/token",
+			"jwks_uri":                              m.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &m.key.PublicKey, KeyID: "test", Algorithm: string(jose.RS256), Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: m.key},
+			(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "test"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		claims, _ := json.Marshal(map[string]interface{}{
+			"iss":                m.URL,
+			"sub":                "42",
+			"aud":                "kubesync",
+			"exp":                time.Now().Add(time.Hour).Unix(),
+			"iat":                time.Now().Unix(),
+			"nonce":              m.nonce,
+			"preferred_username": "maintainer",
+			"groups":             m.groups,
+		})
+		jws, err := signer.Sign(claims)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		idToken, _ := jws.CompactSerialize()
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+func newOAuthTestManager(t *testing.T, issuer *mockIssuer) *gin.Engine {
+	o, err := newOAuth(context.Background(), &OAuthConfig{
+		Provider:       ProviderOIDC,
+		URL:            issuer.URL,
+		ClientID:       "kubesync",
+		ClientSecret:   "secret",
+		RedirectURL:    "http://manager/auth/callback",
+		AdminGroups:    []string{"mirror-admin"},
+		OperatorGroups: []string{"mirror-maintainer"},
+		SessionSecret:  "session-secret",
+	}, issuer.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Manager{oauth: o}
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(m.authenticate)
+	engine.GET("/auth/login", m.authLogin)
+	engine.GET("/auth/callback", m.authCallback)
+	engine.GET("/auth/me", m.authMe)
+	engine.POST("/job/:id/cmd", m.authorize(internal.RoleOperator), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{_infoKey: "ok"})
+	})
+	return engine
+}
+
+func serve(engine *gin.Engine, method, target string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func findCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// login runs the login flow against the mock issuer and returns the session cookie
+func login(t *testing.T, engine *gin.Engine, issuer *mockIssuer) *http.Cookie {
+	w := serve(engine, http.MethodGet, "/auth/login?redirect=/dashboard")
+	if w.Code != http.StatusFound {
+		t.Fatalf("login returned %d", w.Code)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.nonce = location.Query().Get("nonce")
+	state := findCookie(w, _stateCookie)
+	if state == nil {
+		t.Fatal("no state cookie")
+	}
+
+	w = serve(engine, http.MethodGet, "/auth/callback?code=abc&state="+location.Query().Get("state"), state)
+	if w.Code != http.StatusFound {
+		t.Fatalf("callback returned %d: %s", w.Code, w.Body.String())
+	}
+	if l := w.Header().Get("Location"); l != "/dashboard" {
+		t.Fatalf("callback redirected to %s", l)
+	}
+	sess := findCookie(w, _sessionCookie)
+	if sess == nil {
+		t.Fatal("no session cookie")
+	}
+	return sess
+}
+
+func TestOAuthLogin(t *testing.T) {
+	issuer := newMockIssuer(t)
+	issuer.groups = []string{"students", "mirror-maintainer"}
+	engine := newOAuthTestManager(t, issuer)
+
+	sess := login(t, engine, issuer)
+
+	w := serve(engine, http.MethodGet, "/auth/me", sess)
+	var id internal.Identity
+	if err := json.Unmarshal(w.Body.Bytes(), &id); err != nil {
+		t.Fatal(err)
+	}
+	if id.Name != "maintainer" || id.Role != internal.RoleOperator {
+		t.Fatalf("unexpected identity %+v", id)
+	}
+
+	if w := serve(engine, http.MethodPost, "/job/centos/cmd", sess); w.Code != http.StatusOK {
+		t.Fatalf("operator session got %d", w.Code)
+	}
+}
+
+func TestOAuthLoginWithoutRole(t *testing.T) {
+	issuer := newMockIssuer(t)
+	issuer.groups = []string{"students"}
+	engine := newOAuthTestManager(t, issuer)
+
+	sess := login(t, engine, issuer)
+	if w := serve(engine, http.MethodPost, "/job/centos/cmd", sess); w.Code != http.StatusUnauthorized {
+		t.Fatalf("session without role got %d", w.Code)
+	}
+}
+
+func TestOAuthRejectsBadStateAndSession(t *testing.T) {
+	issuer := newMockIssuer(t)
+	issuer.groups = []string{"mirror-admin"}
+	engine := newOAuthTestManager(t, issuer)
+
+	w := serve(engine, http.MethodGet, "/auth/login")
+	state := findCookie(w, _stateCookie)
+	if w := serve(engine, http.MethodGet, "/auth/callback?code=abc&state=forged", state); w.Code != http.StatusBadRequest {
+		t.Fatalf("forged state got %d", w.Code)
+	}
+
+	sess := login(t, engine, issuer)
+	sess.Value = "x" + sess.Value
+	if w := serve(engine, http.MethodPost, "/job/centos/cmd", sess); w.Code != http.StatusUnauthorized {
+		t.Fatalf("tampered session got %d", w.Code)
+	}
+}
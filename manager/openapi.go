@@ -0,0 +1,324 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package manager
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+	"github.com/CQUPTMirror/kubesync/internal"
+	"github.com/CQUPTMirror/kubesync/manager/mirrorz"
+	"github.com/gin-gonic/gin"
+)
+
+const _modulePath = "github.com/CQUPTMirror/kubesync"
+
+// apiMessage is the response of most mutating routes
+type apiMessage struct {
+	Message string `json:"message"`
+}
+
+// apiError is the response of failed requests
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// routeDoc describes one route for the OpenAPI document
+type routeDoc struct {
+	Summary string
+	// Role is the minimal role required by the route
+	Role  internal.Role
+	Query []string
+	// Request and Response are zero values of the request and response body
+	Request  interface{}
+	Response interface{}
+	// ContentType of the response, application/json if empty
+	ContentType string
+	// RequestType is the content type of the request, application/json if empty
+	RequestType string
+	// Status of a successful response, 200 if zero
+	Status int
+}
+
+// routeDocs is keyed by the method and gin path of the routes registered in registerRoutes
+var routeDocs = map[string]routeDoc{
+	"GET /auth/login":       {Summary: "Redirect to the identity provider", Query: []string{"redirect"}, Status: http.StatusFound},
+	"GET /auth/callback":    {Summary: "Finish the login and set the session cookie", Query: []string{"code", "state"}, Status: http.StatusFound},
+	"POST /auth/logout":     {Summary: "Clear the session cookie", Response: apiMessage{}},
+	"GET /auth/me":          {Summary: "Get the identity of the caller", Response: internal.Identity{}},
+	"GET /ping":             {Summary: "Health check", Response: apiMessage{}},
+	"GET /jobs":             {Summary: "List jobs", Response: []internal.MirrorStatus{}},
+	"GET /api/mirrors":      {Summary: "List jobs", Response: []internal.MirrorStatus{}},
+	"GET /api/mirrorz.json": {Summary: "Get the mirrorz document", Response: mirrorz.MirrorZ{}},
+
+	"DELETE /job/:id":        {Summary: "Delete a job", Role: internal.RoleAdmin, Response: apiMessage{}},
+	"GET /job/:id":           {Summary: "Get the status of a job", Response: v1beta1.JobStatus{}},
+	"GET /job/:id/config":    {Summary: "Get the config of a job", Role: internal.RoleOperator, Response: internal.MirrorConfig{}},
+	"GET /job/:id/log":       {Summary: "Get the latest sync log of a job", Role: internal.RoleOperator, ContentType: "text/plain"},
+	"GET /job/:id/history":   {Summary: "Get the status transitions of a job seen since the manager started, newest first", Response: []internal.StatusChange{}},
+	"POST /job/:id":          {Summary: "Create a job or merge the fields of each section into the job, a json merge patch when sent as " + mergePatchType, Role: internal.RoleAdmin, Request: v1beta1.JobSpec{}, Response: apiMessage{}},
+	"HEAD /job/:id":          {Summary: "Register the worker of a job", Role: internal.RoleWorker},
+	"PATCH /job/:id":         {Summary: "Report the status of a job", Role: internal.RoleWorker, Request: v1beta1.JobStatus{}, Response: v1beta1.JobStatus{}},
+	"POST /job/:id/size":     {Summary: "Report the size of a job", Role: internal.RoleWorker, Request: internal.SizeMsg{}, Response: v1beta1.Job{}},
+	"POST /job/:id/schedule": {Summary: "Report the next schedule of a job", Role: internal.RoleWorker, Request: internal.MirrorSchedule{}, Response: struct{}{}},
+	"POST /job/:id/enable":   {Summary: "Enable a job", Role: internal.RoleOperator, Response: apiMessage{}},
+	"POST /job/:id/disable":  {Summary: "Disable a job", Role: internal.RoleOperator, Response: apiMessage{}},
+	"POST /job/:id/cmd":      {Summary: "Send a command to the worker of a job", Role: internal.RoleOperator, Request: internal.ClientCmd{}, Response: apiMessage{}},
+
+	"GET /announcements":       {Summary: "List announcements", Response: []internal.AnnouncementInfo{}},
+	"GET /api/news":            {Summary: "List announcements", Response: []internal.AnnouncementInfo{}},
+	"POST /announcement/:id":   {Summary: "Create an announcement or merge the fields into the announcement", Role: internal.RoleOperator, Request: v1beta1.AnnouncementSpec{}, Response: apiMessage{}},
+	"DELETE /announcement/:id": {Summary: "Delete an announcement", Role: internal.RoleOperator, Response: apiMessage{}},
+	"GET /announcement/:id":    {Summary: "Get an announcement", Response: internal.AnnouncementInfo{}},
+
+	"GET /files":       {Summary: "List files", Response: []internal.FileInfo{}},
+	"GET /api/files":   {Summary: "List files", Response: []internal.FileInfo{}},
+	"POST /file/:id":   {Summary: "Update the file list of a job", Role: internal.RoleWorker, Request: internal.FileBase{}, Response: apiMessage{}},
+	"DELETE /file/:id": {Summary: "Delete a file list", Role: internal.RoleOperator, Response: apiMessage{}},
+	"GET /file/:id":    {Summary: "Get a file list", Response: internal.FileInfo{}},
+
+	"GET /events":       {Summary: "Stream changes of jobs, announcements and files, the data of each event is an Event", Query: []string{"types"}, ContentType: "text/event-stream", Response: internal.Event{}},
+	"GET /api/events":   {Summary: "Stream changes of jobs, announcements and files, the data of each event is an Event", Query: []string{"types"}, ContentType: "text/event-stream", Response: internal.Event{}},
+	"GET /audit":        {Summary: "Query the audit log, newest first", Role: internal.RoleOperator, Query: []string{"kind", "name", "user", "since", "limit"}, Response: []internal.AuditRecord{}},
+	"GET /openapi.json": {Summary: "Get this document"},
+
+	"GET /bundle": {Summary: "Export the specs of all job templates, jobs, announcements and files, as yaml with format=yaml", Role: internal.RoleOperator,
+		Query: []string{"format"}, Response: internal.Bundle{}},
+	"POST /bundle": {Summary: "Import a bundle in json or yaml, objects whose spec differs are handled as given by conflict (fail, skip or overwrite)", Role: internal.RoleAdmin,
+		Query: []string{"dryRun", "conflict"}, Request: internal.Bundle{}, Response: internal.BundleResult{}},
+	"POST /import/tunasync": {Summary: "Create jobs from the mirrors of a tunasync worker.conf, existing jobs are left untouched", Role: internal.RoleAdmin,
+		Query: []string{"dryRun"}, Request: "", RequestType: "application/toml", Response: internal.ImportResult{}},
+}
+
+var enumValues = map[reflect.Type][]string{
+	reflect.TypeOf(internal.Role(0)):    {"public", "worker", "operator", "admin"},
+	reflect.TypeOf(internal.CmdVerb(0)): {"start", "stop", "restart", "ping"},
+}
+
+// schemaGenerator builds JSON schemas of go types, named types of this module
+// are collected into components, other struct types are left opaque
+type schemaGenerator struct {
+	components map[string]interface{}
+}
+
+func schemaName(t reflect.Type) string {
+	return path.Base(t.PkgPath()) + "." + t.Name()
+}
+
+func (g *schemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if values, ok := enumValues[t]; ok {
+		return map[string]interface{}{"type": "string", "enum": values}
+	}
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(json.RawMessage{}):
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if !strings.HasPrefix(t.PkgPath(), _modulePath) {
+			return map[string]interface{}{"type": "object", "description": t.String()}
+		}
+		name := schemaName(t)
+		if _, ok := g.components[name]; !ok {
+			// reserve the name first, the type may refer to itself
+			g.components[name] = nil
+			g.components[name] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	g.fields(t, properties, &required)
+	s := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+func (g *schemaGenerator) fields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			g.fields(ft, properties, required)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = g.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// openAPIPath converts a gin path to an OpenAPI path
+func openAPIPath(p string) (string, []string) {
+	var params []string
+	parts := strings.Split(p, "/")
+	for i, v := range parts {
+		if strings.HasPrefix(v, ":") || strings.HasPrefix(v, "*") {
+			params = append(params, v[1:])
+			parts[i] = "{" + v[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/"), params
+}
+
+// openAPIDocument builds the OpenAPI 3 document of the registered routes
+func (m *Manager) openAPIDocument() map[string]interface{} {
+	g := &schemaGenerator{components: make(map[string]interface{})}
+	errorResponse := map[string]interface{}{
+		"description": "Error",
+		"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": g.schema(reflect.TypeOf(apiError{}))}},
+	}
+
+	paths := make(map[string]interface{})
+	for _, r := range m.engine.Routes() {
+		doc := routeDocs[r.Method+" "+r.Path]
+		p, params := openAPIPath(r.Path)
+
+		var parameters []interface{}
+		for _, v := range params {
+			parameters = append(parameters, map[string]interface{}{
+				"name": v, "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		for _, v := range doc.Query {
+			parameters = append(parameters, map[string]interface{}{
+				"name": v, "in": "query", "schema": map[string]interface{}{"type": "string"},
+			})
+		}
+
+		status := doc.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		response := map[string]interface{}{"description": http.StatusText(status)}
+		if doc.Response != nil || doc.ContentType != "" {
+			contentType := doc.ContentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			schema := map[string]interface{}{"type": "string"}
+			if doc.Response != nil {
+				schema = g.schema(reflect.TypeOf(doc.Response))
+			}
+			response["content"] = map[string]interface{}{contentType: map[string]interface{}{"schema": schema}}
+		}
+
+		op := map[string]interface{}{
+			"summary":         doc.Summary,
+			"operationId":     strings.ToLower(r.Method) + strings.NewReplacer("/", "_", ":", "", ".", "_").Replace(r.Path),
+			"responses":       map[string]interface{}{strconv.Itoa(status): response, "default": errorResponse},
+			"x-kubesync-role": doc.Role.String(),
+		}
+		if len(parameters) > 0 {
+			op["parameters"] = parameters
+		}
+		if doc.Request != nil {
+			requestType := doc.RequestType
+			if requestType == "" {
+				requestType = "application/json"
+			}
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  map[string]interface{}{requestType: map[string]interface{}{"schema": g.schema(reflect.TypeOf(doc.Request))}},
+			}
+		}
+		if doc.Role > internal.RolePublic {
+			op["security"] = []interface{}{
+				map[string]interface{}{"bearerAuth": []string{}},
+				map[string]interface{}{"sessionCookie": []string{}},
+			}
+		}
+
+		item, ok := paths[p].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[p] = item
+		}
+		item[strings.ToLower(r.Method)] = op
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "kubesync manager",
+			"version": v1beta1.GroupVersion.Version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.components,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth":    map[string]interface{}{"type": "http", "scheme": "bearer"},
+				"sessionCookie": map[string]interface{}{"type": "apiKey", "in": "cookie", "name": _sessionCookie},
+			},
+		},
+	}
+}
+
+func (m *Manager) openAPI(c *gin.Context) {
+	c.JSON(http.StatusOK, m.openAPIDocument())
+}
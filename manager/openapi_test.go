@@ -0,0 +1,61 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package manager
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/CQUPTMirror/kubesync/manager/mirrorz"
+	"github.com/gin-gonic/gin"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := &Manager{engine: gin.New(), option: &Options{MirrorZ: &mirrorz.MirrorZ{}}, oauth: &oauth{}}
+	m.registerRoutes()
+
+	for _, r := range m.engine.Routes() {
+		if _, ok := routeDocs[r.Method+" "+r.Path]; !ok {
+			t.Errorf("route %s %s is not documented", r.Method, r.Path)
+		}
+	}
+
+	doc, err := json.Marshal(m.openAPIDocument())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed struct {
+		Paths      map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(doc, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := parsed.Paths["/job/{id}/cmd"]["post"]; !ok {
+		t.Fatal("missing POST /job/{id}/cmd")
+	}
+	for _, ref := range regexp.MustCompile(`"#/components/schemas/([^"]+)"`).FindAllStringSubmatch(string(doc), -1) {
+		if parsed.Components.Schemas[ref[1]] == nil {
+			t.Errorf("unresolved schema %s", ref[1])
+		}
+	}
+}
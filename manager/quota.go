@@ -0,0 +1,54 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package manager
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+	"github.com/CQUPTMirror/kubesync/internal"
+)
+
+// jobQuota returns the quota in bytes of a job on a shared volume, its volume size
+func jobQuota(job *v1beta1.Job) (uint64, bool) {
+	if !job.Spec.Volume.Shared() || job.Spec.Volume.Size == "" {
+		return 0, false
+	}
+	q, err := resource.ParseQuantity(job.Spec.Volume.Size)
+	if err != nil || q.Sign() <= 0 {
+		return 0, false
+	}
+	return uint64(q.Value()), true
+}
+
+// checkQuota warns with an event when the size of a job on a shared volume goes over its quota,
+// nothing stops a job from filling the volume of the others
+func (m *Manager) checkQuota(job *v1beta1.Job, oldSize uint64) {
+	quota, ok := jobQuota(job)
+	if !ok || job.Status.Size <= quota || oldSize > quota {
+		return
+	}
+	msg := fmt.Sprintf("size %s exceeds the quota %s on the shared volume", internal.ParseSize(job.Status.Size), job.Spec.Volume.Size)
+	runLog.Info(fmt.Sprintf("Job [%s] %s", job.Name, msg))
+	if m.recorder != nil {
+		m.recorder.Event(job, corev1.EventTypeWarning, "QuotaExceeded", msg)
+	}
+}
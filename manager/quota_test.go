@@ -0,0 +1,55 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package manager
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+func TestCheckQuota(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	m := &Manager{recorder: recorder}
+	job := &v1beta1.Job{ObjectMeta: metav1.ObjectMeta{Name: "debian"}}
+	job.Spec.Volume = v1beta1.PVConfig{Size: "1Ki", HostPath: "/tank/mirror"}
+
+	if quota, ok := jobQuota(job); !ok || quota != 1024 {
+		t.Errorf("unexpected quota %d %v", quota, ok)
+	}
+	job.Status.Size = 512
+	m.checkQuota(job, 0)
+	job.Status.Size = 2048
+	m.checkQuota(job, 512)
+	// only crossing the quota warns
+	m.checkQuota(job, 2048)
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected one event, got %d", len(recorder.Events))
+	}
+	if e := <-recorder.Events; e != "Warning QuotaExceeded size 2.00K exceeds the quota 1Ki on the shared volume" {
+		t.Errorf("unexpected event %q", e)
+	}
+
+	job.Spec.Volume.HostPath = ""
+	if _, ok := jobQuota(job); ok {
+		t.Error("a job with its own PVC has no quota")
+	}
+}
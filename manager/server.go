@@ -25,6 +25,7 @@ import (
 	"fmt"
 	"github.com/CQUPTMirror/kubesync/manager/mirrorz"
 	"io"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"net/http"
 	"os"
@@ -36,9 +37,15 @@ import (
 	"github.com/CQUPTMirror/kubesync/api/v1beta1"
 	"github.com/CQUPTMirror/kubesync/internal"
 	"github.com/CQUPTMirror/kubesync/manager/external"
+	jsonpatch "github.com/evanphx/json-patch"
 	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
@@ -60,6 +67,9 @@ type Options struct {
 	Address string
 	MirrorZ *mirrorz.MirrorZ
 	Total   string
+	OAuth   *OAuthConfig
+	// AuditSize is the number of audit records kept in memory
+	AuditSize int
 }
 
 type Manager struct {
@@ -72,6 +82,12 @@ type Manager struct {
 	address    string
 	rwmu       sync.RWMutex
 	option     *Options
+	oauth      *oauth
+	apiReader  client.Reader
+	recorder   record.EventRecorder
+	auditLog   *auditLog
+	events     *eventHub
+	history    *jobHistory
 }
 
 func contextErrorLogger(c *gin.Context) {
@@ -100,12 +116,24 @@ func GetTUNASyncManager(config *rest.Config, options Options) (*Manager, error)
 		return nil, err
 	}
 
+	// only token Secrets are cached, the manager has no business with other Secrets
+	tokenSelector, err := labels.Parse(internal.TokenLabel)
+	if err != nil {
+		return nil, err
+	}
+
 	cc, err := cache.New(config, cache.Options{
 		Scheme:            options.Scheme,
 		Mapper:            mapper,
 		SyncPeriod:        &defaultRetryPeriod,
 		DefaultNamespaces: map[string]cache.Config{namespace: {}},
+		ByObject: map[client.Object]cache.ByObject{
+			&corev1.Secret{}: {Label: tokenSelector},
+		},
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	c, err := client.New(config, client.Options{Scheme: options.Scheme, Mapper: mapper, Cache: &client.CacheOptions{Reader: cc}})
 	if err != nil {
@@ -114,6 +142,19 @@ func GetTUNASyncManager(config *rest.Config, options Options) (*Manager, error)
 
 	nc := client.NewNamespacedClient(c, namespace)
 
+	// the api reader reads objects without cache, used to audit the changes of a request
+	ac, err := client.New(config, client.Options{Scheme: options.Scheme, Mapper: mapper})
+	if err != nil {
+		return nil, err
+	}
+
+	cs, err := kubernetes.NewForConfigAndClient(config, rhc)
+	if err != nil {
+		return nil, err
+	}
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: cs.CoreV1().Events(namespace)})
+
 	hc := &http.Client{
 		Transport: &http.Transport{MaxIdleConnsPerHost: 100},
 		Timeout:   5 * time.Second,
@@ -126,6 +167,21 @@ func GetTUNASyncManager(config *rest.Config, options Options) (*Manager, error)
 		cache:      cc,
 		address:    options.Address,
 		option:     &options,
+		apiReader:  client.NewNamespacedClient(ac, namespace),
+		recorder:   broadcaster.NewRecorder(options.Scheme, corev1.EventSource{Component: "kubesync-manager"}),
+		auditLog:   newAuditLog(options.AuditSize),
+		events:     newEventHub(),
+		history:    newJobHistory(),
+	}
+
+	if err := s.watchEvents(s.internal); err != nil {
+		return nil, err
+	}
+
+	if options.OAuth != nil {
+		if s.oauth, err = newOAuth(s.internal, options.OAuth, hc); err != nil {
+			return nil, err
+		}
 	}
 
 	gin.SetMode(gin.ReleaseMode)
@@ -136,6 +192,26 @@ func GetTUNASyncManager(config *rest.Config, options Options) (*Manager, error)
 	// common log middleware
 	s.engine.Use(contextErrorLogger)
 
+	// resolve the caller from the bearer token or session cookie
+	s.engine.Use(s.authenticate)
+
+	s.registerRoutes()
+
+	return s, nil
+}
+
+// registerRoutes registers all api routes, each route should be described in routeDocs
+func (s *Manager) registerRoutes() {
+	if s.oauth != nil {
+		authGroup := s.engine.Group("/auth")
+		{
+			authGroup.GET("login", s.authLogin)
+			authGroup.GET("callback", s.authCallback)
+			authGroup.POST("logout", s.authLogout)
+		}
+	}
+	s.engine.GET("/auth/me", s.authMe)
+
 	s.engine.GET("/ping", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{_infoKey: "pong"})
 	})
@@ -144,7 +220,7 @@ func GetTUNASyncManager(config *rest.Config, options Options) (*Manager, error)
 	s.engine.GET("/jobs", s.listJob)
 	s.engine.GET("/api/mirrors", s.listJob)
 
-	if options.MirrorZ != nil {
+	if s.option.MirrorZ != nil {
 		s.engine.GET("/api/mirrorz.json", s.mirrorZ)
 	}
 
@@ -152,25 +228,33 @@ func GetTUNASyncManager(config *rest.Config, options Options) (*Manager, error)
 	mirrorValidateGroup := s.engine.Group("/job/:id")
 	{
 		// delete specified mirror
-		mirrorValidateGroup.DELETE("", s.deleteJob)
+		mirrorValidateGroup.DELETE("", s.authorize(internal.RoleAdmin), s.audit(AuditJob, "delete"), s.deleteJob)
 		// get job detail
 		mirrorValidateGroup.GET("", s.getJob)
-		mirrorValidateGroup.GET("config", s.getJobConfig)
-		mirrorValidateGroup.GET("log", s.getJobLatestLog)
+		mirrorValidateGroup.GET("config", s.authorize(internal.RoleOperator), s.getJobConfig)
+		mirrorValidateGroup.GET("log", s.authorize(internal.RoleOperator), s.getJobLatestLog)
+		mirrorValidateGroup.GET("history", s.getJobHistory)
 		// create or patch job
-		mirrorValidateGroup.POST("", s.createJob)
+		mirrorValidateGroup.POST("", s.authorize(internal.RoleAdmin), s.audit(AuditJob, "apply"), s.createJob)
 		// mirror online
-		mirrorValidateGroup.HEAD("", s.registerMirror)
+		mirrorValidateGroup.HEAD("", s.authorize(internal.RoleWorker), s.registerMirror)
 		// post job status
-		mirrorValidateGroup.PATCH("", s.updateJob)
-		mirrorValidateGroup.POST("size", s.updateMirrorSize)
-		mirrorValidateGroup.POST("schedule", s.updateSchedule)
-		mirrorValidateGroup.POST("enable", s.enableJob)
-		mirrorValidateGroup.POST("disable", s.disableJob)
-		// for tunasynctl to post commands
-		mirrorValidateGroup.POST("cmd", s.handleClientCmd)
+		mirrorValidateGroup.PATCH("", s.authorize(internal.RoleWorker), s.updateJob)
+		mirrorValidateGroup.POST("size", s.authorize(internal.RoleWorker), s.updateMirrorSize)
+		mirrorValidateGroup.POST("schedule", s.authorize(internal.RoleWorker), s.updateSchedule)
+		mirrorValidateGroup.POST("enable", s.authorize(internal.RoleOperator), s.audit(AuditJob, "enable"), s.enableJob)
+		mirrorValidateGroup.POST("disable", s.authorize(internal.RoleOperator), s.audit(AuditJob, "disable"), s.disableJob)
+		// for kubesyncctl to post commands
+		mirrorValidateGroup.POST("cmd", s.authorize(internal.RoleOperator), s.audit(AuditJob, "cmd"), s.handleClientCmd)
 	}
 
+	// export and import the specs of all objects
+	s.engine.GET("/bundle", s.authorize(internal.RoleOperator), s.exportBundle)
+	s.engine.POST("/bundle", s.authorize(internal.RoleAdmin), s.audit(AuditBundle, "import"), s.importBundle)
+
+	// create jobs from the configuration of tunasync
+	s.engine.POST("/import/tunasync", s.authorize(internal.RoleAdmin), s.audit(AuditJob, "import"), s.importTunasync)
+
 	// list announcements
 	s.engine.GET("/announcements", s.listAnnouncement)
 	s.engine.GET("/api/news", s.listAnnouncement)
@@ -179,9 +263,9 @@ func GetTUNASyncManager(config *rest.Config, options Options) (*Manager, error)
 	announcementValidateGroup := s.engine.Group("/announcement/:id")
 	{
 		// create or patch announcement
-		announcementValidateGroup.POST("", s.createAnnouncement)
+		announcementValidateGroup.POST("", s.authorize(internal.RoleOperator), s.audit(AuditAnnouncement, "apply"), s.createAnnouncement)
 		// delete specified announcement
-		announcementValidateGroup.DELETE("", s.deleteAnnouncement)
+		announcementValidateGroup.DELETE("", s.authorize(internal.RoleOperator), s.audit(AuditAnnouncement, "delete"), s.deleteAnnouncement)
 		// get announcement detail
 		announcementValidateGroup.GET("", s.getAnnouncement)
 	}
@@ -193,15 +277,23 @@ func GetTUNASyncManager(config *rest.Config, options Options) (*Manager, error)
 	// fileID should be valid in this route group
 	fileValidateGroup := s.engine.Group("/file/:id")
 	{
-		// create or patch file
-		fileValidateGroup.POST("", s.updateFile)
+		// create or patch file, workers report the file list of their own job
+		fileValidateGroup.POST("", s.authorize(internal.RoleWorker), s.audit(AuditFile, "apply"), s.updateFile)
 		// delete specified file
-		fileValidateGroup.DELETE("", s.deleteFile)
+		fileValidateGroup.DELETE("", s.authorize(internal.RoleOperator), s.audit(AuditFile, "delete"), s.deleteFile)
 		// get file detail
 		fileValidateGroup.GET("", s.getFile)
 	}
 
-	return s, nil
+	// push changes of jobs, announcements and files
+	s.engine.GET("/events", s.streamEvents)
+	s.engine.GET("/api/events", s.streamEvents)
+
+	// query the audit log
+	s.engine.GET("/audit", s.authorize(internal.RoleOperator), s.listAudit)
+
+	// describe the routes above
+	s.engine.GET("/openapi.json", s.openAPI)
 }
 
 func (m *Manager) Start(ctx context.Context) error {
@@ -272,38 +364,59 @@ func (m *Manager) GetJob(c *gin.Context, mirrorID string) (*v1beta1.Job, error)
 	return job, err
 }
 
-func handleMerge(c *gin.Context, oJobSpec, jobSpec *map[string]map[string]interface{}) (merged *v1beta1.JobSpec) {
-	if val, ok := (*jobSpec)["config"]; ok {
-		for k, v := range val {
-			(*oJobSpec)["config"][k] = v
-		}
-	}
-	if val, ok := (*jobSpec)["deploy"]; ok {
-		for k, v := range val {
-			(*oJobSpec)["deploy"][k] = v
-		}
+// mergePatchType is the content type of the requests updating a job with a json merge patch
+const mergePatchType = "application/merge-patch+json"
+
+// handleMerge merges the request body over the spec of the existing job. The fields of the sections of
+// the spec, like config or deploy, are replaced one by one, while a request sent as application/merge-patch+json
+// is applied as a json merge patch, which merges nested objects too and removes the fields set to null
+func handleMerge(c *gin.Context, oJobSpec *v1beta1.JobSpec) (*v1beta1.JobSpec, error) {
+	oJobBytes, err := json.Marshal(oJobSpec)
+	if err != nil {
+		return nil, err
 	}
-	if val, ok := (*jobSpec)["volume"]; ok {
-		for k, v := range val {
-			(*oJobSpec)["volume"][k] = v
-		}
+	patch, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
 	}
-	if val, ok := (*jobSpec)["ingress"]; ok {
-		for k, v := range val {
-			(*oJobSpec)["ingress"][k] = v
-		}
+	var nJobBytes []byte
+	if c.ContentType() == mergePatchType {
+		nJobBytes, err = jsonpatch.MergePatch(oJobBytes, patch)
+	} else {
+		nJobBytes, err = mergeSections(oJobBytes, patch)
 	}
-	nJobBytes, err := json.Marshal(*oJobSpec)
 	if err != nil {
-		c.AbortWithError(http.StatusBadRequest, err)
-		return
+		return nil, err
 	}
 	var nJobSpec v1beta1.JobSpec
 	if err = json.Unmarshal(nJobBytes, &nJobSpec); err != nil {
-		c.AbortWithError(http.StatusBadRequest, err)
-		return
+		return nil, err
 	}
-	return &nJobSpec
+	return &nJobSpec, nil
+}
+
+// mergeSections replaces the fields of each object of the patch in the same object of orig,
+// the other values of the patch replace the ones of orig as a whole
+func mergeSections(orig, patch []byte) ([]byte, error) {
+	var o, p map[string]interface{}
+	if err := json.Unmarshal(orig, &o); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, err
+	}
+	for k, v := range p {
+		section, ok := o[k].(map[string]interface{})
+		fields, isObject := v.(map[string]interface{})
+		if !ok || !isObject {
+			o[k] = v
+			continue
+		}
+		for f, fv := range fields {
+			section[f] = fv
+		}
+	}
+	return json.Marshal(o)
 }
 
 func (m *Manager) createJob(c *gin.Context) {
@@ -327,19 +440,12 @@ func (m *Manager) createJob(c *gin.Context) {
 		c.BindJSON(&jobSpec)
 		job.Spec = jobSpec
 	} else {
-		oJobBytes, err := json.Marshal(ojb.Spec)
+		jobSpec, err := handleMerge(c, &ojb.Spec)
 		if err != nil {
 			c.AbortWithError(http.StatusBadRequest, err)
 			return
 		}
-		var oJobSpec map[string]map[string]interface{}
-		if err = json.Unmarshal(oJobBytes, &oJobSpec); err != nil {
-			c.AbortWithError(http.StatusBadRequest, err)
-			return
-		}
-		jobSpec := make(map[string]map[string]interface{})
-		c.BindJSON(&jobSpec)
-		job.Spec = *handleMerge(c, &oJobSpec, &jobSpec)
+		job.Spec = *jobSpec
 	}
 	e = m.client.Patch(c.Request.Context(), &job, client.Apply, []client.PatchOption{client.ForceOwnership, client.FieldOwner("mirror-controller")}...)
 
@@ -354,41 +460,70 @@ func (m *Manager) createJob(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{_infoKey: "patch " + mirrorID + " succeed"})
 }
 
+// listMergedJobs lists the jobs with their spec merged over the JobTemplate they refer to, as the controller
+// deploys them. A job whose template is missing keeps its own spec
+func (m *Manager) listMergedJobs(ctx context.Context) (*v1beta1.JobList, error) {
+	jobs := new(v1beta1.JobList)
+	if err := m.client.List(ctx, jobs); err != nil {
+		return jobs, err
+	}
+	templates := new(v1beta1.JobTemplateList)
+	if err := m.client.List(ctx, templates); err != nil {
+		return jobs, err
+	}
+	specs := make(map[client.ObjectKey]*v1beta1.JobTemplateSpec, len(templates.Items))
+	for i := range templates.Items {
+		specs[client.ObjectKeyFromObject(&templates.Items[i])] = &templates.Items[i].Spec
+	}
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		tpl, ok := specs[client.ObjectKey{Name: job.Spec.Template, Namespace: job.Namespace}]
+		if job.Spec.Template == "" || !ok {
+			continue
+		}
+		spec, err := tpl.Merge(&job.Spec)
+		if err != nil {
+			return jobs, fmt.Errorf("failed to merge template %s into job %s: %w", job.Spec.Template, job.Name, err)
+		}
+		job.Spec = *spec
+	}
+	return jobs, nil
+}
+
+// mergedJob returns the job merged over its template as listMergedJobs does, the job is returned
+// as it is when its template is missing
+func (m *Manager) mergedJob(ctx context.Context, job *v1beta1.Job) *v1beta1.Job {
+	if job.Spec.Template == "" {
+		return job
+	}
+	tpl := new(v1beta1.JobTemplate)
+	if err := m.client.Get(ctx, client.ObjectKey{Name: job.Spec.Template, Namespace: job.Namespace}, tpl); err != nil {
+		return job
+	}
+	spec, err := tpl.Spec.Merge(&job.Spec)
+	if err != nil {
+		runLog.Error(err, fmt.Sprintf("failed to merge template %s into job %s", job.Spec.Template, job.Name))
+		return job
+	}
+	merged := job.DeepCopy()
+	merged.Spec = *spec
+	return merged
+}
+
 // listJob respond with all jobs of specified mirrors
 func (m *Manager) listJob(c *gin.Context) {
 	var ws []internal.MirrorStatus
 
 	m.rwmu.RLock()
 	defer m.rwmu.RUnlock()
-	jobs := new(v1beta1.JobList)
-	err := m.client.List(c.Request.Context(), jobs)
+	jobs, err := m.listMergedJobs(c.Request.Context())
 
 	for _, v := range jobs.Items {
 		if v.Spec.Config.Type == v1beta1.External {
 			wss, _ := external.Provider(&v.Spec.Config, m.httpClient).List()
 			ws = append(ws, wss...)
 		} else {
-			w := internal.MirrorStatus{
-				ID:        v.Name,
-				Alias:     v.Spec.Config.Alias,
-				Desc:      v.Spec.Config.Desc,
-				Url:       v.Spec.Config.Url,
-				HelpUrl:   v.Spec.Config.HelpUrl,
-				Type:      v.Spec.Config.Type,
-				SizeStr:   internal.ParseSize(v.Status.Size),
-				JobStatus: v.Status,
-			}
-			switch v.Spec.Config.Type {
-			case v1beta1.Proxy:
-				w.Upstream = v.Spec.Config.Upstream
-				w.Status = v1beta1.Cached
-			case v1beta1.Git:
-				w.Upstream = v.Spec.Config.Upstream
-				w.Status = v1beta1.Created
-			case "":
-				w.Type = v1beta1.Mirror
-			}
-			ws = append(ws, w)
+			ws = append(ws, mirrorStatus(&v))
 		}
 	}
 
@@ -407,6 +542,34 @@ func (m *Manager) listJob(c *gin.Context) {
 	c.JSON(http.StatusOK, ws)
 }
 
+// mirrorStatus converts a non external job to the status shown on the status page
+func mirrorStatus(v *v1beta1.Job) internal.MirrorStatus {
+	w := internal.MirrorStatus{
+		ID:        v.Name,
+		Alias:     v.Spec.Config.Alias,
+		Desc:      v.Spec.Config.Desc,
+		Url:       v.PublicUrl(),
+		HelpUrl:   v.Spec.Config.HelpUrl,
+		Type:      v.Spec.Config.Type,
+		SizeStr:   internal.ParseSize(v.Status.Size),
+		JobStatus: v.Status,
+	}
+	// the conditions are for the operators, not the status page
+	w.ObservedGeneration, w.Conditions = 0, nil
+	w.Quota, _ = jobQuota(v)
+	switch v.Spec.Config.Type {
+	case v1beta1.Proxy:
+		w.Upstream = v.Spec.Config.Upstream
+		w.Status = v1beta1.Cached
+		w.HitRatio = v.Status.CacheHitRatio()
+	case v1beta1.Git:
+		w.Upstream = v.Spec.Config.Upstream
+	case "":
+		w.Type = v1beta1.Mirror
+	}
+	return w
+}
+
 func (m *Manager) getJob(c *gin.Context) {
 	mirrorID := c.Param("id")
 
@@ -432,7 +595,7 @@ func (m *Manager) getJobConfig(c *gin.Context) {
 	m.rwmu.RLock()
 	defer m.rwmu.RUnlock()
 	job, err := m.GetJob(c, mirrorID)
-	config = internal.MirrorConfig{ID: mirrorID, JobSpec: job.Spec}
+	config = internal.MirrorConfig{ID: mirrorID, JobSpec: redactSpec(job.Spec)}
 
 	if err != nil {
 		err := fmt.Errorf("failed to get job %s: %s",
@@ -445,10 +608,56 @@ func (m *Manager) getJobConfig(c *gin.Context) {
 	c.JSON(http.StatusOK, config)
 }
 
+// secretEnvWords are the words in the names of the env holding credentials
+var secretEnvWords = []string{"PASSWORD", "PASSWD", "TOKEN", "SECRET", "KEY", "CREDENTIAL"}
+
+// redacted replaces the values of the env holding credentials
+const redacted = "******"
+
+// isSecretEnv tells if the env named name looks like it holds credentials
+func isSecretEnv(name string) bool {
+	name = strings.ToUpper(name)
+	for _, w := range secretEnvWords {
+		if strings.Contains(name, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactSpec hides the values of the env in a job spec that look like credentials,
+// which belong in the Secrets of config.auth
+func redactSpec(spec v1beta1.JobSpec) v1beta1.JobSpec {
+	spec = *spec.DeepCopy()
+	redact := func(envs []corev1.EnvVar) {
+		for i, e := range envs {
+			if e.Value != "" && isSecretEnv(e.Name) {
+				envs[i].Value = redacted
+			}
+		}
+	}
+	redact(spec.Config.AdditionEnvs)
+	redact(spec.Deploy.Env)
+	return spec
+}
+
 func (m *Manager) getJobLatestLog(c *gin.Context) {
 	mirrorID := c.Param("id")
+	// the worker of a job in the cronjob sync mode runs in the sync pods, with no service serving its log
+	cj, err := m.getSyncCronJob(c.Request.Context(), mirrorID)
+	if err != nil {
+		c.Error(err)
+		m.returnErrJSON(c, http.StatusInternalServerError, err)
+		return
+	}
+	if cj != nil {
+		err := fmt.Errorf("mirror %s syncs in the pods of CronJob %s, which serve no log, read them with kubectl kubesync logs %s", mirrorID, cj.Name, mirrorID)
+		m.returnErrJSON(c, http.StatusNotFound, err)
+		return
+	}
+
 	runLog.Info(fmt.Sprintf("Geting log from <%s>", mirrorID))
-	resp, err := m.httpClient.Get(fmt.Sprintf("http://%s:6000/log", mirrorID))
+	resp, err := m.httpClient.Get(workerURL(mirrorID) + "/log")
 
 	if err != nil {
 		err := fmt.Errorf("get log from mirror %s fail: %s", mirrorID, err.Error())
@@ -502,6 +711,12 @@ func (m *Manager) registerMirror(c *gin.Context) {
 
 	job.Status.LastOnline = time.Now().Unix()
 	job.Status.LastRegister = time.Now().Unix()
+	meta.SetStatusCondition(&job.Status.Conditions, metav1.Condition{
+		Type:               v1beta1.ConditionWorkerRegistered,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Registered",
+		ObservedGeneration: job.Generation,
+	})
 	err = m.client.Status().Update(c.Request.Context(), job)
 	if err != nil {
 		err := fmt.Errorf("failed to register mirror %s: %s",
@@ -535,11 +750,13 @@ func (m *Manager) updateSchedule(c *gin.Context) {
 	if err != nil {
 		runLog.Error(err, fmt.Sprintf("failed to get job %s: %s", mirrorID, err.Error()))
 		c.JSON(http.StatusOK, empty{})
+		return
 	}
 
 	if curJob.Status.Scheduled == schedule.NextSchedule {
 		// no changes, skip update
 		c.JSON(http.StatusOK, empty{})
+		return
 	}
 
 	curJob.Status.Scheduled = schedule.NextSchedule
@@ -593,6 +810,16 @@ func (m *Manager) updateJob(c *gin.Context) {
 			status.Size = curJob.Status.Size
 		}
 	}
+	if status.VolumeCapacity == 0 {
+		status.VolumeUsed, status.VolumeCapacity = curJob.Status.VolumeUsed, curJob.Status.VolumeCapacity
+	}
+	// the worker only reports its sync, the rest of the status is kept
+	status.Scheduled = curJob.Status.Scheduled
+	status.CacheHits, status.CacheMisses = curJob.Status.CacheHits, curJob.Status.CacheMisses
+	status.VolumeWarning = curJob.Status.VolumeWarning
+	status.ObservedGeneration = curJob.Status.ObservedGeneration
+	status.Conditions = curJob.Status.Conditions
+	status.SetSyncConditions(curJob.Generation)
 
 	// for logging
 	switch status.Status {
@@ -602,7 +829,9 @@ func (m *Manager) updateJob(c *gin.Context) {
 		runLog.Info(fmt.Sprintf("Job [%s] %s", mirrorID, status.Status))
 	}
 
+	oldSize := curJob.Status.Size
 	curJob.Status = status
+	m.checkQuota(curJob, oldSize)
 	err = m.client.Status().Update(c.Request.Context(), curJob)
 	if err != nil {
 		err := fmt.Errorf("failed to update job %s: %s",
@@ -617,10 +846,7 @@ func (m *Manager) updateJob(c *gin.Context) {
 
 func (m *Manager) updateMirrorSize(c *gin.Context) {
 	mirrorID := c.Param("id")
-	type SizeMsg struct {
-		Size uint64 `json:"size"`
-	}
-	var msg SizeMsg
+	var msg internal.SizeMsg
 	c.BindJSON(&msg)
 
 	m.rwmu.Lock()
@@ -633,8 +859,10 @@ func (m *Manager) updateMirrorSize(c *gin.Context) {
 		return
 	}
 
+	oldSize := job.Status.Size
 	job.Status.Size = msg.Size
 	runLog.Info(fmt.Sprintf("Mirror size of [%s]: %d", mirrorID, job.Status.Size))
+	m.checkQuota(job, oldSize)
 
 	err = m.client.Status().Update(c.Request.Context(), job)
 	if err != nil {
@@ -662,6 +890,7 @@ func (m *Manager) enableJob(c *gin.Context) {
 
 	curJob.Status.Status = v1beta1.Created
 	curJob.Status.LastOnline = time.Now().Unix()
+	curJob.Status.SetSyncConditions(curJob.Generation)
 	err = m.client.Status().Update(c.Request.Context(), curJob)
 
 	if err != nil {
@@ -690,6 +919,7 @@ func (m *Manager) disableJob(c *gin.Context) {
 
 	curJob.Status.Status = v1beta1.Disabled
 	curJob.Status.LastOnline = time.Now().Unix()
+	curJob.Status.SetSyncConditions(curJob.Generation)
 	err = m.client.Status().Update(c.Request.Context(), curJob)
 	if err != nil {
 		err := fmt.Errorf("failed to disable mirror: %s",
@@ -703,13 +933,18 @@ func (m *Manager) disableJob(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{_infoKey: "disabled"})
 }
 
+// workerURL returns the address of the worker api, the service of the job is prefixed with mirror-
+func workerURL(mirrorID string) string {
+	return fmt.Sprintf("http://mirror-%s:6000", mirrorID)
+}
+
 // PostJSON posts json object to url
 func (m *Manager) PostJSON(mirrorID string, obj interface{}) (*http.Response, error) {
 	b := new(bytes.Buffer)
 	if err := json.NewEncoder(b).Encode(obj); err != nil {
 		return nil, err
 	}
-	return m.httpClient.Post(fmt.Sprintf("http://%s:6000", mirrorID), "application/json; charset=utf-8", b)
+	return m.httpClient.Post(workerURL(mirrorID), "application/json; charset=utf-8", b)
 }
 
 func (m *Manager) handleClientCmd(c *gin.Context) {
@@ -717,6 +952,24 @@ func (m *Manager) handleClientCmd(c *gin.Context) {
 	var clientCmd internal.ClientCmd
 	c.BindJSON(&clientCmd)
 
+	// the jobs in the cronjob sync mode have no worker to post the command to
+	cj, err := m.getSyncCronJob(c.Request.Context(), mirrorID)
+	if err != nil {
+		c.Error(err)
+		m.returnErrJSON(c, http.StatusInternalServerError, err)
+		return
+	}
+	if cj != nil {
+		runLog.Info(fmt.Sprintf("Running command '%s' on the CronJob of <%s>", clientCmd.Cmd, mirrorID))
+		if code, err := m.runCronJobCmd(c.Request.Context(), cj, clientCmd); err != nil {
+			c.Error(err)
+			m.returnErrJSON(c, code, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{_infoKey: "successfully run command on mirror " + mirrorID})
+		return
+	}
+
 	switch clientCmd.Cmd {
 	case internal.CmdStop:
 		m.rwmu.Lock()
@@ -729,6 +982,7 @@ func (m *Manager) handleClientCmd(c *gin.Context) {
 
 		curJob.Status.Status = v1beta1.Paused
 		curJob.Status.LastOnline = time.Now().Unix()
+		curJob.Status.SetSyncConditions(curJob.Generation)
 		err = m.client.Status().Update(c.Request.Context(), curJob)
 		if err != nil {
 			runLog.Error(err, fmt.Sprintf("failed to update job %s: %s", mirrorID, err.Error()))
@@ -1092,8 +1346,7 @@ func (m *Manager) mirrorZ(c *gin.Context) {
 	}
 
 	var fullSize uint64 = 0
-	jobs := new(v1beta1.JobList)
-	if err := m.client.List(c.Request.Context(), jobs); err == nil {
+	if jobs, err := m.listMergedJobs(c.Request.Context()); err == nil {
 		for _, v := range jobs.Items {
 			if v.Spec.Config.Type == v1beta1.External {
 				ws, _ := external.Provider(&v.Spec.Config, m.httpClient).ListZ()
@@ -1101,10 +1354,7 @@ func (m *Manager) mirrorZ(c *gin.Context) {
 			} else {
 				fullSize += v.Status.Size
 				disabled := false
-				url := v.Spec.Config.Url
-				if url == "" {
-					url = fmt.Sprintf("/%s", v.Name)
-				}
+				url := v.PublicUrl()
 				status := "U"
 				switch v.Spec.Config.Type {
 				case v1beta1.Proxy:
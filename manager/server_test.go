@@ -0,0 +1,182 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package manager
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+)
+
+func TestRedactSpec(t *testing.T) {
+	var spec v1beta1.JobSpec
+	spec.Config.AdditionEnvs = []corev1.EnvVar{{Name: "RSYNC_PASSWORD", Value: "hunter2"}, {Name: "RSYNC_TIMEOUT", Value: "60"}}
+	spec.Deploy.Env = []corev1.EnvVar{
+		{Name: "github_token", Value: "ghp_x"},
+		{Name: "AWS_SECRET_ACCESS_KEY", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{Key: "key"}}},
+	}
+
+	redacted := redactSpec(spec)
+	if redacted.Config.AdditionEnvs[0].Value != "******" || redacted.Config.AdditionEnvs[1].Value != "60" ||
+		redacted.Deploy.Env[0].Value != "******" || redacted.Deploy.Env[1].ValueFrom == nil || redacted.Deploy.Env[1].Value != "" {
+		t.Errorf("unexpected redacted spec %+v", redacted)
+	}
+	if spec.Config.AdditionEnvs[0].Value != "hunter2" {
+		t.Error("redactSpec changed the spec of the job")
+	}
+}
+
+func TestUpdateJobKeepsStatus(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	job := &v1beta1.Job{ObjectMeta: metav1.ObjectMeta{Name: "debian", Generation: 3}}
+	job.Status = v1beta1.JobStatus{
+		Status:             v1beta1.Success,
+		Scheduled:          1700000000,
+		Size:               1024,
+		ObservedGeneration: 3,
+		Conditions:         []metav1.Condition{{Type: v1beta1.ConditionDeploymentReady, Status: metav1.ConditionTrue, Reason: "PodsReady"}},
+	}
+	m := &Manager{client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(job).WithStatusSubresource(job).Build()}
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.POST("/job/:id", m.updateJob)
+
+	w := httptest.NewRecorder()
+	body := `{"status":"failed","errorMsg":"rsync exited with 23","upstream":"rsync://a/debian/"}`
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/job/debian", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected code %d: %s", w.Code, w.Body.String())
+	}
+
+	if err := m.client.Get(context.Background(), client.ObjectKey{Name: "debian"}, job); err != nil {
+		t.Fatal(err)
+	}
+	if job.Status.Scheduled != 1700000000 || job.Status.Size != 1024 || job.Status.ObservedGeneration != 3 {
+		t.Errorf("the status set by others was lost: %+v", job.Status)
+	}
+	if !meta.IsStatusConditionTrue(job.Status.Conditions, v1beta1.ConditionDeploymentReady) {
+		t.Error("the conditions of the controller were lost")
+	}
+	degraded := meta.FindStatusCondition(job.Status.Conditions, v1beta1.ConditionDegraded)
+	if degraded == nil || degraded.Status != metav1.ConditionTrue || degraded.Reason != "SyncFailed" || degraded.Message != "rsync exited with 23" {
+		t.Errorf("unexpected degraded condition %+v", degraded)
+	}
+	if meta.IsStatusConditionTrue(job.Status.Conditions, v1beta1.ConditionSyncing) {
+		t.Error("a failed job is not syncing")
+	}
+}
+
+func TestListJobTemplate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	tpl := &v1beta1.JobTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "pypi"},
+		Spec: v1beta1.JobTemplateSpec{Config: v1beta1.JobConfig{
+			Type: v1beta1.Proxy, Desc: "Python packages", HelpUrl: "/help/pypi", Upstream: "https://pypi.org",
+		}},
+	}
+	job := &v1beta1.Job{ObjectMeta: metav1.ObjectMeta{Name: "pypi"}, Spec: v1beta1.JobSpec{Template: "pypi"}}
+	orphan := &v1beta1.Job{ObjectMeta: metav1.ObjectMeta{Name: "debian"}, Spec: v1beta1.JobSpec{Template: "missing"}}
+	m := &Manager{client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(tpl, job, orphan).Build()}
+
+	jobs, err := m.listMergedJobs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs.Items) != 2 {
+		t.Fatalf("unexpected jobs %v", jobs.Items)
+	}
+	for _, v := range jobs.Items {
+		w := mirrorStatus(&v)
+		switch v.Name {
+		case "pypi":
+			if w.Type != v1beta1.Proxy || w.Desc != "Python packages" || w.HelpUrl != "/help/pypi" || w.Upstream != "https://pypi.org" {
+				t.Errorf("the template is not applied to %+v", w)
+			}
+		case "debian":
+			if w.Type != v1beta1.Mirror {
+				t.Errorf("unexpected status %+v", w)
+			}
+		}
+	}
+
+	// the events of a job carry the same view as the list
+	if w := mirrorStatus(m.mergedJob(context.Background(), job)); w.Type != v1beta1.Proxy || w.Upstream != "https://pypi.org" {
+		t.Errorf("the template is not applied to the event of %+v", w)
+	}
+	if got := m.mergedJob(context.Background(), orphan); got != orphan {
+		t.Errorf("a job without its template should be kept, got %+v", got)
+	}
+}
+
+func TestHandleMerge(t *testing.T) {
+	orig := v1beta1.JobSpec{Config: v1beta1.JobConfig{
+		Upstream: "rsync://a/debian/",
+		Desc:     "Debian",
+		Auth: v1beta1.UpstreamAuth{
+			BasicAuth:   &corev1.LocalObjectReference{Name: "debian"},
+			BearerToken: &corev1.SecretKeySelector{Key: "token"},
+		},
+	}}
+	body := `{"template":"debian","config":{"desc":"Debian GNU/Linux","auth":{"bearerToken":null}}}`
+	merge := func(contentType string) *v1beta1.JobSpec {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/job/debian", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", contentType)
+		spec, err := handleMerge(c, orig.DeepCopy())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return spec
+	}
+
+	// the fields of each section are replaced one by one, as they always were
+	spec := merge("application/json")
+	if spec.Template != "debian" || spec.Config.Upstream != orig.Config.Upstream || spec.Config.Desc != "Debian GNU/Linux" {
+		t.Errorf("unexpected merge %+v", spec)
+	}
+	if spec.Config.Auth.BasicAuth != nil || spec.Config.Auth.BearerToken != nil {
+		t.Errorf("the auth should be replaced as a whole, got %+v", spec.Config.Auth)
+	}
+
+	// a merge patch merges the nested objects and removes the null fields
+	spec = merge(mergePatchType)
+	if spec.Template != "debian" || spec.Config.Upstream != orig.Config.Upstream || spec.Config.Desc != "Debian GNU/Linux" {
+		t.Errorf("unexpected merge patch %+v", spec)
+	}
+	if spec.Config.Auth.BasicAuth == nil || spec.Config.Auth.BearerToken != nil {
+		t.Errorf("unexpected auth %+v", spec.Config.Auth)
+	}
+}
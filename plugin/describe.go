@@ -0,0 +1,174 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/urfave/cli"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+	"github.com/CQUPTMirror/kubesync/internal"
+)
+
+// maxEvents is the number of recent events shown by describe
+const maxEvents = 20
+
+func describe(c *cli.Context) error {
+	name, err := jobArg(c)
+	if err != nil {
+		return err
+	}
+	k, err := newKube(c)
+	if err != nil {
+		return err
+	}
+	return k.describe(context.Background(), c.App.Writer, name)
+}
+
+// describe prints a job with its deployment, volume and recent events
+func (k *kube) describe(ctx context.Context, w io.Writer, name string) error {
+	key := client.ObjectKey{Namespace: k.namespace, Name: name}
+
+	job := new(v1beta1.Job)
+	if err := k.client.Get(ctx, key, job); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Name:\t\t%s\n", job.Name)
+	fmt.Fprintf(w, "Namespace:\t%s\n", job.Namespace)
+	fmt.Fprintf(w, "Type:\t\t%s\n", orDash(string(job.Spec.Config.Type)))
+	fmt.Fprintf(w, "Provider:\t%s\n", orDash(job.Spec.Config.Provider))
+	fmt.Fprintf(w, "Upstream:\t%s\n", orDash(job.Spec.Config.Upstream))
+	fmt.Fprintf(w, "Status:\t\t%s\n", orDash(string(job.Status.Status)))
+	fmt.Fprintf(w, "Last Update:\t%s\n", formatTime(job.Status.LastUpdate))
+	fmt.Fprintf(w, "Last Started:\t%s\n", formatTime(job.Status.LastStarted))
+	fmt.Fprintf(w, "Last Ended:\t%s\n", formatTime(job.Status.LastEnded))
+	fmt.Fprintf(w, "Next Schedule:\t%s\n", formatTime(job.Status.Scheduled))
+	fmt.Fprintf(w, "Last Online:\t%s\n", formatTime(job.Status.LastOnline))
+	fmt.Fprintf(w, "Size:\t\t%s\n", orDash(internal.ParseSize(job.Status.Size)))
+	if job.Spec.Config.Type == v1beta1.Proxy {
+		fmt.Fprintf(w, "Cache Hits:\t%.1f%% (%d hits, %d misses)\n", job.Status.CacheHitRatio()*100, job.Status.CacheHits, job.Status.CacheMisses)
+	}
+	if job.Status.ErrorMsg != "" {
+		fmt.Fprintf(w, "Error:\t\t%s\n", job.Status.ErrorMsg)
+	}
+
+	names := map[string]bool{job.Name: true}
+
+	deploy := new(appsv1.Deployment)
+	fmt.Fprintln(w, "Deployment:")
+	if ok, err := ignoreNotFound(k.client.Get(ctx, key, deploy)); err != nil {
+		return err
+	} else if !ok {
+		fmt.Fprintln(w, "  <none>")
+	} else {
+		fmt.Fprintf(w, "  Ready:\t%s (%d updated, %d available)\n", deployReady(deploy),
+			deploy.Status.UpdatedReplicas, deploy.Status.AvailableReplicas)
+		pods := new(corev1.PodList)
+		if err := k.client.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels(deploy.Spec.Selector.MatchLabels)); err != nil {
+			return err
+		}
+		for _, p := range pods.Items {
+			names[p.Name] = true
+			fmt.Fprintf(w, "  Pod:\t\t%s %s, %d restarts, %s old\n", p.Name, p.Status.Phase, restarts(&p),
+				duration.HumanDuration(time.Since(p.CreationTimestamp.Time)))
+		}
+	}
+
+	pvc := new(corev1.PersistentVolumeClaim)
+	fmt.Fprintln(w, "Volume:")
+	if ok, err := ignoreNotFound(k.client.Get(ctx, key, pvc)); err != nil {
+		return err
+	} else if !ok {
+		fmt.Fprintln(w, "  <none>")
+	} else {
+		fmt.Fprintf(w, "  Phase:\t%s\n", pvc.Status.Phase)
+		if pvc.Spec.StorageClassName != nil {
+			fmt.Fprintf(w, "  StorageClass:\t%s\n", *pvc.Spec.StorageClassName)
+		}
+		capacity := pvc.Status.Capacity.Storage()
+		if capacity.IsZero() {
+			capacity = pvc.Spec.Resources.Requests.Storage()
+		}
+		fmt.Fprintf(w, "  Capacity:\t%s\n", capacity.String())
+		// the size reported by the worker is the best usage we know of without exec into the pod
+		if c := capacity.Value(); c > 0 && job.Status.Size > 0 {
+			fmt.Fprintf(w, "  Used:\t\t%s (%.1f%%)\n", internal.ParseSize(job.Status.Size), float64(job.Status.Size)/float64(c)*100)
+		}
+	}
+
+	return k.printEvents(ctx, w, job.Namespace, names)
+}
+
+func restarts(p *corev1.Pod) (n int32) {
+	for _, s := range p.Status.ContainerStatuses {
+		n += s.RestartCount
+	}
+	return
+}
+
+// printEvents prints the recent events of the objects with the given names, newest last
+func (k *kube) printEvents(ctx context.Context, w io.Writer, namespace string, names map[string]bool) error {
+	events := new(corev1.EventList)
+	if err := k.client.List(ctx, events, client.InNamespace(namespace)); err != nil {
+		return err
+	}
+	var recent []corev1.Event
+	for _, e := range events.Items {
+		if names[e.InvolvedObject.Name] {
+			recent = append(recent, e)
+		}
+	}
+	sort.Slice(recent, func(i, j int) bool {
+		return eventTime(&recent[i]).Before(eventTime(&recent[j]))
+	})
+	if len(recent) > maxEvents {
+		recent = recent[len(recent)-maxEvents:]
+	}
+
+	fmt.Fprintln(w, "Events:")
+	if len(recent) == 0 {
+		fmt.Fprintln(w, "  <none>")
+		return nil
+	}
+	tw := newTable(w, "  LAST SEEN", "TYPE", "REASON", "OBJECT", "MESSAGE")
+	for _, e := range recent {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s/%s\t%s\n", duration.HumanDuration(time.Since(eventTime(&e))), e.Type, e.Reason,
+			e.InvolvedObject.Kind, e.InvolvedObject.Name, e.Message)
+	}
+	return tw.Flush()
+}
+
+func eventTime(e *corev1.Event) time.Time {
+	switch {
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	default:
+		return e.CreationTimestamp.Time
+	}
+}
@@ -0,0 +1,339 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package plugin implements kubectl-kubesync, a kubectl plugin working on the kubesync resources directly
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/duration"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+	"github.com/CQUPTMirror/kubesync/internal"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(v1beta1.AddToScheme(scheme))
+}
+
+// NewApp returns the kubectl-kubesync application
+func NewApp() *cli.App {
+	app := cli.NewApp()
+	app.Name = "kubectl-kubesync"
+	app.Usage = "inspect and control kubesync jobs through the kubernetes api"
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "kubeconfig",
+			Usage:  "Path to the kubeconfig file",
+			EnvVar: "KUBECONFIG",
+		},
+		cli.StringFlag{
+			Name:  "context",
+			Usage: "The kubeconfig context to use",
+		},
+		cli.StringFlag{
+			Name:  "namespace, n",
+			Usage: "The namespace of the jobs, defaults to the namespace of the context",
+		},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name:  "status",
+			Usage: "Show the status and deployment readiness of jobs",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "all-namespaces, A",
+					Usage: "List jobs in all namespaces",
+				},
+			},
+			Action: status,
+		},
+		{
+			Name:      "logs",
+			Usage:     "Print the logs of the worker container of a job",
+			ArgsUsage: "<job>",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "follow, f",
+					Usage: "Stream the logs",
+				},
+				cli.Int64Flag{
+					Name:  "tail",
+					Value: -1,
+					Usage: "Lines of recent log to show, -1 shows all",
+				},
+				cli.StringFlag{
+					Name:  "container, c",
+					Usage: "Print the logs of another container of the job, e.g. front or rsync",
+				},
+			},
+			Action: logs,
+		},
+		{
+			Name:      "describe",
+			Usage:     "Show a job with its deployment, volume and recent events",
+			ArgsUsage: "<job>",
+			Action:    describe,
+		},
+		{
+			Name:      "trigger",
+			Usage:     "Send a command to a job through the manager",
+			ArgsUsage: "<job> [start|stop|restart]",
+			Description: "Forwards a local port to the manager of the namespace and posts the command to it,\n" +
+				"   stop pauses the job until it is started again. The token of an operator Secret in\n" +
+				"   the namespace is used unless --token is given.",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "force",
+					Usage: "Ignore the concurrent limit of the worker when starting",
+				},
+				cli.StringFlag{
+					Name:   "token",
+					Usage:  "The bearer token sent to the manager",
+					EnvVar: "KUBESYNC_TOKEN",
+				},
+			},
+			Action: trigger,
+		},
+	}
+	return app
+}
+
+// kube holds the clients of one invocation
+type kube struct {
+	config    *rest.Config
+	client    client.Client
+	clientset kubernetes.Interface
+	namespace string
+}
+
+func newKube(c *cli.Context) (*kube, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = c.GlobalString("kubeconfig")
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: c.GlobalString("context")}
+	overrides.Context.Namespace = c.GlobalString("namespace")
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+
+	config, err := loader.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	namespace, _, err := loader.Namespace()
+	if err != nil {
+		return nil, err
+	}
+	cl, err := client.New(config, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, err
+	}
+	cs, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &kube{config: config, client: cl, clientset: cs, namespace: namespace}, nil
+}
+
+func jobArg(c *cli.Context) (string, error) {
+	if c.NArg() < 1 {
+		return "", cli.NewExitError(fmt.Sprintf("usage: %s %s %s", c.App.Name, c.Command.Name, c.Command.ArgsUsage), 1)
+	}
+	return c.Args().First(), nil
+}
+
+func status(c *cli.Context) error {
+	k, err := newKube(c)
+	if err != nil {
+		return err
+	}
+	return k.status(context.Background(), c.App.Writer, c.Bool("all-namespaces"))
+}
+
+// status prints a table of the jobs and the readiness of their deployments
+func (k *kube) status(ctx context.Context, w io.Writer, allNamespaces bool) error {
+	var opts []client.ListOption
+	if !allNamespaces {
+		opts = append(opts, client.InNamespace(k.namespace))
+	}
+
+	jobs := new(v1beta1.JobList)
+	if err := k.client.List(ctx, jobs, opts...); err != nil {
+		return err
+	}
+	deploys := new(appsv1.DeploymentList)
+	if err := k.client.List(ctx, deploys, append(opts, client.MatchingLabels{"app.kubernetes.io/managed-by": "kubesync"})...); err != nil {
+		return err
+	}
+	ready := make(map[string]string)
+	for _, d := range deploys.Items {
+		ready[d.Namespace+"/"+d.Name] = deployReady(&d)
+	}
+
+	sort.Slice(jobs.Items, func(i, j int) bool {
+		a, b := jobs.Items[i], jobs.Items[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	tw := newTable(w, "NAMESPACE", "NAME", "STATUS", "READY", "LAST UPDATE", "NEXT SCHEDULE", "SIZE", "AGE")
+	for _, j := range jobs.Items {
+		r, ok := ready[j.Namespace+"/"+j.Name]
+		if !ok {
+			r = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", j.Namespace, j.Name, orDash(string(j.Status.Status)), r,
+			formatTime(j.Status.LastUpdate), formatTime(j.Status.Scheduled), orDash(internal.ParseSize(j.Status.Size)),
+			duration.HumanDuration(time.Since(j.CreationTimestamp.Time)))
+	}
+	return tw.Flush()
+}
+
+// workerPod returns the newest running pod of a job, or the newest one if none is running. In the cronjob
+// sync mode the worker runs in the pods of the sync Jobs, while the pods of the deployment only serve
+func (k *kube) workerPod(ctx context.Context, job *v1beta1.Job, worker bool) (*corev1.Pod, error) {
+	labels := client.MatchingLabels{"app.kubernetes.io/app": job.Name, "app.kubernetes.io/component": "mirror"}
+	if worker {
+		cj := new(batchv1.CronJob)
+		err := k.client.Get(ctx, client.ObjectKey{Namespace: job.Namespace, Name: job.Name}, cj)
+		if client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+		if err == nil && cj.Labels[internal.SyncJobLabel] == job.Name {
+			labels = client.MatchingLabels{internal.SyncJobLabel: job.Name}
+		}
+	}
+	pods := new(corev1.PodList)
+	if err := k.client.List(ctx, pods, client.InNamespace(job.Namespace), labels); err != nil {
+		return nil, err
+	}
+	if len(pods.Items) == 0 {
+		if _, ok := labels[internal.SyncJobLabel]; ok {
+			return nil, fmt.Errorf("no sync pod found for job %s, it syncs in a CronJob which has not run yet", job.Name)
+		}
+		return nil, fmt.Errorf("no pod found for job %s", job.Name)
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		a, b := pods.Items[i], pods.Items[j]
+		if (a.Status.Phase == corev1.PodRunning) != (b.Status.Phase == corev1.PodRunning) {
+			return a.Status.Phase == corev1.PodRunning
+		}
+		return a.CreationTimestamp.After(b.CreationTimestamp.Time)
+	})
+	return &pods.Items[0], nil
+}
+
+func logs(c *cli.Context) error {
+	name, err := jobArg(c)
+	if err != nil {
+		return err
+	}
+	k, err := newKube(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	job := new(v1beta1.Job)
+	if err := k.client.Get(ctx, client.ObjectKey{Namespace: k.namespace, Name: name}, job); err != nil {
+		return err
+	}
+	// the worker container is named after the job, the others are suffixed with their role
+	container := job.Name
+	if s := c.String("container"); s != "" {
+		container = job.Name + "-" + s
+	}
+	pod, err := k.workerPod(ctx, job, container == job.Name)
+	if err != nil {
+		return err
+	}
+	opts := &corev1.PodLogOptions{Container: container, Follow: c.Bool("follow")}
+	if tail := c.Int64("tail"); tail >= 0 {
+		opts.TailLines = &tail
+	}
+	stream, err := k.clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, opts).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	if _, err := io.Copy(c.App.Writer, stream); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+func deployReady(d *appsv1.Deployment) string {
+	desired := int32(1)
+	if d.Spec.Replicas != nil {
+		desired = *d.Spec.Replicas
+	}
+	return fmt.Sprintf("%d/%d", d.Status.ReadyReplicas, desired)
+}
+
+// ignoreNotFound returns nil for a missing object, so describe can show what exists
+func ignoreNotFound(err error) (bool, error) {
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func newTable(w io.Writer, headers ...string) *tabwriter.Writer {
+	tw := tabwriter.NewWriter(w, 0, 4, 3, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	return tw
+}
+
+// formatTime formats a unix timestamp in local time, zero means never
+func formatTime(ts int64) string {
+	if ts <= 0 {
+		return "-"
+	}
+	return time.Unix(ts, 0).Format("2006-01-02 15:04:05")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,138 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+	"github.com/CQUPTMirror/kubesync/internal"
+)
+
+func newTestKube() *kube {
+	labels := map[string]string{"app.kubernetes.io/app": "centos", "app.kubernetes.io/component": "mirror", "app.kubernetes.io/managed-by": "kubesync"}
+	replicas := int32(1)
+	objs := []runtime.Object{
+		&v1beta1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "centos", Namespace: "mirror"},
+			Spec:       v1beta1.JobSpec{Config: v1beta1.JobConfig{Upstream: "rsync://mirrors.example.com/centos/"}},
+			Status:     v1beta1.JobStatus{Status: v1beta1.Success, Size: 512 * internal.G},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "centos", Namespace: "mirror", Labels: labels},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas, Selector: &metav1.LabelSelector{MatchLabels: labels}},
+			Status:     appsv1.DeploymentStatus{ReadyReplicas: 1},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "centos-abc", Namespace: "mirror", Labels: labels},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		},
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "centos", Namespace: "mirror"},
+			Status: corev1.PersistentVolumeClaimStatus{
+				Phase:    corev1.ClaimBound,
+				Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Ti")},
+			},
+		},
+		&corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: "centos.1", Namespace: "mirror"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "centos-abc"},
+			Type:           corev1.EventTypeWarning,
+			Reason:         "BackOff",
+			Message:        "Back-off restarting failed container",
+		},
+		&corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: "other.1", Namespace: "mirror"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "other"},
+			Reason:         "Unrelated",
+		},
+	}
+	return &kube{
+		client:    fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(objs...).Build(),
+		namespace: "mirror",
+	}
+}
+
+func TestStatus(t *testing.T) {
+	var out bytes.Buffer
+	if err := newTestKube().status(context.Background(), &out, false); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("unexpected table %q", out.String())
+	}
+	for _, s := range []string{"centos", "success", "1/1", "512.00G"} {
+		if !strings.Contains(lines[1], s) {
+			t.Errorf("row %q does not contain %s", lines[1], s)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	var out bytes.Buffer
+	if err := newTestKube().describe(context.Background(), &out, "centos"); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"rsync://mirrors.example.com/centos/", "centos-abc Running", "(50.0%)", "BackOff"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("describe does not contain %s:\n%s", s, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "Unrelated") {
+		t.Errorf("describe contains events of other objects:\n%s", out.String())
+	}
+}
+
+func TestWorkerPod(t *testing.T) {
+	ctx := context.Background()
+	k := newTestKube()
+	job := &v1beta1.Job{ObjectMeta: metav1.ObjectMeta{Name: "centos", Namespace: "mirror"}}
+	if pod, err := k.workerPod(ctx, job, true); err != nil || pod.Name != "centos-abc" {
+		t.Fatalf("expected the pod of the deployment, got %v %v", pod, err)
+	}
+
+	// in the cronjob sync mode the worker runs in the pods of the sync Jobs
+	sync := map[string]string{internal.SyncJobLabel: "centos"}
+	if err := k.client.Create(ctx, &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "centos", Namespace: "mirror", Labels: sync}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.workerPod(ctx, job, true); err == nil || !strings.Contains(err.Error(), "CronJob") {
+		t.Errorf("expected no sync pod, got %v", err)
+	}
+	if err := k.client.Create(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "centos-28000000-xyz", Namespace: "mirror", Labels: sync}}); err != nil {
+		t.Fatal(err)
+	}
+	if pod, err := k.workerPod(ctx, job, true); err != nil || pod.Name != "centos-28000000-xyz" {
+		t.Errorf("expected the sync pod, got %v %v", pod, err)
+	}
+	if pod, err := k.workerPod(ctx, job, false); err != nil || pod.Name != "centos-abc" {
+		t.Errorf("expected the pod of the deployment for the front, got %v %v", pod, err)
+	}
+}
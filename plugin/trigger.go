@@ -0,0 +1,176 @@
+/*
+Copyright (C) 2023  CQUPTMirror
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/urfave/cli"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+	"github.com/CQUPTMirror/kubesync/internal"
+	managerclient "github.com/CQUPTMirror/kubesync/manager/client"
+)
+
+// managerPort is the api port of the manager container
+const managerPort = 3000
+
+var triggerVerbs = map[string]internal.CmdVerb{
+	"start":   internal.CmdStart,
+	"stop":    internal.CmdStop,
+	"restart": internal.CmdRestart,
+}
+
+func trigger(c *cli.Context) error {
+	name, err := jobArg(c)
+	if err != nil {
+		return err
+	}
+	action := "start"
+	if c.NArg() > 1 {
+		action = c.Args().Get(1)
+	}
+	verb, ok := triggerVerbs[action]
+	if !ok {
+		return cli.NewExitError(fmt.Sprintf("unknown command %s, should be one of start, stop, restart", action), 1)
+	}
+	k, err := newKube(c)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	token := c.String("token")
+	if token == "" {
+		if token, err = k.operatorToken(ctx); err != nil {
+			return err
+		}
+	}
+	pod, err := k.managerPod(ctx)
+	if err != nil {
+		return err
+	}
+	// the apiserver drops the authorization header when proxying to a service,
+	// so the token only reaches the manager through a port forward
+	port, stop, err := k.forward(pod, managerPort)
+	if err != nil {
+		return err
+	}
+	defer close(stop)
+
+	mc := managerclient.New("http://127.0.0.1:"+strconv.Itoa(int(port)), managerclient.WithToken(token))
+	if err := mc.SendCmd(ctx, name, internal.ClientCmd{Cmd: verb, Force: c.Bool("force")}); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "sent %s to %s through manager %s\n", verb, name, pod.Labels["manager"])
+	return nil
+}
+
+// operatorToken returns the token of an operator, or else admin, token Secret in the namespace
+func (k *kube) operatorToken(ctx context.Context) (string, error) {
+	secrets := new(corev1.SecretList)
+	if err := k.client.List(ctx, secrets, client.InNamespace(k.namespace), client.HasLabels{internal.TokenLabel}); err != nil {
+		return "", err
+	}
+	var token string
+	for _, s := range secrets.Items {
+		switch internal.NewRoleFromString(s.Labels[internal.TokenLabel]) {
+		case internal.RoleOperator:
+			if t := s.Data[internal.TokenKey]; len(t) > 0 {
+				return string(t), nil
+			}
+		case internal.RoleAdmin:
+			if t := s.Data[internal.TokenKey]; len(t) > 0 && token == "" {
+				token = string(t)
+			}
+		}
+	}
+	if token == "" {
+		return "", fmt.Errorf("no operator token Secret in namespace %s, pass one with --token", k.namespace)
+	}
+	return token, nil
+}
+
+// managerPod returns a running pod of the active manager in the namespace
+func (k *kube) managerPod(ctx context.Context) (*corev1.Pod, error) {
+	managers := new(v1beta1.ManagerList)
+	if err := k.client.List(ctx, managers, client.InNamespace(k.namespace)); err != nil {
+		return nil, err
+	}
+	for _, m := range managers.Items {
+		if m.Status.Phase != v1beta1.DeploySucceeded {
+			continue
+		}
+		pods := new(corev1.PodList)
+		if err := k.client.List(ctx, pods, client.InNamespace(k.namespace), client.MatchingLabels{"manager": m.Name}); err != nil {
+			return nil, err
+		}
+		for i, p := range pods.Items {
+			if p.Status.Phase == corev1.PodRunning && p.DeletionTimestamp == nil {
+				return &pods.Items[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no running manager in namespace %s", k.namespace)
+}
+
+// forward forwards a random local port to the given port of the pod until stop is closed
+func (k *kube) forward(pod *corev1.Pod, port int) (uint16, chan struct{}, error) {
+	transport, upgrader, err := spdy.RoundTripperFor(k.config)
+	if err != nil {
+		return 0, nil, err
+	}
+	url := k.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").Namespace(pod.Namespace).Name(pod.Name).SubResource("portforward").URL()
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, url)
+
+	stop, ready := make(chan struct{}), make(chan struct{})
+	errOut := new(bytes.Buffer)
+	fw, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, []string{"0:" + strconv.Itoa(port)}, stop, ready, io.Discard, errOut)
+	if err != nil {
+		return 0, nil, err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- fw.ForwardPorts()
+	}()
+	select {
+	case <-ready:
+	case err := <-done:
+		if err == nil {
+			err = errors.New(errOut.String())
+		}
+		return 0, nil, fmt.Errorf("failed to forward to %s: %s", pod.Name, err.Error())
+	}
+	ports, err := fw.GetPorts()
+	if err != nil {
+		close(stop)
+		return 0, nil, err
+	}
+	return ports[0].Local, stop, nil
+}
@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/CQUPTMirror/kubesync/internal"
+)
+
+// upstreamAuth reads the credentials of the upstream the controller mounts below dir. They are read
+// when a sync starts, so rotated Secrets are picked up, and only go to the sync commands, never to the log
+type upstreamAuth struct {
+	dir string
+}
+
+// file returns the path of a credential file, or "" if it is not mounted
+func (a upstreamAuth) file(name string) string {
+	if a.dir == "" {
+		return ""
+	}
+	p := filepath.Join(a.dir, name)
+	if _, err := os.Stat(p); err != nil {
+		return ""
+	}
+	return p
+}
+
+func (a upstreamAuth) read(name string) string {
+	p := a.file(name)
+	if p == "" {
+		return ""
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		logger.Errorf("Failed to read credential %s: %s", name, err.Error())
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// rsyncOptions returns the options giving rsync the password of the rsync daemon
+func (a upstreamAuth) rsyncOptions() []string {
+	if p := a.file(internal.AuthRsyncPasswordFile); p != "" {
+		return []string{"--password-file=" + p}
+	}
+	return nil
+}
+
+// sshCommand returns the ssh command using the ssh key, checking the host keys against known_hosts if it is set
+func (a upstreamAuth) sshCommand() string {
+	key := a.file(filepath.Join(internal.AuthSSHDir, corev1.SSHAuthPrivateKey))
+	if key == "" {
+		return ""
+	}
+	cmd := "ssh -i " + key + " -o IdentitiesOnly=yes"
+	if hosts := a.file(filepath.Join(internal.AuthSSHDir, "known_hosts")); hosts != "" {
+		return cmd + " -o UserKnownHostsFile=" + hosts + " -o StrictHostKeyChecking=yes"
+	}
+	return cmd + " -o StrictHostKeyChecking=accept-new"
+}
+
+// env returns the env of the sync commands holding the credentials
+func (a upstreamAuth) env() map[string]string {
+	env := make(map[string]string)
+	if ssh := a.sshCommand(); ssh != "" {
+		env["GIT_SSH_COMMAND"] = ssh
+		env["RSYNC_RSH"] = ssh
+	}
+	if user := a.read(filepath.Join(internal.AuthBasicDir, corev1.BasicAuthUsernameKey)); user != "" {
+		env["UPSTREAM_USER"] = user
+		env["UPSTREAM_PASSWORD"] = a.read(filepath.Join(internal.AuthBasicDir, corev1.BasicAuthPasswordKey))
+	}
+	if token := a.read(internal.AuthBearerTokenFile); token != "" {
+		env["UPSTREAM_TOKEN"] = token
+	}
+	if id := a.read(filepath.Join(internal.AuthS3Dir, "access-key-id")); id != "" {
+		env["AWS_ACCESS_KEY_ID"] = id
+		env["AWS_SECRET_ACCESS_KEY"] = a.read(filepath.Join(internal.AuthS3Dir, "secret-access-key"))
+	}
+	return env
+}
+
+// setHeader authorizes a request to the upstream with the bearer token, or else the basic auth
+func (a upstreamAuth) setHeader(req *http.Request) {
+	if token := a.read(internal.AuthBearerTokenFile); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return
+	}
+	if user := a.read(filepath.Join(internal.AuthBasicDir, corev1.BasicAuthUsernameKey)); user != "" {
+		req.SetBasicAuth(user, a.read(filepath.Join(internal.AuthBasicDir, corev1.BasicAuthPasswordKey)))
+	}
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"github.com/gin-gonic/gin"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
@@ -29,6 +31,16 @@ func startWorker(c *cli.Context) error {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
+	if cfg.Provider == worker.ProxyProvider {
+		p, err := worker.NewProxy(cfg)
+		if err != nil {
+			logger.Errorf("Error intializing proxy: %s", err.Error())
+			os.Exit(1)
+		}
+		logger.Info("Run proxy.")
+		return p.Run()
+	}
+
 	w := worker.NewTUNASyncWorker(cfg)
 	if w == nil {
 		logger.Errorf("Error intializing TUNA sync worker.")
@@ -62,11 +74,34 @@ func startWorker(c *cli.Context) error {
 		}
 	}()
 
+	if cfg.OneShot {
+		logger.Info("Run tunasync worker once.")
+		if !w.RunOnce() {
+			os.Exit(1)
+		}
+		return nil
+	}
+
 	logger.Info("Run tunasync worker.")
 	w.Run()
 	return nil
 }
 
+// serveGitHTTP serves the repositories of a git job, it runs as the front of the job
+func serveGitHTTP(c *cli.Context) error {
+	worker.InitLogger(c.GlobalBool("verbose"), c.GlobalBool("debug"))
+	name := worker.GetStringEnv("JOB_NAME", "")
+	root := worker.GetStringEnv("GIT_ROOT", filepath.Join("/data", name))
+	g, err := worker.NewGitHTTP(name, root, worker.GetListEnv("GIT_PATHS"), worker.GetBoolEnv("GIT_DAEMON"))
+	if err != nil {
+		logger.Errorf("Error intializing git http: %s", err.Error())
+		os.Exit(1)
+	}
+	addr := worker.GetStringEnv("GIT_HTTP_ADDR", ":80")
+	logger.Noticef("Serve git repositories in %s on %s", root, addr)
+	return http.ListenAndServe(addr, g)
+}
+
 func main() {
 
 	if reexec.Init() {
@@ -92,5 +127,12 @@ func main() {
 		},
 	}
 	app.Action = startWorker
+	app.Commands = []cli.Command{
+		{
+			Name:   "git-http",
+			Usage:  "Serve the git repositories of a job over smart HTTP",
+			Action: serveGitHTTP,
+		},
+	}
 	app.Run(os.Args)
 }
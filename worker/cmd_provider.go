@@ -18,6 +18,7 @@ type cmdConfig struct {
 	timeout                     time.Duration
 	failOnMatch                 string
 	sizePattern                 string
+	auth                        upstreamAuth
 }
 
 type cmdProvider struct {
@@ -126,6 +127,9 @@ func (p *cmdProvider) Start() error {
 		"TUNASYNC_LOG_DIR":      p.LogDir(),
 		"TUNASYNC_LOG_FILE":     p.LogFile(),
 	}
+	for k, v := range p.auth.env() {
+		env[k] = v
+	}
 	p.cmd = newCmdJob(p, p.command, p.WorkingDir(), env)
 	if err := p.prepareLogFile(false); err != nil {
 		return err
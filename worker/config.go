@@ -17,6 +17,8 @@ type Config struct {
 	Interval   int    `toml:"interval"`
 	Retry      int    `toml:"retry"`
 	Timeout    int    `toml:"timeout"`
+	// OneShot syncs once and exits, the worker runs in a Job of a CronJob
+	OneShot bool `toml:"oneshot"`
 
 	Command       string   `toml:"command"`
 	FailOnMatch   string   `toml:"fail_on_match"`
@@ -35,6 +37,9 @@ type Config struct {
 
 	APIBase string `toml:"api_base"`
 	Addr    string `toml:"listen_addr"`
+	Token   string `toml:"token"`
+	// AuthDir holds the credentials of the upstream
+	AuthDir string `toml:"auth_dir"`
 
 	ZFSEnable bool   `toml:"zfs_enable"`
 	Zpool     string `toml:"zpool"`
@@ -42,6 +47,13 @@ type Config struct {
 	BtrfsEnable  bool   `toml:"btrfs_enable"`
 	SnapshotPath string `toml:"snapshot_path"`
 
+	ProxyAddr      string   `toml:"proxy_addr"`
+	ProxyPaths     []string `toml:"proxy_paths"`
+	ProxyCacheSize MemBytes `toml:"proxy_cache_size"`
+	ProxyTTL       string   `toml:"proxy_ttl"`
+	ProxyRules     []string `toml:"proxy_rules"`
+	MetricsAddr    string   `toml:"metrics_addr"`
+
 	Verbose bool
 	Debug   bool
 }
@@ -94,6 +106,7 @@ func LoadConfig() (*Config, error) {
 	cfg.Interval = GetIntEnv("INTERVAL", 1440)
 	cfg.Retry = GetIntEnv("RETRY", 0)
 	cfg.Timeout = GetIntEnv("TIMEOUT", 0)
+	cfg.OneShot = GetBoolEnv("ONESHOT")
 
 	cfg.Command = GetStringEnv("COMMAND", "")
 	cfg.FailOnMatch = GetStringEnv("FAIL_ON_MATCH", "")
@@ -112,6 +125,8 @@ func LoadConfig() (*Config, error) {
 
 	cfg.APIBase = GetStringEnv("API", "http://manager:3000")
 	cfg.Addr = GetStringEnv("ADDR", ":6000")
+	cfg.Token = GetStringEnv("TOKEN", "")
+	cfg.AuthDir = GetStringEnv("AUTH_DIR", "")
 
 	cfg.ZFSEnable = GetBoolEnv("ZFS")
 	cfg.Zpool = GetStringEnv("ZPOOL", "")
@@ -119,5 +134,14 @@ func LoadConfig() (*Config, error) {
 	cfg.BtrfsEnable = GetBoolEnv("BTRFS")
 	cfg.SnapshotPath = GetStringEnv("SNAPSHOT_PATH", "")
 
+	cfg.ProxyAddr = GetStringEnv("PROXY_ADDR", ":80")
+	cfg.ProxyPaths = GetListEnv("PROXY_PATHS")
+	if err := cfg.ProxyCacheSize.Set(GetStringEnv("PROXY_CACHE_SIZE", "0")); err != nil {
+		return cfg, err
+	}
+	cfg.ProxyTTL = GetStringEnv("PROXY_TTL", "")
+	cfg.ProxyRules = GetListEnv("PROXY_RULES")
+	cfg.MetricsAddr = GetStringEnv("METRICS_ADDR", "")
+
 	return cfg, nil
 }
@@ -0,0 +1,173 @@
+package worker
+
+import (
+	"html/template"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/cgi"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// gitIndexDepth is how deep below the root repositories are searched for the index page
+const gitIndexDepth = 3
+
+var gitIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Name}}</title></head>
+<body>
+<h1>{{.Name}}</h1>
+{{if .Repos}}<table>
+<tr><th>Repository</th><th>Clone</th></tr>
+{{range .Repos}}<tr><td>{{.Name}}</td><td><code>{{.HTTP}}</code>{{if .Git}}<br><code>{{.Git}}</code>{{end}}</td></tr>
+{{end}}</table>{{else}}<p>No repositories yet.</p>{{end}}
+</body>
+</html>
+`))
+
+type gitRepo struct {
+	Name string
+	HTTP string
+	Git  string
+}
+
+// GitHTTP serves the repositories below Root over the smart HTTP protocol of git http-backend,
+// read only, and an index page of them for any other path
+type GitHTTP struct {
+	Name string
+	Root string
+	// Paths are the public paths of the job, stripped from the requests
+	Paths []string
+	// Daemon adds the git:// urls served by a git daemon to the index
+	Daemon bool
+
+	backend *cgi.Handler
+}
+
+// NewGitHTTP creates the server, git has to be in PATH
+func NewGitHTTP(name, root string, paths []string, daemon bool) (*GitHTTP, error) {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		return nil, err
+	}
+	return &GitHTTP{
+		Name:   name,
+		Root:   root,
+		Paths:  paths,
+		Daemon: daemon,
+		backend: &cgi.Handler{
+			Path: gitPath,
+			Args: []string{"http-backend"},
+			Env:  []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1"},
+			// the safe.directory config is given to the server in env
+			InheritEnv: []string{"GIT_CONFIG_COUNT", "GIT_CONFIG_KEY_0", "GIT_CONFIG_VALUE_0"},
+		},
+	}, nil
+}
+
+func (g *GitHTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefix, rel := g.splitPath(r.URL.Path)
+	if isGitRequest(rel) {
+		if strings.HasSuffix(rel, "/git-receive-pack") || r.URL.Query().Get("service") == "git-receive-pack" {
+			http.Error(w, "the mirror is read only", http.StatusForbidden)
+			return
+		}
+		req := r.Clone(r.Context())
+		req.URL.Path = rel
+		g.backend.ServeHTTP(w, req)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	var repos []gitRepo
+	for _, name := range g.repos() {
+		repo := gitRepo{Name: name, HTTP: scheme + "://" + r.Host + path.Join("/", prefix, name)}
+		if g.Daemon {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			repo.Git = "git://" + host + path.Join("/", name)
+		}
+		if name == "" {
+			repo.Name = g.Name
+		}
+		repos = append(repos, repo)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	gitIndexTemplate.Execute(w, struct {
+		Name  string
+		Repos []gitRepo
+	}{g.Name, repos})
+}
+
+// splitPath splits the request path into the public path of the job it came through and the rest
+func (g *GitHTTP) splitPath(upath string) (prefix, rel string) {
+	for _, v := range g.Paths {
+		v = strings.TrimSuffix(v, "/")
+		if (upath == v || strings.HasPrefix(upath, v+"/")) && len(v) > len(prefix) {
+			prefix = v
+		}
+	}
+	rel = upath[len(prefix):]
+	if rel == "" {
+		rel = "/"
+	}
+	return
+}
+
+// isGitRequest tells if the path is one of the smart or dumb http protocol
+func isGitRequest(rel string) bool {
+	return strings.HasSuffix(rel, "/info/refs") || strings.HasSuffix(rel, "/git-upload-pack") ||
+		strings.HasSuffix(rel, "/git-receive-pack") || strings.HasSuffix(rel, "/HEAD") ||
+		strings.Contains(rel, "/objects/")
+}
+
+// repos returns the repositories below the root, bare ones or work trees with a .git dir
+func (g *GitHTTP) repos() []string {
+	var repos []string
+	filepath.WalkDir(g.Root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(g.Root, p)
+		if rel != "." && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if isBareRepo(p) || isBareRepo(filepath.Join(p, ".git")) {
+			// the root itself is the repository of single repo jobs
+			if rel == "." {
+				rel = ""
+			}
+			repos = append(repos, filepath.ToSlash(rel))
+			return filepath.SkipDir
+		}
+		if strings.Count(filepath.ToSlash(rel), "/") >= gitIndexDepth-1 {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	sort.Strings(repos)
+	return repos
+}
+
+func isBareRepo(dir string) bool {
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return false
+		}
+	}
+	return true
+}
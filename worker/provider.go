@@ -75,6 +75,7 @@ func newMirrorProvider(cfg *Config) mirrorProvider {
 	}
 	logDir := formatLogDir(cfg.LogDir)
 
+	auth := upstreamAuth{dir: cfg.AuthDir}
 	var provider mirrorProvider
 
 	switch cfg.Provider {
@@ -91,6 +92,7 @@ func newMirrorProvider(cfg *Config) mirrorProvider {
 			interval:    time.Duration(cfg.Interval) * time.Minute,
 			retry:       cfg.Retry,
 			timeout:     time.Duration(cfg.Timeout) * time.Second,
+			auth:        auth,
 		}
 		p, err := newCmdProvider(pc)
 		if err != nil {
@@ -115,6 +117,7 @@ func newMirrorProvider(cfg *Config) mirrorProvider {
 			interval:          time.Duration(cfg.Interval) * time.Minute,
 			retry:             cfg.Retry,
 			timeout:           time.Duration(cfg.Timeout) * time.Second,
+			auth:              auth,
 		}
 		p, err := newRsyncProvider(rc)
 		if err != nil {
@@ -139,6 +142,7 @@ func newMirrorProvider(cfg *Config) mirrorProvider {
 			interval:          time.Duration(cfg.Interval) * time.Minute,
 			retry:             cfg.Retry,
 			timeout:           time.Duration(cfg.Timeout) * time.Second,
+			auth:              auth,
 		}
 		p, err := newTwoStageRsyncProvider(rc)
 		if err != nil {
@@ -0,0 +1,610 @@
+package worker
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/CQUPTMirror/kubesync/api/v1beta1"
+	"github.com/CQUPTMirror/kubesync/internal"
+	"github.com/CQUPTMirror/kubesync/manager/client"
+)
+
+// ProxyProvider is the provider of the jobs run as a caching reverse proxy
+const ProxyProvider = "proxy"
+
+const (
+	defaultProxyTTL     = time.Hour
+	proxyReportInterval = time.Minute
+	proxyMetaSuffix     = ".meta"
+	// an upstream may take long to send a body, not to start answering
+	proxyHeaderTimeout = time.Minute
+	proxyIdleTimeout   = 90 * time.Second
+)
+
+// alwaysVary are the request headers keying the cache even if the upstream sends no Vary for them,
+// registries serve the manifest of the media type asked for in Accept without one
+var alwaysVary = []string{"Accept"}
+
+// hopHeaders are not passed through the proxy, nor stored in the cache
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization", "Proxy-Connection",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+type proxyRule struct {
+	pattern string
+	ttl     time.Duration
+}
+
+// cacheMeta is stored next to every cached body
+type cacheMeta struct {
+	Key string `json:"key"`
+	// Base is the path and query of the key, Vary the request headers which make up the rest of it
+	Base    string      `json:"base"`
+	Vary    []string    `json:"vary,omitempty"`
+	Header  http.Header `json:"header"`
+	Expires int64       `json:"expires"`
+	Size    int64       `json:"size"`
+}
+
+type cacheEntry struct {
+	cacheMeta
+	file string
+	elem *list.Element
+}
+
+// Proxy is a caching reverse proxy of the upstream of a job. Successful GET responses are kept on the
+// volume of the job for the ttl of their path, the least recently used ones are evicted above the cache size.
+type Proxy struct {
+	cfg      *Config
+	upstream *url.URL
+	dir      string
+	ttl      time.Duration
+	rules    []proxyRule
+	client   *http.Client
+	auth     upstreamAuth
+	manager  *client.Client
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	// vary holds the request headers keying the responses of each path and query,
+	// variants counts the responses cached for it
+	vary     map[string][]string
+	variants map[string]int
+	// lru holds the keys, the most recently used first
+	lru  *list.List
+	size int64
+
+	hits, misses atomic.Uint64
+}
+
+// NewProxy creates the proxy of the job in cfg and loads its cache from disk
+func NewProxy(cfg *Config) (*Proxy, error) {
+	upstream, err := url.Parse(cfg.Upstream)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream: %w", err)
+	}
+	p := &Proxy{
+		cfg:      cfg,
+		upstream: upstream,
+		dir:      filepath.Join(cfg.MirrorDir, cfg.Name),
+		ttl:      defaultProxyTTL,
+		client: &http.Client{Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			MaxIdleConnsPerHost:   20,
+			ResponseHeaderTimeout: proxyHeaderTimeout,
+			IdleConnTimeout:       proxyIdleTimeout,
+		}},
+		auth:     upstreamAuth{dir: cfg.AuthDir},
+		entries:  make(map[string]*cacheEntry),
+		vary:     make(map[string][]string),
+		variants: make(map[string]int),
+		lru:      list.New(),
+	}
+	if cfg.ProxyTTL != "" {
+		if p.ttl, err = time.ParseDuration(cfg.ProxyTTL); err != nil {
+			return nil, fmt.Errorf("invalid ttl: %w", err)
+		}
+	}
+	for _, r := range cfg.ProxyRules {
+		pattern, ttl, ok := strings.Cut(r, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rule %s", r)
+		}
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ttl of rule %s: %w", pattern, err)
+		}
+		p.rules = append(p.rules, proxyRule{pattern: pattern, ttl: d})
+	}
+
+	hc, _ := CreateHTTPClient()
+	p.manager = client.New(cfg.APIBase, client.WithToken(cfg.Token), client.WithHTTPClient(hc))
+
+	p.registry = prometheus.NewRegistry()
+	p.requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kubesync_proxy_requests_total",
+		Help: "Requests served by the proxy, by whether they were served from the cache",
+	}, []string{"cache"})
+	p.registry.MustRegister(p.requests, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "kubesync_proxy_cache_bytes",
+		Help: "Size of the responses in the cache",
+	}, func() float64 {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return float64(p.size)
+	}))
+
+	if err := p.load(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Run registers the job and serves the proxy, the worker api and the metrics
+func (p *Proxy) Run() error {
+	for retry := 10; retry > 0; retry-- {
+		err := p.manager.RegisterJob(context.Background(), p.cfg.Name)
+		if err == nil {
+			break
+		}
+		logger.Errorf("Failed to register worker: %s", err.Error())
+		time.Sleep(time.Second)
+	}
+
+	api := gin.New()
+	api.Use(gin.Recovery())
+	api.POST("/", func(c *gin.Context) {
+		var cmd internal.ClientCmd
+		if err := c.BindJSON(&cmd); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"msg": "Invalid request"})
+			return
+		}
+		if cmd.Cmd != internal.CmdPing {
+			c.JSON(http.StatusNotAcceptable, gin.H{"msg": "Proxy jobs only accept ping"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"msg": "OK"})
+	})
+	api.GET("/healthz", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	go func() {
+		if err := http.ListenAndServe(p.cfg.Addr, api); err != nil {
+			panic(err)
+		}
+	}()
+	if p.cfg.MetricsAddr != "" {
+		go func() {
+			if err := http.ListenAndServe(p.cfg.MetricsAddr, promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{})); err != nil {
+				panic(err)
+			}
+		}()
+	}
+	go p.report()
+
+	logger.Noticef("Proxy %s serving on %s", p.cfg.Upstream, p.cfg.ProxyAddr)
+	return http.ListenAndServe(p.cfg.ProxyAddr, p)
+}
+
+// report sends the cache status to the manager periodically
+func (p *Proxy) report() {
+	for {
+		p.mu.Lock()
+		size := p.size
+		p.mu.Unlock()
+		status := v1beta1.JobStatus{
+			Status:      v1beta1.Cached,
+			Upstream:    p.cfg.Upstream,
+			Size:        uint64(size),
+			CacheHits:   p.hits.Load(),
+			CacheMisses: p.misses.Load(),
+		}
+		if _, err := p.manager.UpdateJobStatus(context.Background(), p.cfg.Name, status); err != nil {
+			logger.Errorf("Failed to update proxy status: %s", err.Error())
+		}
+		time.Sleep(proxyReportInterval)
+	}
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	upath := cleanPath(p.stripPath(r.URL.Path))
+	ttl := p.ttlOf(upath)
+	cacheable := ttl > 0 && (r.Method == http.MethodGet || r.Method == http.MethodHead)
+	base := upath
+	if r.URL.RawQuery != "" {
+		base += "?" + r.URL.RawQuery
+	}
+	p.mu.Lock()
+	vary := p.vary[base]
+	p.mu.Unlock()
+	key := cacheKey(base, vary, r.Header)
+
+	if cacheable {
+		if e := p.get(key); e != nil && p.serveCached(w, r, e) {
+			p.hits.Add(1)
+			p.requests.WithLabelValues("hit").Inc()
+			return
+		}
+	}
+	p.misses.Add(1)
+	p.requests.WithLabelValues("miss").Inc()
+
+	// requests for only a part of the body are passed through, as are the ones not cached
+	store := cacheable && r.Method == http.MethodGet && r.Header.Get("Range") == ""
+	ctx := r.Context()
+	if store {
+		// the response is cached even if the client goes away
+		ctx = context.WithoutCancel(ctx)
+	}
+	resp, err := p.do(ctx, r, upath)
+	if err != nil {
+		logger.Errorf("Failed to fetch %s: %s", key, err.Error())
+		http.Error(w, "failed to fetch from upstream", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	header := resp.Header.Clone()
+	removeHopHeaders(header)
+	for k, v := range header {
+		w.Header()[k] = v
+	}
+	vary, ok := varyHeaders(resp.Header)
+	// a response to the credentials of a client is only shared when the upstream says so
+	if r.Header.Get("Authorization") != "" && !public(resp.Header) {
+		vary = append(vary, "Authorization")
+	}
+	key = cacheKey(base, vary, r.Header)
+	if !ok || !store || resp.StatusCode != http.StatusOK || noStore(resp.Header) {
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+	w.Header().Set("X-Cache", "MISS")
+	w.WriteHeader(resp.StatusCode)
+
+	tmp, err := os.CreateTemp(p.tmpDir(), "body-")
+	if err != nil {
+		logger.Errorf("Failed to create cache file: %s", err.Error())
+		io.Copy(w, resp.Body)
+		return
+	}
+	cw := &clientWriter{w: w}
+	n, err := io.Copy(io.MultiWriter(cw, tmp), resp.Body)
+	tmp.Close()
+	if err == nil && resp.ContentLength >= 0 && n != resp.ContentLength {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		logger.Errorf("Failed to fetch %s: %s", key, err.Error())
+		os.Remove(tmp.Name())
+		return
+	}
+	header.Del("Content-Length")
+	header.Del("Set-Cookie")
+	meta := cacheMeta{Key: key, Base: base, Vary: vary, Header: header, Expires: time.Now().Add(ttl).Unix(), Size: n}
+	if err := p.put(meta, tmp.Name()); err != nil {
+		logger.Errorf("Failed to cache %s: %s", key, err.Error())
+		os.Remove(tmp.Name())
+	}
+}
+
+// do sends the request to the upstream, following its redirects
+func (p *Proxy) do(ctx context.Context, r *http.Request, upath string) (*http.Response, error) {
+	u := *p.upstream
+	u.Path = strings.TrimSuffix(u.Path, "/") + upath
+	u.RawPath = ""
+	u.RawQuery = r.URL.RawQuery
+	req, err := http.NewRequestWithContext(ctx, r.Method, u.String(), r.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = r.Header.Clone()
+	removeHopHeaders(req.Header)
+	// the transport asks for and decompresses gzip itself, so the cache never holds encoded bodies
+	req.Header.Del("Accept-Encoding")
+	// the credentials of the upstream are only used for the clients bringing none
+	if req.Header.Get("Authorization") == "" {
+		p.auth.setHeader(req)
+	}
+	req.ContentLength = r.ContentLength
+	return p.client.Do(req)
+}
+
+// stripPath removes the public path of the job the request came through
+func (p *Proxy) stripPath(upath string) string {
+	var prefix string
+	for _, v := range p.cfg.ProxyPaths {
+		v = strings.TrimSuffix(v, "/")
+		if (upath == v || strings.HasPrefix(upath, v+"/")) && len(v) > len(prefix) {
+			prefix = v
+		}
+	}
+	upath = upath[len(prefix):]
+	if upath == "" {
+		upath = "/"
+	}
+	return upath
+}
+
+// ttlOf returns the ttl of the first rule matching the path, or the default one
+func (p *Proxy) ttlOf(upath string) time.Duration {
+	for _, r := range p.rules {
+		name := upath
+		if !strings.Contains(r.pattern, "/") {
+			name = path.Base(upath)
+		}
+		if ok, _ := path.Match(r.pattern, name); ok {
+			return r.ttl
+		}
+	}
+	return p.ttl
+}
+
+// serveCached serves the cached response, it returns false if the body is gone
+func (p *Proxy) serveCached(w http.ResponseWriter, r *http.Request, e *cacheEntry) bool {
+	f, err := os.Open(e.file)
+	if err != nil {
+		p.remove(e.Key)
+		return false
+	}
+	defer f.Close()
+	for k, v := range e.Header {
+		w.Header()[k] = v
+	}
+	w.Header().Set("X-Cache", "HIT")
+	// serving the content handles conditional and range requests
+	http.ServeContent(w, r, "", time.Time{}, f)
+	return true
+}
+
+// get returns the entry of the key if it is not expired, and marks it as used
+func (p *Proxy) get(key string) *cacheEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e, ok := p.entries[key]
+	if !ok || time.Now().Unix() >= e.Expires {
+		return nil
+	}
+	p.lru.MoveToFront(e.elem)
+	return e
+}
+
+// put moves the body into the cache and evicts the least recently used entries above the cache size
+func (p *Proxy) put(meta cacheMeta, body string) error {
+	file := p.cacheFile(meta.Key)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file+proxyMetaSuffix, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(body, file); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if old, ok := p.entries[meta.Key]; ok {
+		p.size -= old.Size
+		p.lru.Remove(old.elem)
+	} else {
+		p.variants[meta.Base]++
+	}
+	e := &cacheEntry{cacheMeta: meta, file: file}
+	e.elem = p.lru.PushFront(meta.Key)
+	p.entries[meta.Key] = e
+	p.vary[meta.Base] = meta.Vary
+	p.size += meta.Size
+	p.evict()
+	return nil
+}
+
+func (p *Proxy) remove(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e, ok := p.entries[key]; ok {
+		p.drop(e)
+	}
+}
+
+// evict drops the least recently used entries until the cache fits, p.mu must be held
+func (p *Proxy) evict() {
+	limit := p.cfg.ProxyCacheSize.Value()
+	if limit <= 0 {
+		return
+	}
+	for p.size > limit && p.lru.Len() > 0 {
+		p.drop(p.entries[p.lru.Back().Value.(string)])
+	}
+}
+
+// drop removes an entry and its files, p.mu must be held
+func (p *Proxy) drop(e *cacheEntry) {
+	delete(p.entries, e.Key)
+	p.lru.Remove(e.elem)
+	if p.variants[e.Base]--; p.variants[e.Base] <= 0 {
+		delete(p.variants, e.Base)
+		delete(p.vary, e.Base)
+	}
+	p.size -= e.Size
+	os.Remove(e.file)
+	os.Remove(e.file + proxyMetaSuffix)
+}
+
+// load rebuilds the index of the cache from disk, the entries used last are the ones written last
+func (p *Proxy) load() error {
+	if err := os.RemoveAll(p.tmpDir()); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(p.tmpDir(), 0755); err != nil {
+		return err
+	}
+	type loaded struct {
+		*cacheEntry
+		mtime time.Time
+	}
+	var all []loaded
+	err := filepath.WalkDir(filepath.Join(p.dir, "cache"), func(file string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil || d.IsDir() || !strings.HasSuffix(file, proxyMetaSuffix) {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		e := &cacheEntry{file: strings.TrimSuffix(file, proxyMetaSuffix)}
+		data, err := os.ReadFile(file)
+		if err == nil {
+			err = json.Unmarshal(data, &e.cacheMeta)
+		}
+		// entries written before the keys had a base can not be looked up anymore
+		if _, serr := os.Stat(e.file); err != nil || serr != nil || e.Base == "" {
+			os.Remove(file)
+			os.Remove(e.file)
+			return nil
+		}
+		all = append(all, loaded{e, info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].mtime.After(all[j].mtime) })
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, l := range all {
+		l.elem = p.lru.PushBack(l.Key)
+		p.entries[l.Key] = l.cacheEntry
+		p.size += l.Size
+		p.variants[l.Base]++
+		// the headers of the response used last key the path
+		if _, ok := p.vary[l.Base]; !ok {
+			p.vary[l.Base] = l.Vary
+		}
+	}
+	p.evict()
+	logger.Noticef("Loaded %d cached responses of %d bytes", len(p.entries), p.size)
+	return nil
+}
+
+func (p *Proxy) cacheFile(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(p.dir, "cache", name[:2], name)
+}
+
+func (p *Proxy) tmpDir() string {
+	return filepath.Join(p.dir, "tmp")
+}
+
+// cleanPath resolves the dot segments of a request path so they can not escape the upstream path,
+// and keeps its trailing slash
+func cleanPath(upath string) string {
+	cleaned := path.Clean("/" + upath)
+	if strings.HasSuffix(upath, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// cacheKey adds the values of the vary request headers to the path and query in base,
+// the credentials are hashed so they are not written to the cache
+func cacheKey(base string, vary []string, h http.Header) string {
+	names := append(append([]string{}, alwaysVary...), vary...)
+	for i, name := range names {
+		names[i] = http.CanonicalHeaderKey(name)
+	}
+	sort.Strings(names)
+	names = slices.Compact(names)
+	var b strings.Builder
+	b.WriteString(base)
+	for _, name := range names {
+		value := strings.Join(h.Values(name), ",")
+		if name == "Authorization" && value != "" {
+			sum := sha256.Sum256([]byte(value))
+			value = hex.EncodeToString(sum[:])
+		}
+		fmt.Fprintf(&b, "\n%s: %s", name, value)
+	}
+	return b.String()
+}
+
+// varyHeaders returns the request headers named in the Vary of the response,
+// false if it varies on everything and can not be cached
+func varyHeaders(h http.Header) ([]string, bool) {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return nil, false
+			}
+			// the cache only holds decoded bodies
+			if name != "" && !strings.EqualFold(name, "Accept-Encoding") {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names, true
+}
+
+func removeHopHeaders(h http.Header) {
+	for _, k := range hopHeaders {
+		h.Del(k)
+	}
+}
+
+func noStore(h http.Header) bool {
+	cc := strings.ToLower(h.Get("Cache-Control"))
+	return strings.Contains(cc, "no-store") || strings.Contains(cc, "private")
+}
+
+func public(h http.Header) bool {
+	return strings.Contains(strings.ToLower(h.Get("Cache-Control")), "public")
+}
+
+// clientWriter writes to the client until it fails, without failing the copy into the cache
+type clientWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (c *clientWriter) Write(b []byte) (int, error) {
+	if c.err == nil {
+		_, c.err = c.w.Write(b)
+	}
+	return len(b), nil
+}
@@ -0,0 +1,155 @@
+package worker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// upstreamServer counts the requests of every path, and answers with the path and the vary headers
+type upstreamServer struct {
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func (u *upstreamServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.mu.Lock()
+	u.requests[r.URL.Path]++
+	u.mu.Unlock()
+	w.Header().Set("Vary", "Accept-Encoding, X-Arch")
+	w.Write([]byte(r.URL.Path + " " + r.Header.Get("Accept") + " " + r.Header.Get("X-Arch")))
+}
+
+func (u *upstreamServer) count(upath string) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.requests[upath]
+}
+
+func newTestProxy(t *testing.T, cacheSize string) (*Proxy, *upstreamServer) {
+	u := &upstreamServer{requests: make(map[string]int)}
+	srv := httptest.NewServer(u)
+	t.Cleanup(srv.Close)
+	cfg := &Config{Name: "pypi", Upstream: srv.URL + "/pypi/", MirrorDir: t.TempDir(), ProxyPaths: []string{"/pypi"}}
+	if err := cfg.ProxyCacheSize.Set(cacheSize); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewProxy(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, u
+}
+
+func get(p *Proxy, target string, header map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	return w
+}
+
+func TestProxyCache(t *testing.T) {
+	p, u := newTestProxy(t, "0")
+
+	if w := get(p, "/pypi/simple/", nil); w.Code != http.StatusOK || w.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("expected a miss, got %d %v", w.Code, w.Header())
+	}
+	w := get(p, "/pypi/simple/", nil)
+	if w.Header().Get("X-Cache") != "HIT" || w.Body.String() != "/pypi/simple/  " {
+		t.Fatalf("expected a hit, got %v %q", w.Header(), w.Body.String())
+	}
+	if n := u.count("/pypi/simple/"); n != 1 {
+		t.Errorf("expected one upstream request, got %d", n)
+	}
+
+	// dot segments are resolved before the path is joined to the upstream and keys the cache
+	if w := get(p, "/pypi/packages/../simple/", nil); w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("expected the cleaned path to hit, got %v", w.Header())
+	}
+	get(p, "/pypi/../../etc/passwd", nil)
+	if n := u.count("/pypi/etc/passwd"); n != 1 {
+		t.Errorf("expected the path kept below the upstream, got %v", u.requests)
+	}
+}
+
+func TestProxyExpire(t *testing.T) {
+	p, u := newTestProxy(t, "0")
+
+	get(p, "/pypi/simple/", nil)
+	p.mu.Lock()
+	for _, e := range p.entries {
+		e.Expires = time.Now().Add(-time.Second).Unix()
+	}
+	p.mu.Unlock()
+	if w := get(p, "/pypi/simple/", nil); w.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("expected the expired response to miss, got %v", w.Header())
+	}
+	if n := u.count("/pypi/simple/"); n != 2 {
+		t.Errorf("expected the response fetched again, got %d requests", n)
+	}
+}
+
+func TestProxyEvict(t *testing.T) {
+	// each body is 9 bytes, the cache holds one of them
+	p, u := newTestProxy(t, "15")
+
+	get(p, "/pypi/a", nil)
+	get(p, "/pypi/b", nil)
+	if w := get(p, "/pypi/b", nil); w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("expected the last response cached, got %v", w.Header())
+	}
+	if w := get(p, "/pypi/a", nil); w.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("expected the least recently used response evicted, got %v", w.Header())
+	}
+	if u.count("/pypi/a") != 2 || u.count("/pypi/b") != 1 {
+		t.Errorf("unexpected upstream requests %v", u.requests)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.size > 15 || len(p.entries) != 1 {
+		t.Errorf("the cache of %d bytes in %d entries is above its size", p.size, len(p.entries))
+	}
+}
+
+func TestProxyVary(t *testing.T) {
+	p, u := newTestProxy(t, "0")
+
+	for i := 0; i < 2; i++ {
+		for _, h := range []map[string]string{
+			{"Accept": "application/vnd.oci.image.index.v1+json"},
+			{"Accept": "application/vnd.docker.distribution.manifest.v2+json"},
+			{"Accept": "application/vnd.docker.distribution.manifest.v2+json", "X-Arch": "arm64"},
+		} {
+			w := get(p, "/pypi/manifests/latest", h)
+			if want := "/pypi/manifests/latest " + h["Accept"] + " " + h["X-Arch"]; w.Body.String() != want {
+				t.Errorf("expected %q for %v, got %q", want, h, w.Body.String())
+			}
+		}
+	}
+	if n := u.count("/pypi/manifests/latest"); n != 3 {
+		t.Errorf("expected a response cached for each variant, got %d upstream requests", n)
+	}
+
+	// the variants are found again after a restart
+	reloaded, err := NewProxy(p.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := get(reloaded, "/pypi/manifests/latest", map[string]string{"X-Arch": "arm64", "Accept": "application/vnd.docker.distribution.manifest.v2+json"}); w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("expected the variant loaded from disk, got %v", w.Header())
+	}
+
+	// the responses to the credentials of a client are kept for those credentials only
+	get(p, "/pypi/private", map[string]string{"Authorization": "Bearer a"})
+	if w := get(p, "/pypi/private", map[string]string{"Authorization": "Bearer a"}); w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("expected the response cached for its credentials, got %v", w.Header())
+	}
+	if w := get(p, "/pypi/private", nil); w.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("expected the response not shared without credentials, got %v", w.Header())
+	}
+}
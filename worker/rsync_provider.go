@@ -20,6 +20,7 @@ type rsyncConfig struct {
 	interval                    time.Duration
 	retry                       int
 	timeout                     time.Duration
+	auth                        upstreamAuth
 }
 
 // An RsyncProvider provides the implementation to rsync-based syncing jobs
@@ -83,6 +84,7 @@ func newRsyncProvider(c rsyncConfig) (*rsyncProvider, error) {
 	if c.extraOptions != nil {
 		options = append(options, c.extraOptions...)
 	}
+	options = append(options, c.auth.rsyncOptions()...)
 	provider.options = options
 
 	provider.ctx.Set(_WorkingDirKey, c.workingDir)
@@ -133,7 +135,7 @@ func (p *rsyncProvider) Start() error {
 	command = append(command, p.options...)
 	command = append(command, p.upstreamURL, p.WorkingDir())
 
-	p.cmd = newCmdJob(p, command, p.WorkingDir(), nil)
+	p.cmd = newCmdJob(p, command, p.WorkingDir(), p.auth.env())
 	if err := p.prepareLogFile(false); err != nil {
 		return err
 	}
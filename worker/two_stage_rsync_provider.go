@@ -20,6 +20,7 @@ type twoStageRsyncConfig struct {
 	interval                    time.Duration
 	retry                       int
 	timeout                     time.Duration
+	auth                        upstreamAuth
 }
 
 // An RsyncProvider provides the implementation to rsync-based syncing jobs
@@ -128,6 +129,7 @@ func (p *twoStageRsyncProvider) Options(stage int) ([]string, error) {
 	if p.excludeFile != "" {
 		options = append(options, "--exclude-from", p.excludeFile)
 	}
+	options = append(options, p.auth.rsyncOptions()...)
 
 	return options, nil
 }
@@ -151,7 +153,7 @@ func (p *twoStageRsyncProvider) Run(started chan empty) error {
 		command = append(command, options...)
 		command = append(command, p.upstreamURL, p.WorkingDir())
 
-		p.cmd = newCmdJob(p, command, p.WorkingDir(), nil)
+		p.cmd = newCmdJob(p, command, p.WorkingDir(), p.auth.env())
 		if err := p.prepareLogFile(stage > 1); err != nil {
 			return err
 		}
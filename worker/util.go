@@ -1,13 +1,10 @@
 package worker
 
 import (
-	"bytes"
 	"crypto/tls"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/CQUPTMirror/kubesync/internal"
-	"io"
 	"net/http"
 	"os"
 	"os/exec"
@@ -57,46 +54,6 @@ func CreateHTTPClient() (*http.Client, error) {
 	}, nil
 }
 
-// HandleRequest post/head url
-func (w *Worker) HandleRequest(method, url string, obj interface{}) (*http.Response, error) {
-	var req *http.Request
-	var err error
-
-	if obj != nil {
-		var b *bytes.Buffer
-		b = new(bytes.Buffer)
-		if err := json.NewEncoder(b).Encode(obj); err != nil {
-			return nil, err
-		}
-		req, err = http.NewRequest(method, url, b)
-	} else {
-		req, err = http.NewRequest(method, url, nil)
-	}
-
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json; charset=utf-8")
-	return w.httpClient.Do(req)
-}
-
-// GetJSON gets a json response from url
-func (w *Worker) GetJSON(url string, obj interface{}) (*http.Response, error) {
-	resp, err := w.httpClient.Get(url)
-	if err != nil {
-		return resp, err
-	}
-	if resp.StatusCode != http.StatusOK {
-		return resp, errors.New("HTTP status code is not 200")
-	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return resp, err
-	}
-	return resp, json.Unmarshal(body, obj)
-}
-
 // FindAllSubmatchInFile calls re.FindAllSubmatch to find matches in given file
 func FindAllSubmatchInFile(fileName string, re *regexp.Regexp) (matches [][][]byte, err error) {
 	if fileName == "/dev/null" {
@@ -155,13 +112,19 @@ func ExtractSizeFromWalk(path string) uint64 {
 
 // ExtractSizeFromFileSystem extracts the size from filesystem
 func ExtractSizeFromFileSystem(path string) uint64 {
+	used, _ := ExtractFileSystemUsage(path)
+	return used
+}
+
+// ExtractFileSystemUsage returns the used and total bytes of the filesystem holding path
+func ExtractFileSystemUsage(path string) (used, capacity uint64) {
 	fs := syscall.Statfs_t{}
 	err := syscall.Statfs(path, &fs)
 	if err != nil {
-		return 0
+		return 0, 0
 	}
 
-	return (fs.Blocks - fs.Bfree) * uint64(fs.Bsize)
+	return (fs.Blocks - fs.Bfree) * uint64(fs.Bsize), fs.Blocks * uint64(fs.Bsize)
 }
 
 // TranslateRsyncErrorCode translates the exit code of rsync to a message
@@ -1,9 +1,10 @@
 package worker
 
 import (
-	"fmt"
+	"context"
 	"github.com/CQUPTMirror/kubesync/api/v1beta1"
 	"github.com/CQUPTMirror/kubesync/internal"
+	"github.com/CQUPTMirror/kubesync/manager/client"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -25,7 +26,7 @@ type Worker struct {
 
 	schedule   *schedule
 	httpEngine *gin.Engine
-	httpClient *http.Client
+	manager    *client.Client
 }
 
 // NewTUNASyncWorker creates a worker
@@ -34,7 +35,7 @@ func NewTUNASyncWorker(cfg *Config) *Worker {
 	if cfg.Retry == 0 {
 		cfg.Retry = defaultMaxRetry
 	}
-	client, _ := CreateHTTPClient()
+	hc, _ := CreateHTTPClient()
 
 	w := &Worker{
 		cfg: cfg,
@@ -45,7 +46,7 @@ func NewTUNASyncWorker(cfg *Config) *Worker {
 
 		schedule: newSchedule(),
 
-		httpClient: client,
+		manager: client.New(cfg.APIBase, client.WithToken(cfg.Token), client.WithHTTPClient(hc)),
 	}
 
 	w.initJobs()
@@ -60,6 +61,41 @@ func (w *Worker) Run() {
 	w.runSchedule()
 }
 
+// RunOnce syncs the job once, with its retries, and reports the status to the manager.
+// It returns whether the sync succeeded
+func (w *Worker) RunOnce() bool {
+	w.registerWorker()
+
+	w.L.Lock()
+	w.job.SetState(stateReady)
+	go w.job.Run(w.managerChan, w.semaphore)
+	w.L.Unlock()
+
+	for {
+		select {
+		case jobMsg := <-w.managerChan:
+			w.updateStatus(w.job, jobMsg)
+			// the success or the final failure ends the sync
+			if jobMsg.schedule {
+				w.job.ctrlChan <- jobDisable
+				<-w.job.disabled
+				return jobMsg.status == v1beta1.Success
+			}
+		case <-w.exit:
+			for {
+				select {
+				case jobMsg := <-w.managerChan:
+					if jobMsg.status == v1beta1.Failed || jobMsg.status == v1beta1.Success {
+						w.updateStatus(w.job, jobMsg)
+					}
+				default:
+					return false
+				}
+			}
+		}
+	}
+}
+
 // Halt stops all jobs
 func (w *Worker) Halt() {
 	w.L.Lock()
@@ -131,6 +167,13 @@ func (w *Worker) makeHTTPServer() {
 
 		c.JSON(http.StatusOK, gin.H{"msg": "OK"})
 	})
+	s.GET("/healthz", func(c *gin.Context) {
+		if w.job.State() == stateHalting {
+			c.String(http.StatusServiceUnavailable, "halting")
+			return
+		}
+		c.String(http.StatusOK, "ok")
+	})
 	s.GET("/log", func(c *gin.Context) {
 		logger.Noticef("Return latest log")
 		filePath := filepath.Join(w.cfg.LogDir, "latest")
@@ -248,11 +291,10 @@ func (w *Worker) Name() string {
 }
 
 func (w *Worker) registerWorker() {
-	url := fmt.Sprintf("%s/job/%s", w.cfg.APIBase, w.Name())
-	logger.Debugf("register on manager url: %s", url)
+	logger.Debugf("register on manager: %s", w.cfg.APIBase)
 	for retry := 10; retry > 0; {
-		if _, err := w.HandleRequest("HEAD", url, nil); err != nil {
-			logger.Errorf("Failed to register worker")
+		if err := w.manager.RegisterJob(context.Background(), w.Name()); err != nil {
+			logger.Errorf("Failed to register worker: %s", err.Error())
 			retry--
 			if retry > 0 {
 				time.Sleep(1 * time.Second)
@@ -267,37 +309,26 @@ func (w *Worker) registerWorker() {
 func (w *Worker) updateStatus(job *mirrorJob, jobMsg jobMessage) {
 	p := job.provider
 	smsg := v1beta1.JobStatus{Status: jobMsg.status, Upstream: p.Upstream(), Size: job.size, ErrorMsg: jobMsg.msg}
-	url := fmt.Sprintf(
-		"%s/job/%s", w.cfg.APIBase, w.Name(),
-	)
-	logger.Debugf("reporting on manager url: %s", url)
+	smsg.VolumeUsed, smsg.VolumeCapacity = ExtractFileSystemUsage(p.WorkingDir())
 	logger.Debugf("reporting data: %+v", smsg)
-	if _, err := w.HandleRequest("PATCH", url, smsg); err != nil {
+	if _, err := w.manager.UpdateJobStatus(context.Background(), w.Name(), smsg); err != nil {
 		logger.Errorf("Failed to update mirror(%s) status: %s", w.Name(), err.Error())
 	}
 }
 
 func (w *Worker) updateSchedInfo(nextScheduled int64) {
-	msg := internal.MirrorSchedule{NextSchedule: nextScheduled}
-
-	url := fmt.Sprintf(
-		"%s/job/%s/schedule", w.cfg.APIBase, w.Name(),
-	)
-	logger.Debugf("reporting on manager url: %s", url)
-	logger.Debugf("reporting data: %+v", msg)
-	if _, err := w.HandleRequest("POST", url, msg); err != nil {
+	logger.Debugf("reporting next schedule: %d", nextScheduled)
+	if err := w.manager.UpdateSchedule(context.Background(), w.Name(), nextScheduled); err != nil {
 		logger.Errorf("Failed to upload schedule: %s", err.Error())
 	}
 }
 
 func (w *Worker) fetchJobStatus() v1beta1.JobStatus {
-	var mirror v1beta1.JobStatus
-
-	url := fmt.Sprintf("%s/job/%s", w.cfg.APIBase, w.Name())
-
-	if _, err := w.GetJSON(url, &mirror); err != nil {
+	mirror, err := w.manager.GetJob(context.Background(), w.Name())
+	if err != nil {
 		logger.Errorf("Failed to fetch job status: %s", err.Error())
+		return v1beta1.JobStatus{}
 	}
 
-	return mirror
+	return *mirror
 }